@@ -0,0 +1,315 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	icsDateLayout     = "20060102"
+	icsDateTimeLayout = "20060102T150405"
+)
+
+var icsTextReplacer = strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseCalendarBlackouts reads the events of an iCalendar (ICS) file as blackout periods, times without a timezone
+// are read in the given location. Recurring events are expanded until the horizon, only the DAILY, WEEKLY, MONTHLY
+// and YEARLY frequencies with INTERVAL, COUNT, UNTIL and weekly BYDAY are supported, other rules are rejected.
+func parseCalendarBlackouts(content string, location *time.Location, horizon time.Time) ([]blackoutPeriod, error) {
+	// Long lines are folded by starting the continuation line with a space or a tab
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\n ", "")
+	content = strings.ReplaceAll(content, "\n\t", "")
+
+	var periods []blackoutPeriod
+	var event *calendarEvent
+	events := 0
+	for _, line := range strings.Split(content, "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		property, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(property) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				event = &calendarEvent{}
+			}
+		case "END":
+			if event == nil || !strings.EqualFold(value, "VEVENT") {
+				continue
+			}
+
+			events++
+			eventPeriods, err := event.periods(location, horizon)
+			if err != nil {
+				return nil, fmt.Errorf("event %d %q: %w", events, event.summary, err)
+			}
+			periods = append(periods, eventPeriods...)
+			event = nil
+		case "SUMMARY":
+			if event != nil {
+				event.summary = icsTextReplacer.Replace(value)
+			}
+		case "DTSTART":
+			if event != nil {
+				event.start, event.startParams = value, params
+			}
+		case "DTEND":
+			if event != nil {
+				event.end, event.endParams = value, params
+			}
+		case "RRULE":
+			if event != nil {
+				event.rrule = value
+			}
+		case "EXDATE":
+			if event != nil {
+				event.exdates = append(event.exdates, calendarValue{value: value, params: params})
+			}
+		case "RDATE":
+			if event != nil {
+				event.rdate = true
+			}
+		}
+	}
+
+	return periods, nil
+}
+
+type calendarEvent struct {
+	summary     string
+	start       string
+	startParams string
+	end         string
+	endParams   string
+	rrule       string
+	exdates     []calendarValue
+	rdate       bool
+}
+
+type calendarValue struct {
+	value  string
+	params string
+}
+
+// periods returns the blackout periods of every occurrence of the event that starts before the horizon
+func (e *calendarEvent) periods(location *time.Location, horizon time.Time) ([]blackoutPeriod, error) {
+	if e.start == "" {
+		return nil, errors.New("missing DTSTART")
+	}
+
+	if e.rdate {
+		return nil, errors.New("RDATE is not supported")
+	}
+
+	start, allDay, err := parseCalendarTime(e.start, e.startParams, location)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start
+	if allDay {
+		end = start.AddDate(0, 0, 1)
+	}
+
+	if e.end != "" {
+		end, _, err = parseCalendarTime(e.end, e.endParams, location)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.rrule == "" {
+		return []blackoutPeriod{{name: e.summary, start: start, end: end}}, nil
+	}
+
+	rule, err := parseRecurrenceRule(e.rrule, location)
+	if err != nil {
+		return nil, err
+	}
+
+	var excluded []time.Time
+	for _, exdate := range e.exdates {
+		for _, value := range strings.Split(exdate.value, ",") {
+			t, _, err := parseCalendarTime(value, exdate.params, location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXDATE %s", value)
+			}
+			excluded = append(excluded, t)
+		}
+	}
+
+	// All-day events keep their length in days, so they still end at midnight after a daylight saving change
+	days := int(end.Sub(start).Round(24*time.Hour) / (24 * time.Hour))
+	var periods []blackoutPeriod
+	for _, occurrence := range rule.occurrences(start, horizon) {
+		if slices.ContainsFunc(excluded, occurrence.Equal) {
+			continue
+		}
+
+		occurrenceEnd := occurrence.Add(end.Sub(start))
+		if allDay {
+			occurrenceEnd = occurrence.AddDate(0, 0, days)
+		}
+		periods = append(periods, blackoutPeriod{name: e.summary, start: occurrence, end: occurrenceEnd})
+	}
+
+	return periods, nil
+}
+
+// recurrenceRule is the supported subset of an RRULE
+type recurrenceRule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+func parseRecurrenceRule(value string, location *time.Location) (recurrenceRule, error) {
+	rule := recurrenceRule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, partValue, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(partValue)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(partValue)
+			if err != nil || interval < 1 {
+				return recurrenceRule{}, fmt.Errorf("invalid RRULE INTERVAL %s", partValue)
+			}
+			rule.interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(partValue)
+			if err != nil || count < 1 {
+				return recurrenceRule{}, fmt.Errorf("invalid RRULE COUNT %s", partValue)
+			}
+			rule.count = count
+		case "UNTIL":
+			until, _, err := parseCalendarTime(partValue, "", location)
+			if err != nil {
+				return recurrenceRule{}, fmt.Errorf("invalid RRULE UNTIL %s", partValue)
+			}
+			rule.until = until
+		case "BYDAY":
+			for _, day := range strings.Split(partValue, ",") {
+				weekday, ok := icsWeekdays[strings.ToUpper(day)]
+				if !ok {
+					return recurrenceRule{}, fmt.Errorf("unsupported RRULE BYDAY %s", day)
+				}
+				rule.byDay = append(rule.byDay, weekday)
+			}
+		case "WKST":
+		default:
+			return recurrenceRule{}, fmt.Errorf("unsupported RRULE part %s", key)
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "MONTHLY", "YEARLY":
+		if len(rule.byDay) > 0 {
+			return recurrenceRule{}, fmt.Errorf("RRULE BYDAY is only supported with FREQ=WEEKLY")
+		}
+	case "WEEKLY":
+	default:
+		return recurrenceRule{}, fmt.Errorf("unsupported RRULE FREQ %s", rule.freq)
+	}
+
+	if rule.count > 0 && !rule.until.IsZero() {
+		return recurrenceRule{}, errors.New("RRULE cannot have both COUNT and UNTIL")
+	}
+
+	return rule, nil
+}
+
+// occurrences returns the starts of the occurrences of the rule from the event start until the horizon, COUNT and
+// UNTIL limit them further. Occurrences keep the wall clock time of the start across daylight saving changes.
+func (r recurrenceRule) occurrences(start, horizon time.Time) []time.Time {
+	var occurrences []time.Time
+	for step := 0; ; step++ {
+		for _, occurrence := range r.stepOccurrences(start, step) {
+			if occurrence.Before(start) {
+				continue
+			}
+
+			if !occurrence.Before(horizon) || (!r.until.IsZero() && occurrence.After(r.until)) || (r.count > 0 && len(occurrences) == r.count) {
+				return occurrences
+			}
+
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+}
+
+// stepOccurrences returns the occurrences of the given interval step of the rule in chronological order
+func (r recurrenceRule) stepOccurrences(start time.Time, step int) []time.Time {
+	switch r.freq {
+	case "DAILY":
+		return []time.Time{start.AddDate(0, 0, step*r.interval)}
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			return []time.Time{start.AddDate(0, 0, 7*step*r.interval)}
+		}
+
+		// Weeks start on Monday, the days of the week are returned from Monday to Sunday
+		weekStart := start.AddDate(0, 0, 7*step*r.interval-(int(start.Weekday())+6)%7)
+		var occurrences []time.Time
+		for offset := 0; offset < 7; offset++ {
+			day := weekStart.AddDate(0, 0, offset)
+			if slices.Contains(r.byDay, day.Weekday()) {
+				occurrences = append(occurrences, day)
+			}
+		}
+		return occurrences
+	case "MONTHLY":
+		// Months without the day of the start, like the 31st, are skipped
+		occurrence := start.AddDate(0, step*r.interval, 0)
+		if occurrence.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{occurrence}
+	default:
+		occurrence := start.AddDate(step*r.interval, 0, 0)
+		if occurrence.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{occurrence}
+	}
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value, reporting whether it is a date of an all-day event
+func parseCalendarTime(value, params string, location *time.Location) (time.Time, bool, error) {
+	for _, param := range strings.Split(params, ";") {
+		key, paramValue, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, "TZID") {
+			tzLocation, err := time.LoadLocation(strings.Trim(paramValue, `"`))
+			if err != nil {
+				return time.Time{}, false, fmt.Errorf("unknown TZID %s", paramValue)
+			}
+			location = tzLocation
+		}
+	}
+
+	if len(value) == len(icsDateLayout) {
+		t, err := time.ParseInLocation(icsDateLayout, value, location)
+		return t, true, err
+	}
+
+	if utcValue, isUtc := strings.CutSuffix(value, "Z"); isUtc {
+		t, err := time.ParseInLocation(icsDateTimeLayout, utcValue, time.UTC)
+		return t, false, err
+	}
+
+	t, err := time.ParseInLocation(icsDateTimeLayout, value, location)
+	return t, false, err
+}
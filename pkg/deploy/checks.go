@@ -0,0 +1,193 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/github"
+)
+
+// AllChecks in RequiredChecks requires every check reported on the commit to pass
+const AllChecks = "*"
+
+// checksPollInterval is how often WaitForChecks asks for the commit checks again
+var checksPollInterval = 30 * time.Second
+
+type checksReport struct {
+	noChecks bool
+	failing  []string
+	pending  []string
+	missing  []string
+}
+
+func (r checksReport) passed() bool {
+	return !r.noChecks && len(r.failing) == 0 && len(r.pending) == 0 && len(r.missing) == 0
+}
+
+func (r checksReport) String() string {
+	if r.noChecks {
+		return "no checks were reported"
+	}
+
+	var parts []string
+	if len(r.failing) > 0 {
+		parts = append(parts, fmt.Sprintf("failing checks: %s", strings.Join(r.failing, ", ")))
+	}
+	if len(r.pending) > 0 {
+		parts = append(parts, fmt.Sprintf("pending checks: %s", strings.Join(r.pending, ", ")))
+	}
+	if len(r.missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing checks: %s", strings.Join(r.missing, ", ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// evaluateChecks compares the checks reported on a commit with the required ones. A check reported more than once,
+// for example by both a check run and a commit status, takes its worst state.
+func evaluateChecks(checks []github.CommitCheck, required []string) checksReport {
+	states := make(map[string]string)
+	for _, check := range checks {
+		if checkStateRank(check.State) > checkStateRank(states[check.Name]) {
+			states[check.Name] = check.State
+		}
+	}
+
+	names := required
+	if slices.Contains(required, AllChecks) {
+		names = slices.Sorted(maps.Keys(states))
+		if len(names) == 0 {
+			return checksReport{noChecks: true}
+		}
+	}
+
+	var report checksReport
+	for _, name := range names {
+		switch state, ok := states[name]; {
+		case !ok:
+			report.missing = append(report.missing, name)
+		case state == github.CheckStateSuccess:
+		case state == github.CheckStatePending:
+			report.pending = append(report.pending, name)
+		default:
+			report.failing = append(report.failing, name)
+		}
+	}
+
+	return report
+}
+
+func checkStateRank(state string) int {
+	switch state {
+	case "":
+		return 0
+	case github.CheckStateSuccess:
+		return 1
+	case github.CheckStatePending:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (d *githubDeployer) commitChecks(ctx context.Context, service *Service, environment *ServiceEnvironment, commit string) (checksReport, error) {
+	checks, err := d.githubClient.GetCommitChecks(ctx, service.GithubOrganization, service.GithubRepository, commit)
+	if err != nil {
+		return checksReport{}, fmt.Errorf("failed to get checks of commit %s for service %s, error: %w", commit, service.Name, err)
+	}
+
+	return evaluateChecks(checks, environment.RequiredChecks), nil
+}
+
+func (d *githubDeployer) validateChecks(ctx context.Context, service *Service, environment *ServiceEnvironment, commit string) error {
+	report, err := d.commitChecks(ctx, service, environment, commit)
+	if err != nil {
+		return err
+	}
+
+	if !report.passed() {
+		return api.NewValidationErr(fmt.Sprintf("commit %s of service %s did not pass required checks, %s", shortSha(commit), service.Name, report))
+	}
+
+	return nil
+}
+
+// WaitForChecks polls the checks of the commit while any required check is pending or not reported yet, for up to
+// the longest ChecksWaitTimeout of the environments. onPending is called with the checks still being waited for
+// before every poll. It returns without an error when the wait is over, the deployment itself reports checks that
+// did not pass.
+func (d *githubDeployer) WaitForChecks(ctx context.Context, serviceNames []string, environmentName, commit string, onPending func(pending []string)) error {
+	serviceToEnvironment, _, err := d.resolveServicesAndEnvironment(serviceNames, environmentName)
+	if err != nil {
+		return err
+	}
+
+	var timeout time.Duration
+	for _, environment := range serviceToEnvironment {
+		if len(environment.RequiredChecks) == 0 {
+			continue
+		}
+
+		waitTimeout, err := parseDurationSetting(environment.ChecksWaitTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid checksWaitTimeout of environment %s, error: %w", environment.Name, err)
+		}
+		timeout = max(timeout, waitTimeout)
+	}
+
+	if timeout == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var waitingFor []string
+		for service, environment := range serviceToEnvironment {
+			if len(environment.RequiredChecks) == 0 {
+				continue
+			}
+
+			report, err := d.commitChecks(ctx, service, environment, commit)
+			if err != nil {
+				return err
+			}
+
+			if len(report.failing) > 0 {
+				return nil
+			}
+			waitingFor = append(waitingFor, report.pending...)
+			waitingFor = append(waitingFor, report.missing...)
+			if report.noChecks {
+				waitingFor = append(waitingFor, "any check")
+			}
+		}
+
+		if len(waitingFor) == 0 || !time.Now().Before(deadline) {
+			return nil
+		}
+
+		slices.Sort(waitingFor)
+		onPending(slices.Compact(waitingFor))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(checksPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// parseDurationSetting parses an optional duration of the environment config. Durations are kept as strings in
+// ServiceEnvironment since environments are decoded from the config file without converting their values.
+func parseDurationSetting(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
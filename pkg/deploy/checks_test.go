@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/github"
+)
+
+func TestDeployBlocksOnRequiredChecks(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.RequiredChecks = []string{"build", "lint", "e2e"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/config.yaml": "image: users:{{ .Version }}\n"})
+	client.SetCommitChecks(testOrganization, testRepository, testCommit,
+		github.CommitCheck{Name: "build", State: github.CheckStateSuccess},
+		github.CommitCheck{Name: "lint", State: github.CheckStateSuccess},
+		github.CommitCheck{Name: "lint", State: github.CheckStateFailure},
+	)
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "commit 0123456 of service users did not pass required checks, failing checks: lint; missing checks: e2e")
+
+	client.SetCommitChecks(testOrganization, testRepository, testCommit,
+		github.CommitCheck{Name: "build", State: github.CheckStateSuccess},
+		github.CommitCheck{Name: "lint", State: github.CheckStateSuccess},
+		github.CommitCheck{Name: "e2e", State: github.CheckStateSuccess},
+		github.CommitCheck{Name: "coverage", State: github.CheckStatePending},
+	)
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	deployer.config.Services[0].Environments[0].RequiredChecks = []string{AllChecks}
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "pending checks: coverage")
+}
+
+func TestWaitForPendingChecks(t *testing.T) {
+	pollInterval := checksPollInterval
+	checksPollInterval = time.Millisecond
+	t.Cleanup(func() { checksPollInterval = pollInterval })
+
+	environment := testEnvironment("prod", "users")
+	environment.RequiredChecks = []string{AllChecks}
+	environment.ChecksWaitTimeout = "1m"
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.SetCommitChecks(testOrganization, testRepository, testCommit,
+		github.CommitCheck{Name: "build", State: github.CheckStatePending},
+		github.CommitCheck{Name: "lint", State: github.CheckStateSuccess},
+	)
+
+	var updates [][]string
+	err := deployer.WaitForChecks(context.Background(), []string{"users"}, "prod", testCommit, func(pending []string) {
+		updates = append(updates, pending)
+		if len(updates) == 2 {
+			client.SetCommitChecks(testOrganization, testRepository, testCommit,
+				github.CommitCheck{Name: "build", State: github.CheckStateSuccess},
+				github.CommitCheck{Name: "lint", State: github.CheckStateSuccess},
+			)
+		}
+	})
+	if err != nil {
+		t.Fatalf("wait for checks failed: %v", err)
+	}
+
+	if len(updates) != 2 || !slices.Equal(updates[0], []string{"build"}) {
+		t.Errorf("unexpected pending updates %v", updates)
+	}
+
+	deployer.config.Services[0].Environments[0].ChecksWaitTimeout = "10ms"
+	client.SetCommitChecks(testOrganization, testRepository, testCommit, github.CommitCheck{Name: "build", State: github.CheckStatePending})
+	err = deployer.WaitForChecks(context.Background(), []string{"users"}, "prod", testCommit, func([]string) {})
+	if err != nil {
+		t.Fatalf("wait for checks failed: %v", err)
+	}
+
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "pending checks: build")
+}
@@ -3,8 +3,18 @@ package deploy
 import "github.com/apono-io/argo-bot/pkg/github"
 
 type Config struct {
-	Github   github.Config
-	Services []Service
+	Github              github.Config
+	Services            []Service
+	SharedTemplatesPath string
+	// EnvironmentFreezePath is the folder of the deployment repository holding a freeze file per environment
+	EnvironmentFreezePath string
+	ManifestValidation    ManifestValidationConfig
+	SecretScanning        SecretScanningConfig
+}
+
+type ManifestValidationConfig struct {
+	Enabled  bool
+	CrdsPath string `default:""`
 }
 
 type Service struct {
@@ -13,14 +23,66 @@ type Service struct {
 	GithubRepository   string               `required:"true"`
 	Environments       []ServiceEnvironment `required:"true"`
 	Tags               []string
+	Values             map[string]any
 }
 
 type ServiceEnvironment struct {
-	Name                 string `required:"true"`
-	TemplatePath         string `required:"true"`
-	GeneratedPath        string `required:"true"`
-	AllowedBranches      []string
-	DeploymentRepoBranch string `default:""`
-	FreezeFilePath       string `default:""`
-	HelmValuesTargetFile string `default:""`
+	Name                     string `required:"true"`
+	TemplatePath             string `required:"true"`
+	GeneratedPath            string `required:"true"`
+	AllowedBranches          []string
+	DeploymentRepoBranch     string `default:""`
+	FreezeFilePath           string `default:""`
+	HelmValuesTargetFile     string `default:""`
+	HelmRender               bool
+	HelmValuesFiles          []string
+	HelmValues               map[string]any
+	HelmDeployMetadata       bool
+	KustomizeImages          []string
+	KustomizeBuild           bool
+	CopyWithoutRender        []string
+	PatchPaths               []string
+	JsonnetEntrypoint        string `default:""`
+	JsonnetLibPaths          []string
+	JsonnetOutput            string `default:""`
+	SkipManifestValidation   bool
+	Policies                 []PolicySet
+	RequiredChecks           []string
+	ChecksWaitTimeout        string `default:""`
+	RequiresPriorEnvironment string `default:""`
+	MinimumSoakTime          string `default:""`
+	Timezone                 string `default:""`
+	DeployWindows            []DeployWindow
+	Blackouts                []Blackout
+	BlackoutCalendar         string `default:""`
+	Values                   map[string]any
+}
+
+type SecretScanningConfig struct {
+	Disabled     bool
+	Rules        []SecretRule
+	Allowlist    []string
+	AllowedPaths []string
+}
+
+type SecretRule struct {
+	Name    string `required:"true"`
+	Pattern string `required:"true"`
+}
+
+type PolicySet struct {
+	Path        string `required:"true"`
+	Enforcement string `default:"block"`
+}
+
+type DeployWindow struct {
+	Days  string `required:"true"`
+	Start string `default:""`
+	End   string `default:""`
+}
+
+type Blackout struct {
+	Name  string `default:""`
+	Start string `required:"true"`
+	End   string `required:"true"`
 }
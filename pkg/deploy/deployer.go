@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/apono-io/argo-bot/pkg/api"
 	"github.com/apono-io/argo-bot/pkg/github"
@@ -26,40 +29,90 @@ const (
 	FreezeActionUnfreeze FreezeAction = "unfreeze"
 )
 
+// AllServices freezes the environment itself, blocking every service deployed to it
+const AllServices = "*"
+
 const freezeFileName = ".freeze"
+const defaultEnvironmentFreezePath = "freeze"
 const defaultHelmValuesFileName = "argo-bot-values.yaml"
+const renderedManifestsFileName = "manifests.yaml"
+const yamlIndent = 2
+
+// maxConcurrentStatusLookups bounds the deployment history lookups running at once while listing statuses
+const maxConcurrentStatusLookups = 8
+
+type ServiceVersion struct {
+	Commit    string
+	CommitUrl string
+}
 
 type EnvironmentStatus struct {
 	EnvironmentName string
 	IsFrozen        bool
+	// EnvironmentFrozen is set when the whole environment is frozen, Freeze then describes the environment freeze
+	EnvironmentFrozen bool
+	Freeze            *FreezeInfo
+	DeployedCommit    string
+	DeployedCommitUrl string
+	DeployedBy        string
+	DeployedAt        time.Time
+	// DeployBlockedReason explains why the deploy windows or blackouts of the environment do not allow deploying now
+	DeployBlockedReason string
+	NextDeployWindow    time.Time
 }
 
 type Deployer interface {
 	GetCommitSha(ctx context.Context, serviceName []string, commit string) (string, string, error)
 	Deploy(serviceNames []string, environment, commit, commitUrl, userFullname, userEmail string) (*github.PullRequest, string, error)
-	Freeze(serviceNames []string, environment, userFullname, userEmail string, action FreezeAction) (*github.PullRequest, string, error)
+	EmergencyDeploy(serviceNames []string, environment, commit, commitUrl, userFullname, userEmail, justification string) (*github.PullRequest, string, error)
+	Plan(serviceNames []string, environment, commit, commitUrl string) (string, error)
+	WaitForChecks(ctx context.Context, serviceNames []string, environment, commit string, onPending func(pending []string)) error
+	Rollback(serviceNames []string, environment, userFullname, userEmail string) (*github.PullRequest, string, map[ServiceName]ServiceVersion, error)
+	Promote(serviceNames []string, sourceEnvironment, targetEnvironment, userFullname, userEmail string) (*github.PullRequest, string, map[ServiceName]ServiceVersion, error)
+	History(serviceName, environment string, page int) ([]HistoryEntry, bool, error)
+	Freeze(serviceNames []string, environment, userFullname, userEmail string, action FreezeAction, details FreezeDetails) (*github.PullRequest, string, error)
+	FreezeEnvironment(environment, userFullname, userEmail string, action FreezeAction, details FreezeDetails) (*github.PullRequest, string, error)
+	UnfreezeExpired(ctx context.Context) ([]ExpiredFreeze, error)
 	Approve(ctx context.Context, pullRequestId int) error
+	ValidateEmergencyApprover(ctx context.Context, pullRequestId int, approverEmail string) error
+	ApproveEmergency(ctx context.Context, pullRequestId int, approverFullname, approverEmail string) error
 	Cancel(ctx context.Context, pullRequestId int) error
 	ResolveTags(names []string) []string
 	ListServices() []Service
 	ListServiceEnvironmentsStatus(serviceNames []string) (map[ServiceName][]EnvironmentStatus, error)
 }
 
-func New(config Config) (Deployer, error) {
-	client, err := github.NewClient(context.Background(), config.Github)
+// New creates a deployer, emergency deployments are disabled when emergencyApprovers is nil
+func New(config Config, emergencyApprovers EmergencyApprovers) (Deployer, error) {
+	client, err := newClient(context.Background(), config.Github)
 	if err != nil {
 		return nil, err
 	}
 
 	return &githubDeployer{
-		config:       config,
-		githubClient: client,
+		config:             config,
+		githubClient:       client,
+		emergencyApprovers: emergencyApprovers,
 	}, nil
 }
 
+func newClient(ctx context.Context, config github.Config) (github.Client, error) {
+	switch config.Backend {
+	case github.BackendGithub, "":
+		return github.NewClient(ctx, config)
+	case github.BackendGit:
+		return github.NewGitClient(ctx, config)
+	case github.BackendGitlab:
+		return github.NewGitlabClient(ctx, config)
+	default:
+		return nil, fmt.Errorf("unknown deployment repository backend %s", config.Backend)
+	}
+}
+
 type githubDeployer struct {
-	config       Config
-	githubClient github.Client
+	config             Config
+	githubClient       github.Client
+	emergencyApprovers EmergencyApprovers
 }
 
 func (d *githubDeployer) ResolveTags(names []string) []string {
@@ -94,7 +147,16 @@ func (d *githubDeployer) GetCommitSha(ctx context.Context, servicesNames []strin
 }
 
 func (d *githubDeployer) Approve(ctx context.Context, pullRequestId int) error {
-	return d.githubClient.MergePR(ctx, pullRequestId)
+	pr, err := d.githubClient.GetPR(ctx, pullRequestId)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request %d, error: %w", pullRequestId, err)
+	}
+
+	if isEmergencyTitle(pr.Title) {
+		return api.NewValidationErr("emergency deployments must be approved by an emergency approver")
+	}
+
+	return d.githubClient.MergePR(ctx, pullRequestId, "")
 }
 
 func (d *githubDeployer) Cancel(ctx context.Context, pullRequestId int) error {
@@ -102,11 +164,100 @@ func (d *githubDeployer) Cancel(ctx context.Context, pullRequestId int) error {
 }
 
 func (d *githubDeployer) Deploy(serviceNames []string, environmentName, commit, commitUrl, userFullname, userEmail string) (*github.PullRequest, string, error) {
+	return d.deployCommit(serviceNames, environmentName, commit, commitUrl, userFullname, userEmail, "")
+}
+
+// deployCommit deploys the commit to all services, an emergency justification lets the deployment through freezes.
+func (d *githubDeployer) deployCommit(serviceNames []string, environmentName, commit, commitUrl, userFullname, userEmail, emergencyJustification string) (*github.PullRequest, string, error) {
+	services, err := d.LookupServices(serviceNames)
+	if err != nil {
+		return nil, "", err
+	}
+
+	versions := make(map[ServiceName]ServiceVersion)
+	for _, service := range services {
+		versions[ServiceName(service.Name)] = ServiceVersion{Commit: commit, CommitUrl: commitUrl}
+	}
+
+	serviceToEnvironment, _, err := d.resolveServicesAndEnvironment(serviceNames, environmentName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = d.validatePromotionPath(context.Background(), serviceToEnvironment, versions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return d.deployVersions(serviceNames, environmentName, versions, userFullname, userEmail, emergencyJustification)
+}
+
+func (d *githubDeployer) Rollback(serviceNames []string, environmentName, userFullname, userEmail string) (*github.PullRequest, string, map[ServiceName]ServiceVersion, error) {
+	ctx := context.Background()
+	serviceToEnvironment, _, err := d.resolveServicesAndEnvironment(serviceNames, environmentName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	versions := make(map[ServiceName]ServiceVersion)
+	for service, environment := range serviceToEnvironment {
+		version, err := d.findPreviousVersion(ctx, service, environment)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		versions[ServiceName(service.Name)] = version
+	}
+
+	pr, diff, err := d.deployVersions(serviceNames, environmentName, versions, userFullname, userEmail, "")
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return pr, diff, versions, nil
+}
+
+func (d *githubDeployer) Promote(serviceNames []string, sourceEnvironmentName, targetEnvironmentName, userFullname, userEmail string) (*github.PullRequest, string, map[ServiceName]ServiceVersion, error) {
 	ctx := context.Background()
+	serviceToEnvironment, _, err := d.resolveServicesAndEnvironment(serviceNames, sourceEnvironmentName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	versions := make(map[ServiceName]ServiceVersion)
+	for service, environment := range serviceToEnvironment {
+		version, err := d.findCurrentVersion(ctx, service, environment)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		versions[ServiceName(service.Name)] = version
+	}
+
+	targetServiceToEnvironment, _, err := d.resolveServicesAndEnvironment(serviceNames, targetEnvironmentName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	err = d.validatePromotionPath(ctx, targetServiceToEnvironment, versions)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	pr, diff, err := d.deployVersions(serviceNames, targetEnvironmentName, versions, userFullname, userEmail, "")
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return pr, diff, versions, nil
+}
+
+func (d *githubDeployer) deployVersions(serviceNames []string, environmentName string, versions map[ServiceName]ServiceVersion, userFullname, userEmail,
+	emergencyJustification string) (*github.PullRequest, string, error) {
+	ctx := context.Background()
+	environmentName = d.configuredEnvironmentName(environmentName)
 	logWithCtx := log.WithFields(log.Fields{
 		"environment":  environmentName,
 		"serviceNames": serviceNames,
-		"commit":       commit,
+		"versions":     versions,
 	})
 
 	serviceToEnvironment, deploymentBranch, err := d.resolveServicesAndEnvironment(serviceNames, environmentName)
@@ -128,43 +279,232 @@ func (d *githubDeployer) Deploy(serviceNames []string, environmentName, commit,
 		}
 	}()
 
+	metadata := deployMetadata{
+		DeployedAt:             time.Now().UTC(),
+		RequestedBy:            userFullname,
+		RequestedByEmail:       userEmail,
+		EmergencyJustification: emergencyJustification,
+	}
+	uniqueFiles, warnings, err := d.prepareDeployment(ctx, baseFolder, deploymentBranch, serviceToEnvironment, environmentName, versions, metadata, logWithCtx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prTitle := formatDeployTitle(servicesString, environmentName, versions, userFullname, userEmail)
+	if emergencyJustification != "" {
+		prTitle = emergencyTitlePrefix + prTitle
+	}
+
+	tree, err := d.githubClient.CreateTree(ctx, ref, baseFolder, uniqueFiles)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create diff tree for services, error: %w", err)
+	}
+
+	commitMsg := prTitle
+	if emergencyJustification != "" {
+		commitMsg += "\n\n" + formatEmergencyNotice(emergencyJustification, userFullname, userEmail)
+	}
+	if err = d.githubClient.PushCommit(ctx, ref, tree, userFullname, userEmail, commitMsg); err != nil {
+		return nil, "", fmt.Errorf("failed to create commit for services, error: %w", err)
+	}
+
+	prDescription := fmt.Sprintf("Service Names: %s\nEnvironment: %s\n%s\nRequested by: %s (%s)",
+		servicesString, environmentName, formatDeployCommits(versions), userFullname, userEmail)
+	if len(warnings) > 0 {
+		prDescription += fmt.Sprintf("\n\nPolicy warnings:\n- %s", strings.Join(warnings, "\n- "))
+	}
+	if emergencyJustification != "" {
+		prDescription = formatEmergencyNotice(emergencyJustification, userFullname, userEmail) + "\n\n" + prDescription
+	}
+
+	pr, diff, err := d.githubClient.CreatePR(ctx, prTitle, prDescription, deploymentBranch, branch)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create pull request, error: %w", err)
+	}
+	pr.Warnings = warnings
+
+	logWithCtx.Infof("Created pull request for deployment")
+
+	// The pull request number is only known once it is opened, render again and push the templates that use it
+	rerender, err := d.referencesPullRequest(baseFolder, serviceToEnvironment)
+	if err != nil {
+		return nil, "", err
+	}
+
+	changed := false
+	if rerender {
+		metadata.PullRequest = pr.Id
+		changed, err = d.rerenderServices(ctx, baseFolder, serviceToEnvironment, environmentName, versions, metadata, uniqueFiles, ref, commitMsg, logWithCtx)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if changed {
+		diff, err = d.githubClient.PullRequestDiff(ctx, pr.Id)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get pull request diff, error: %w", err)
+		}
+	}
+
+	return pr, diff, nil
+}
+
+// rerenderServices renders the templates again with the updated metadata and commits the files that changed,
+// reporting whether a commit was pushed.
+func (d *githubDeployer) rerenderServices(ctx context.Context, baseFolder string, serviceToEnvironment map[*Service]*ServiceEnvironment, environmentName string,
+	versions map[ServiceName]ServiceVersion, metadata deployMetadata, renderedFiles []string, ref *gh.Reference, commitMsg string, logWithCtx *log.Entry) (bool, error) {
+	// A missing entry means the file was deleted by the first render
+	previous := make(map[string]string, len(renderedFiles))
+	for _, file := range renderedFiles {
+		content, exists, err := readOptionalFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			previous[file] = content
+		}
+	}
+
+	files, err := d.renderServices(ctx, baseFolder, serviceToEnvironment, environmentName, versions, metadata, logWithCtx)
+	if err != nil {
+		return false, err
+	}
+
+	var changedFiles []string
+	for _, file := range files {
+		content, exists, err := readOptionalFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			return false, err
+		}
+
+		before, existed := previous[file]
+		if exists != existed || before != content {
+			changedFiles = append(changedFiles, file)
+		}
+	}
+
+	if len(changedFiles) == 0 {
+		return false, nil
+	}
+
+	tree, err := d.githubClient.CreateTree(ctx, ref, baseFolder, changedFiles)
+	if err != nil {
+		return false, fmt.Errorf("failed to create diff tree for services, error: %w", err)
+	}
+
+	if err = d.githubClient.PushCommit(ctx, ref, tree, metadata.RequestedBy, metadata.RequestedByEmail, commitMsg); err != nil {
+		return false, fmt.Errorf("failed to create commit for services, error: %w", err)
+	}
+
+	logWithCtx.Infof("Updated pull request with %d files referencing it", len(changedFiles))
+	return true, nil
+}
+
+// prepareDeployment validates the deployment against the cloned repository and renders the templates of all services,
+// returning the files that should be committed and the warnings of non-blocking policies.
+func (d *githubDeployer) prepareDeployment(ctx context.Context, baseFolder, deploymentBranch string, serviceToEnvironment map[*Service]*ServiceEnvironment, environmentName string,
+	versions map[ServiceName]ServiceVersion, metadata deployMetadata, logWithCtx *log.Entry) ([]string, []string, error) {
+	environmentFreeze, err := d.readFreeze(ctx, baseFolder, deploymentBranch, d.getEnvironmentFreezeFilePath(environmentName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check if environment %s is frozen, error: %w", environmentName, err)
+	}
+	emergency := metadata.EmergencyJustification != ""
+	if environmentFreeze != nil && emergency {
+		logWithCtx.Warnf("Emergency deployment bypasses the freeze of environment %s", environmentName)
+	} else if environmentFreeze != nil {
+		if details := formatFreezeDetails(environmentFreeze); details != "" {
+			return nil, nil, api.NewValidationErr(fmt.Sprintf("cannot deploy: environment %s is frozen (%s)", environmentName, details))
+		}
+		return nil, nil, api.NewValidationErr(fmt.Sprintf("cannot deploy: environment %s is frozen", environmentName))
+	}
+
 	var frozenServices []string
 	for service, environment := range serviceToEnvironment {
 		if len(environment.AllowedBranches) > 0 {
 			logWithCtx.Infof("Validating branch")
+			commit := versions[ServiceName(service.Name)].Commit
 			validBranch, err := d.validateBranch(ctx, service.GithubOrganization, service.GithubRepository, commit, environment.AllowedBranches)
 			if err != nil {
-				return nil, "", err
+				return nil, nil, err
 			}
 
 			if !validBranch {
-				return nil, "", api.NewValidationErr(fmt.Sprintf("commit is not in allowed branches for service %s", service.Name))
+				return nil, nil, api.NewValidationErr(fmt.Sprintf("commit is not in allowed branches for service %s", service.Name))
 			}
 		}
 
-		freezeFilePath := getFreezeFilePath(*environment)
-		frozen, err := d.checkIfServiceFrozen(baseFolder, freezeFilePath)
+		if len(environment.RequiredChecks) > 0 {
+			logWithCtx.Infof("Validating commit checks")
+			err := d.validateChecks(ctx, service, environment, versions[ServiceName(service.Name)].Commit)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		freezeInfo, err := d.readFreeze(ctx, baseFolder, deploymentBranch, getFreezeFilePath(*environment))
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to check if service %s is frozen, error: %w", service.Name, err)
+			return nil, nil, fmt.Errorf("failed to check if service %s is frozen, error: %w", service.Name, err)
+		}
+		if freezeInfo != nil && emergency {
+			logWithCtx.Warnf("Emergency deployment bypasses the freeze of service %s", service.Name)
+		} else if freezeInfo != nil {
+			if details := formatFreezeDetails(freezeInfo); details != "" {
+				frozenServices = append(frozenServices, fmt.Sprintf("%s (%s)", service.Name, details))
+			} else {
+				frozenServices = append(frozenServices, service.Name)
+			}
 		}
-		if frozen {
-			frozenServices = append(frozenServices, service.Name)
+
+		err = validateDeploySchedule(baseFolder, service, environment)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
 	if len(frozenServices) > 0 {
-		return nil, "", api.NewValidationErr(fmt.Sprintf("cannot deploy: services are frozen: %s", strings.Join(frozenServices, ", ")))
+		return nil, nil, api.NewValidationErr(fmt.Sprintf("cannot deploy: services are frozen: %s", strings.Join(frozenServices, ", ")))
 	}
 
 	logWithCtx.Infof("Starting deployment")
-	prTitle := fmt.Sprintf("Deploy %s to %s with version %s triggered by %s (%s)", servicesString, environmentName, commit[:7], userFullname, userEmail)
 
+	files, err := d.renderServices(ctx, baseFolder, serviceToEnvironment, environmentName, versions, metadata, logWithCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = d.scanSecrets(baseFolder, files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = d.validateManifests(baseFolder, serviceToEnvironment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings, err := d.evaluatePolicies(ctx, baseFolder, serviceToEnvironment, versions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, warnings, nil
+}
+
+// renderServices renders the templates of all services and returns the files that should be committed.
+func (d *githubDeployer) renderServices(ctx context.Context, baseFolder string, serviceToEnvironment map[*Service]*ServiceEnvironment, environmentName string,
+	versions map[ServiceName]ServiceVersion, metadata deployMetadata, logWithCtx *log.Entry) ([]string, error) {
 	// Process all services to collect their files
 	allServiceFiles := make(map[string][]string) // service -> files
 	for service, environment := range serviceToEnvironment {
-		files, err := d.renderTemplates(baseFolder, environment.TemplatePath, environment.GeneratedPath, service.Name, environmentName, commit, environment, logWithCtx)
+		opts, err := d.templateOptions(ctx, service, environment, environmentName, versions[ServiceName(service.Name)], metadata)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to render templates for service %s, error: %w", service.Name, err)
+			return nil, err
+		}
+
+		files, err := d.renderTemplates(baseFolder, environment, opts, logWithCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render templates for service %s, error: %w", service.Name, err)
 		}
 		allServiceFiles[service.Name] = files
 	}
@@ -174,7 +514,7 @@ func (d *githubDeployer) Deploy(serviceNames []string, environmentName, commit,
 	for serviceName, files := range allServiceFiles {
 		for _, file := range files {
 			if existingOwner, exists := fileOwners[file]; exists {
-				return nil, "", fmt.Errorf("file conflict: both service '%s' and service '%s' are trying to modify file '%s'", existingOwner, serviceName, file)
+				return nil, fmt.Errorf("file conflict: both service '%s' and service '%s' are trying to modify file '%s'", existingOwner, serviceName, file)
 			}
 			fileOwners[file] = serviceName
 		}
@@ -185,46 +525,85 @@ func (d *githubDeployer) Deploy(serviceNames []string, environmentName, commit,
 		uniqueFiles = append(uniqueFiles, file)
 	}
 
-	tree, err := d.githubClient.CreateTree(ctx, ref, baseFolder, uniqueFiles)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to create diff tree for services, error: %w", err)
-	}
+	return uniqueFiles, nil
+}
 
-	commitMsg := fmt.Sprintf("Deploy %s to %s with version %s triggered by %s (%s)", servicesString, environmentName, commit[:7], userFullname, userEmail)
-	if err = d.githubClient.PushCommit(ctx, ref, tree, userFullname, userEmail, commitMsg); err != nil {
-		return nil, "", fmt.Errorf("failed to create commit for services, error: %w", err)
-	}
+func (d *githubDeployer) Freeze(serviceNames []string, environment, userFullname, userEmail string, action FreezeAction, details FreezeDetails) (*github.PullRequest, string, error) {
+	environment = d.configuredEnvironmentName(environment)
+	logWithCtx := log.WithFields(log.Fields{
+		"environment":  environment,
+		"serviceNames": serviceNames,
+		"action":       action,
+	})
 
-	prDescription := fmt.Sprintf("Service Names: %s\nEnvironment: %s\nCommit: [%s](%s)\nRequested by: %s (%s)",
-		servicesString, environmentName, commit[:7], commitUrl, userFullname, userEmail)
-	pr, diff, err := d.githubClient.CreatePR(ctx, prTitle, prDescription, deploymentBranch, branch)
+	serviceToEnvironment, deploymentBranch, err := d.resolveServicesAndEnvironment(serviceNames, environment)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create pull request, error: %w", err)
+		return nil, "", err
 	}
 
-	logWithCtx.Infof("Created pull request for deployment")
+	freezeFilePaths := make(map[string]string)
+	for service, environment := range serviceToEnvironment {
+		freezeFilePaths["service "+service.Name] = getFreezeFilePath(*environment)
+	}
 
-	return pr, diff, nil
+	servicesString := strings.Join(serviceNames, ",")
+	branch := fmt.Sprintf("%s-%s-%s", action, servicesString, environment)
+	return d.changeFreezeFiles(servicesString, environment, branch, deploymentBranch, freezeFilePaths, userFullname, userEmail, action, details, logWithCtx)
 }
 
-func (d *githubDeployer) Freeze(serviceNames []string, environment, userFullname, userEmail string, action FreezeAction) (*github.PullRequest, string, error) {
-	ctx := context.Background()
+// FreezeEnvironment freezes or unfreezes every service of the environment with a single freeze file, so services
+// added to the environment later are frozen as well.
+func (d *githubDeployer) FreezeEnvironment(environment, userFullname, userEmail string, action FreezeAction, details FreezeDetails) (*github.PullRequest, string, error) {
+	environment = d.configuredEnvironmentName(environment)
 	logWithCtx := log.WithFields(log.Fields{
 		"environment":  environment,
-		"serviceNames": serviceNames,
+		"serviceNames": AllServices,
 		"action":       action,
 	})
 
-	serviceToEnvironment, deploymentBranch, err := d.resolveServicesAndEnvironment(serviceNames, environment)
+	deploymentBranch, err := d.environmentDeploymentBranch(environment)
 	if err != nil {
 		return nil, "", err
 	}
 
-	servicesString := strings.Join(serviceNames, ",")
+	freezeFilePaths := map[string]string{
+		"environment " + environment: d.getEnvironmentFreezeFilePath(environment),
+	}
+
+	branch := fmt.Sprintf("%s-environment-%s", action, environment)
+	return d.changeFreezeFiles(AllServices, environment, branch, deploymentBranch, freezeFilePaths, userFullname, userEmail, action, details, logWithCtx)
+}
+
+// environmentDeploymentBranch returns the deployment branch shared by all services of the environment, which holds
+// its environment freeze file.
+func (d *githubDeployer) environmentDeploymentBranch(environmentName string) (string, error) {
+	var environments []*ServiceEnvironment
+	for i := range d.config.Services {
+		for j := range d.config.Services[i].Environments {
+			if strings.EqualFold(d.config.Services[i].Environments[j].Name, environmentName) {
+				environments = append(environments, &d.config.Services[i].Environments[j])
+			}
+		}
+	}
+
+	if len(environments) == 0 {
+		return "", api.NewValidationErr(fmt.Sprintf("environment %s does not exist", environmentName))
+	}
 
+	if !areEnvironmentsFromSameBranch(environments) {
+		return "", api.NewValidationErr(fmt.Sprintf("services of environment %s have different deployment branches", environmentName))
+	}
+
+	return environments[0].DeploymentRepoBranch, nil
+}
+
+// changeFreezeFiles creates or removes the freeze files in the given folders, keyed by what they freeze, and opens a
+// pull request with the change. It returns no pull request when all of them are already in the desired state.
+func (d *githubDeployer) changeFreezeFiles(target, environment, branch, deploymentBranch string, freezeFilePaths map[string]string,
+	userFullname, userEmail string, action FreezeAction, details FreezeDetails, logWithCtx *log.Entry) (*github.PullRequest, string, error) {
+	ctx := context.Background()
 	logWithCtx.Infof("Starting %s operation", action)
-	branch := fmt.Sprintf("%s-%s-%s", action, servicesString, environment)
-	prTitle := fmt.Sprintf("%s %s to %s triggered by %s (%s)", action, servicesString, environment, userFullname, userEmail)
+	prTitle := fmt.Sprintf("%s %s to %s triggered by %s (%s)", action, target, environment, userFullname, userEmail)
 
 	baseFolder, ref, err := d.cloneBranch(ctx, branch, deploymentBranch)
 	if err != nil {
@@ -239,27 +618,26 @@ func (d *githubDeployer) Freeze(serviceNames []string, environment, userFullname
 
 	changesDetected := false
 	freezeFiles := make(map[string]struct{})
+	freezeInfo := newFreezeInfo(userFullname, userEmail, details)
 
-	for service, environment := range serviceToEnvironment {
-		freezeFilePath := getFreezeFilePath(*environment)
-
+	for frozenName, freezeFilePath := range freezeFilePaths {
 		var freezeFile string
 		if action == FreezeActionUnfreeze {
 			frozen, err := d.checkIfServiceFrozen(baseFolder, freezeFilePath)
 			if err != nil {
-				return nil, "", fmt.Errorf("failed to check if service %s is frozen, error: %w", service.Name, err)
+				return nil, "", fmt.Errorf("failed to check if %s is frozen, error: %w", frozenName, err)
 			}
 			if !frozen {
 				continue
 			}
 			freezeFile, err = d.removeFreezeFile(baseFolder, freezeFilePath)
 			if err != nil {
-				return nil, "", fmt.Errorf("failed to remove freeze file for service %s, error: %w", service.Name, err)
+				return nil, "", fmt.Errorf("failed to remove freeze file for %s, error: %w", frozenName, err)
 			}
 		} else {
-			freezeFile, err = d.createFreezeFile(baseFolder, freezeFilePath)
+			freezeFile, err = d.createFreezeFile(baseFolder, freezeFilePath, freezeInfo)
 			if err != nil {
-				return nil, "", fmt.Errorf("failed to create freeze file for service %s, error: %w", service.Name, err)
+				return nil, "", fmt.Errorf("failed to create freeze file for %s, error: %w", frozenName, err)
 			}
 		}
 
@@ -278,7 +656,7 @@ func (d *githubDeployer) Freeze(serviceNames []string, environment, userFullname
 			return nil, "", fmt.Errorf("failed to create diff tree for %s operation, error: %w", action, err)
 		}
 
-		commitMsg := fmt.Sprintf("%s %s on %s triggered by %s (%s)", action, servicesString, environment, userFullname, userEmail)
+		commitMsg := fmt.Sprintf("%s %s on %s triggered by %s (%s)", action, target, environment, userFullname, userEmail)
 		if err = d.githubClient.PushCommit(ctx, ref, tree, userFullname, userEmail, commitMsg); err != nil {
 			return nil, "", fmt.Errorf("failed to create commit for %s operation, error: %w", action, err)
 		}
@@ -289,8 +667,19 @@ func (d *githubDeployer) Freeze(serviceNames []string, environment, userFullname
 		return nil, "", nil
 	}
 
+	servicesString := target
+	if target == AllServices {
+		servicesString = "all services"
+	}
+
 	prDescription := fmt.Sprintf("Service Names: %s\nEnvironment: %s\nRequested by: %s (%s)",
 		servicesString, environment, userFullname, userEmail)
+	if action == FreezeActionFreeze && freezeInfo.Reason != "" {
+		prDescription += fmt.Sprintf("\nReason: %s", freezeInfo.Reason)
+	}
+	if action == FreezeActionFreeze && freezeInfo.Duration > 0 {
+		prDescription += fmt.Sprintf("\nExpires: %s after merge", freezeInfo.Duration)
+	}
 	pr, diff, err := d.githubClient.CreatePR(ctx, prTitle, prDescription, deploymentBranch, branch)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to create pull request, error: %w", err)
@@ -357,33 +746,46 @@ func (d *githubDeployer) checkIfServiceFrozen(baseFolder, freezeFilePath string)
 	return true, nil
 }
 
-func (d *githubDeployer) renderTemplates(baseFolder, templatePath, generatedPath, serviceName, environment, commit string, env *ServiceEnvironment, log *log.Entry) ([]string, error) {
+func (d *githubDeployer) renderTemplates(baseFolder string, env *ServiceEnvironment, opts options, log *log.Entry) ([]string, error) {
+	serviceName := opts.ServiceName
+
+	if len(env.PatchPaths) > 0 {
+		log.Infof("Patching %s for service %s", env.GeneratedPath, serviceName)
+		return d.patchFile(baseFolder, env, opts)
+	}
+
 	// Get existing files before cleaning
-	existingFiles := d.findExistingFiles(baseFolder, generatedPath)
-	log.Infof("Found %d existing files in %s", len(existingFiles), generatedPath)
+	existingFiles := d.findExistingFiles(baseFolder, env.GeneratedPath)
+	log.Infof("Found %d existing files in %s", len(existingFiles), env.GeneratedPath)
 	for _, f := range existingFiles {
 		log.Debugf("Existing file: %s", f)
 	}
 
-	generatedFolder := filepath.Join(baseFolder, generatedPath)
+	generatedFolder := filepath.Join(baseFolder, env.GeneratedPath)
 	err := d.cleanFolder(generatedFolder)
 	if err != nil {
 		return nil, err
 	}
 
-	templateFolder := filepath.Join(baseFolder, templatePath)
+	templateFolder := filepath.Join(baseFolder, env.TemplatePath)
 
 	var newFiles []string
 	if d.isHelmChart(templateFolder) {
 		log.Infof("Processing Helm chart templates for service %s", serviceName)
-		newFiles, err = d.processHelmChart(baseFolder, templateFolder, generatedFolder, serviceName, environment, commit, env)
+		newFiles, err = d.processHelmChart(baseFolder, templateFolder, generatedFolder, env, opts)
 		// log the files generated by Helm chart processing
 		for _, file := range newFiles {
 			log.Infof("Generated Helm file: %s", file)
 		}
+	} else if d.isKustomization(templateFolder) {
+		log.Infof("Processing kustomization for service %s", serviceName)
+		newFiles, err = d.processKustomization(baseFolder, templateFolder, generatedFolder, env, opts)
+	} else if d.isJsonnet(templateFolder, env) {
+		log.Infof("Processing jsonnet for service %s", serviceName)
+		newFiles, err = d.processJsonnet(baseFolder, templateFolder, generatedFolder, env, opts)
 	} else {
 		log.Infof("Processing Go templates for service %s", serviceName)
-		newFiles, err = d.processGoTemplates(baseFolder, templateFolder, generatedFolder, serviceName, environment, commit)
+		newFiles, err = d.processGoTemplates(baseFolder, templateFolder, generatedFolder, env, opts)
 	}
 
 	if err != nil {
@@ -418,13 +820,17 @@ func (d *githubDeployer) isHelmChart(templateFolder string) bool {
 	return err == nil
 }
 
-func (d *githubDeployer) processHelmChart(baseFolder, templateFolder, generatedFolder, serviceName, environment, commit string, env *ServiceEnvironment) ([]string, error) {
+func (d *githubDeployer) processHelmChart(baseFolder, templateFolder, generatedFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	if env.HelmRender {
+		return d.renderHelmChart(baseFolder, templateFolder, generatedFolder, env, opts)
+	}
+
 	copiedFiles, err := d.copyDirectory(baseFolder, templateFolder, generatedFolder)
 	if err != nil {
 		return nil, err
 	}
 
-	valuesFile, err := d.createArgoBotValuesFile(baseFolder, generatedFolder, serviceName, environment, commit, env)
+	valuesFile, err := d.createArgoBotValuesFile(baseFolder, generatedFolder, env, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -447,37 +853,86 @@ func (d *githubDeployer) processHelmChart(baseFolder, templateFolder, generatedF
 	return copiedFiles, nil
 }
 
-func (d *githubDeployer) processGoTemplates(baseFolder, templateFolder, generatedFolder, serviceName, environment, commit string) ([]string, error) {
-	templateFiles, err := os.ReadDir(templateFolder)
+func (d *githubDeployer) processGoTemplates(baseFolder, templateFolder, generatedFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	tmpl := template.New("gotpl")
+	tmpl.Funcs(templateFuncs(tmpl))
+	tmpl.Option("missingkey=error")
+
+	err := d.parseSharedTemplates(baseFolder, tmpl)
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl := template.New("gotpl")
-	tmpl.Option("missingkey=error")
+	// Template names are the slash separated paths relative to the template folder
+	var templateFiles, copiedFiles []string
+	err = filepath.WalkDir(templateFolder, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
 
-	var renderedFiles []string
-	opts := options{
-		ServiceName: serviceName,
-		Environment: environment,
-		Version:     commit,
+		relPath, err := filepath.Rel(templateFolder, filePath)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(relPath)
+		if matchesGlob(env.CopyWithoutRender, name) {
+			copiedFiles = append(copiedFiles, name)
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		_, err = tmpl.New(name).Parse(string(content))
+		if err != nil {
+			return err
+		}
+
+		templateFiles = append(templateFiles, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	for _, file := range templateFiles {
-		_, err = tmpl.New(file.Name()).ParseFiles(filepath.Join(templateFolder, file.Name()))
+
+	var renderedFiles []string
+	outputNames := make(map[string]string)
+	for _, name := range append(templateFiles, copiedFiles...) {
+		outputName, err := renderFileName(name, opts)
 		if err != nil {
 			return nil, err
 		}
-	}
 
-	for _, file := range templateFiles {
-		absolutePath := filepath.Join(generatedFolder, file.Name())
+		// A file name rendering to an empty string is skipped, which allows conditional files
+		if outputName == "" {
+			continue
+		}
+
+		if existing, ok := outputNames[outputName]; ok {
+			return nil, fmt.Errorf("templates %s and %s both render to file %s", existing, name, outputName)
+		}
+		outputNames[outputName] = name
+
+		absolutePath := filepath.Join(generatedFolder, filepath.FromSlash(outputName))
 		relPath, err := filepath.Rel(baseFolder, absolutePath)
 		if err != nil {
 			return nil, err
 		}
 
+		err = os.MkdirAll(filepath.Dir(absolutePath), 0755)
+		if err != nil {
+			return nil, err
+		}
+
 		renderedFiles = append(renderedFiles, relPath)
-		err = d.renderTemplateFile(absolutePath, tmpl, file.Name(), opts)
+		if slices.Contains(copiedFiles, name) {
+			err = d.copyFile(filepath.Join(templateFolder, filepath.FromSlash(name)), absolutePath)
+		} else {
+			err = d.renderTemplateFile(absolutePath, tmpl, name, opts)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -486,6 +941,90 @@ func (d *githubDeployer) processGoTemplates(baseFolder, templateFolder, generate
 	return renderedFiles, nil
 }
 
+// renderFileName renders a template file path, each path segment may hold template actions such as
+// {{ .ServiceName }}-deployment.yaml. The result must stay inside the generated folder.
+func renderFileName(name string, opts options) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+
+	tmpl := template.New(name)
+	tmpl.Funcs(templateFuncs(tmpl))
+	tmpl.Option("missingkey=error")
+	_, err := tmpl.Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse file name %s, error: %w", name, err)
+	}
+
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to render file name %s, error: %w", name, err)
+	}
+
+	rendered := strings.TrimSpace(sb.String())
+	if rendered == "" || strings.HasSuffix(rendered, "/") {
+		return "", nil
+	}
+
+	cleaned := path.Clean(rendered)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("file name %s renders to %s which is outside the generated folder", name, rendered)
+	}
+
+	return cleaned, nil
+}
+
+// matchesGlob reports whether one of the patterns matches the slash separated path or its base name
+func matchesGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+
+		if matched, _ := path.Match(pattern, path.Base(name)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSharedTemplates adds the partials of the shared templates folder to the template set. They can be used by
+// every service with {{ template "name" . }} but are not rendered as files of their own.
+func (d *githubDeployer) parseSharedTemplates(baseFolder string, tmpl *template.Template) error {
+	if d.config.SharedTemplatesPath == "" {
+		return nil
+	}
+
+	sharedFolder := filepath.Join(baseFolder, d.config.SharedTemplatesPath)
+	sharedFiles, err := os.ReadDir(sharedFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read shared templates, error: %w", err)
+	}
+
+	for _, file := range sharedFiles {
+		if file.IsDir() {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(sharedFolder, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		_, err = tmpl.New(path.Join(d.config.SharedTemplatesPath, file.Name())).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse shared template %s, error: %w", file.Name(), err)
+		}
+	}
+
+	return nil
+}
+
 func (d *githubDeployer) copyDirectory(baseFolder, sourceFolder, destFolder string) ([]string, error) {
 	var copiedFiles []string
 
@@ -538,7 +1077,7 @@ func (d *githubDeployer) copyFile(src, dest string) error {
 	return err
 }
 
-func (d *githubDeployer) createArgoBotValuesFile(baseFolder, generatedFolder, serviceName, environment, commit string, env *ServiceEnvironment) (string, error) {
+func (d *githubDeployer) createArgoBotValuesFile(baseFolder, generatedFolder string, env *ServiceEnvironment, opts options) (string, error) {
 	targetFileName := defaultHelmValuesFileName
 	if env.HelmValuesTargetFile != "" {
 		targetFileName = env.HelmValuesTargetFile
@@ -546,12 +1085,13 @@ func (d *githubDeployer) createArgoBotValuesFile(baseFolder, generatedFolder, se
 
 	valuesPath := filepath.Join(generatedFolder, targetFileName)
 
+	argoBotNode, err := helmArgoBotValues(opts, env)
+	if err != nil {
+		return "", err
+	}
+
 	argoBotValues := map[string]interface{}{
-		"argoBot": map[string]interface{}{
-			"serviceName": serviceName,
-			"environment": environment,
-			"version":     commit,
-		},
+		"argoBot": argoBotNode,
 	}
 
 	argoBotYAML, err := yaml.Marshal(argoBotValues)
@@ -560,26 +1100,31 @@ func (d *githubDeployer) createArgoBotValuesFile(baseFolder, generatedFolder, se
 	}
 	argoBotSection := strings.TrimRight(string(argoBotYAML), "\n")
 
-	existingContent, err := os.ReadFile(valuesPath)
-	if err != nil && !os.IsNotExist(err) {
-		return "", fmt.Errorf("failed to read existing values file: %w", err)
+	existingValues, found, err := readHelmValuesFile(generatedFolder, targetFileName)
+	if err != nil {
+		return "", err
+	}
+
+	layeredValues, err := layeredHelmValues(generatedFolder, env)
+	if err != nil {
+		return "", err
 	}
 
 	var finalContent string
 
-	if len(existingContent) > 0 {
-		var values map[string]interface{}
-		err = yaml.Unmarshal(existingContent, &values)
+	if len(layeredValues) > 0 {
+		onlyOverrides := len(helmValuesFiles(generatedFolder, env)) == 0
+		valuesContent, err := helmValuesContent(valuesPath, existingValues, layeredValues, onlyOverrides)
 		if err != nil {
-			return "", fmt.Errorf("failed to parse existing values file: %w", err)
+			return "", err
 		}
-
-		if _, hasArgoBot := values["argoBot"]; hasArgoBot {
-			return "", fmt.Errorf("values file must not contain argoBot section as it is auto-generated by argo-bot")
+		finalContent = strings.TrimRight(valuesContent, "\n") + "\n\n" + argoBotSection + "\n"
+	} else if found && len(existingValues) > 0 {
+		existingContent, err := os.ReadFile(valuesPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read existing values file: %w", err)
 		}
-
-		contentStr := string(existingContent)
-		finalContent = strings.TrimRight(contentStr, "\n") + "\n\n" + argoBotSection + "\n"
+		finalContent = strings.TrimRight(string(existingContent), "\n") + "\n\n" + argoBotSection + "\n"
 	} else {
 		finalContent = argoBotSection + "\n"
 	}
@@ -617,16 +1162,24 @@ func (d *githubDeployer) findExistingFiles(baseFolder, generatedPath string) []s
 	return files
 }
 
-func (d *githubDeployer) createFreezeFile(baseFolder, freezeFilePath string) (string, error) {
+func (d *githubDeployer) createFreezeFile(baseFolder, freezeFilePath string, info FreezeInfo) (string, error) {
 	freezeFile := filepath.Join(baseFolder, freezeFilePath, freezeFileName)
+	if err := os.MkdirAll(filepath.Dir(freezeFile), 0755); err != nil {
+		return "", err
+	}
+
 	file, err := os.Create(freezeFile)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	warning := "# This file is managed by the GitOps deployment bot.\n# DO NOT EDIT OR DELETE THIS FILE MANUALLY.\n# Use the bot commands to manage service freezes."
-	if _, err := file.WriteString(warning); err != nil {
+	metadata, err := yaml.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.WriteString(freezeFileHeader + string(metadata)); err != nil {
 		return "", err
 	}
 
@@ -720,6 +1273,21 @@ func (d *githubDeployer) LookupEnvironment(service *Service, name string) (*Serv
 	return nil, api.NewValidationErr(fmt.Sprintf("environment %s does not exist for service %s", name, service.Name))
 }
 
+// configuredEnvironmentName returns the name of the environment as written in the config. Environments are looked up
+// case-insensitively, while freeze files, branches and pull requests use the configured name. Unknown names are
+// returned as they are, so the lookup reports them.
+func (d *githubDeployer) configuredEnvironmentName(name string) string {
+	for _, service := range d.config.Services {
+		for _, environment := range service.Environments {
+			if strings.EqualFold(environment.Name, name) {
+				return environment.Name
+			}
+		}
+	}
+
+	return name
+}
+
 func (d *githubDeployer) ListServiceEnvironmentsStatus(serviceNames []string) (map[ServiceName][]EnvironmentStatus, error) {
 	services, err := d.LookupServices(serviceNames)
 	if err != nil {
@@ -740,32 +1308,64 @@ func (d *githubDeployer) ListServiceEnvironmentsStatus(serviceNames []string) (m
 		}
 	}
 
-	serviceToEnvStatuses := make(map[ServiceName][]EnvironmentStatus)
-
+	repoStatus := make(map[ServiceName]map[EnvironmentName]EnvironmentStatus)
 	for branch, environments := range branchEnvironments {
 		serviceToEnvWithStatus, err := d.getEnvironmentsStatusForBranch(branch, environments)
 		if err != nil {
 			return nil, err
 		}
 
-		for service, envToFreezeStatus := range serviceToEnvWithStatus {
-			envStatuses := make([]EnvironmentStatus, 0, len(envToFreezeStatus))
-			for env, isFrozen := range envToFreezeStatus {
-				envStatuses = append(envStatuses, EnvironmentStatus{
-					EnvironmentName: string(env),
-					IsFrozen:        isFrozen,
-				})
+		for service, envToStatus := range serviceToEnvWithStatus {
+			if repoStatus[service] == nil {
+				repoStatus[service] = make(map[EnvironmentName]EnvironmentStatus)
+			}
+			for env, status := range envToStatus {
+				repoStatus[service][env] = status
 			}
+		}
+	}
 
-			serviceToEnvStatuses[service] = envStatuses
+	// Every environment needs its own history lookup, they run concurrently and a failed lookup only leaves the
+	// deployment details of that environment empty
+	ctx := context.Background()
+	serviceToEnvStatuses := make(map[ServiceName][]EnvironmentStatus)
+	lookups := make(chan struct{}, maxConcurrentStatusLookups)
+	var wg sync.WaitGroup
+	for _, service := range services {
+		serviceName := ServiceName(service.Name)
+		envStatuses := make([]EnvironmentStatus, len(service.Environments))
+		for i, env := range service.Environments {
+			envStatuses[i] = repoStatus[serviceName][EnvironmentName(env.Name)]
+			envStatuses[i].EnvironmentName = env.Name
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lookups <- struct{}{}
+				defer func() { <-lookups }()
+
+				err := d.addDeploymentStatus(ctx, service, &env, &envStatuses[i])
+				if err != nil {
+					log.WithError(err).
+						WithField("service", service.Name).
+						WithField("environment", env.Name).
+						Warn("Failed to get deployment status")
+				}
+			}()
 		}
+
+		serviceToEnvStatuses[serviceName] = envStatuses
 	}
+	wg.Wait()
 
 	return serviceToEnvStatuses, nil
 }
 
-func (d *githubDeployer) getEnvironmentsStatusForBranch(branch string, environments []serviceEnvToCheck) (map[ServiceName]map[EnvironmentName]bool, error) {
-	baseFolder, _, err := d.cloneBranch(context.Background(), "check-freeze-status", branch)
+// getEnvironmentsStatusForBranch returns the freeze and deploy window status of the environments, which depend on
+// files in the deployment repository branch.
+func (d *githubDeployer) getEnvironmentsStatusForBranch(branch string, environments []serviceEnvToCheck) (map[ServiceName]map[EnvironmentName]EnvironmentStatus, error) {
+	ctx := context.Background()
+	baseFolder, _, err := d.cloneBranch(ctx, "check-freeze-status", branch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clone repository for branch %s: %w", branch, err)
 	}
@@ -777,10 +1377,21 @@ func (d *githubDeployer) getEnvironmentsStatusForBranch(branch string, environme
 		}
 	}()
 
-	frozenStatus := make(map[ServiceName]map[EnvironmentName]bool)
-
+	statuses := make(map[ServiceName]map[EnvironmentName]EnvironmentStatus)
+	environmentFreezes := make(map[EnvironmentName]*FreezeInfo)
+	now := timeNow()
 	for _, env := range environments {
-		frozen, err := d.checkIfServiceFrozen(baseFolder, env.FreezeFilePath)
+		envName := EnvironmentName(env.Environment.Name)
+		environmentFreeze, checked := environmentFreezes[envName]
+		if !checked {
+			environmentFreeze, err = d.readFreeze(ctx, baseFolder, branch, d.getEnvironmentFreezeFilePath(env.Environment.Name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to check freeze status for environment %s: %w", env.Environment.Name, err)
+			}
+			environmentFreezes[envName] = environmentFreeze
+		}
+
+		freezeInfo, err := d.readFreeze(ctx, baseFolder, branch, env.FreezeFilePath)
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to check freeze status for service %s environment %s: %w",
@@ -788,16 +1399,30 @@ func (d *githubDeployer) getEnvironmentsStatusForBranch(branch string, environme
 			)
 		}
 
+		status := EnvironmentStatus{IsFrozen: freezeInfo != nil, Freeze: freezeInfo}
+		if environmentFreeze != nil {
+			status = EnvironmentStatus{IsFrozen: true, EnvironmentFrozen: true, Freeze: environmentFreeze}
+		}
+		schedule, err := loadDeploySchedule(baseFolder, &env.Environment)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to load deploy schedule for service %s environment %s: %w",
+				env.ServiceName, env.Environment.Name, err,
+			)
+		}
+		if schedule != nil {
+			status.DeployBlockedReason, status.NextDeployWindow = schedule.status(now)
+		}
+
 		serviceName := ServiceName(env.ServiceName)
-		envName := EnvironmentName(env.Environment.Name)
-		if frozenStatus[serviceName] == nil {
-			frozenStatus[serviceName] = make(map[EnvironmentName]bool)
+		if statuses[serviceName] == nil {
+			statuses[serviceName] = make(map[EnvironmentName]EnvironmentStatus)
 		}
 
-		frozenStatus[serviceName][envName] = frozen
+		statuses[serviceName][envName] = status
 	}
 
-	return frozenStatus, nil
+	return statuses, nil
 }
 
 type serviceEnvToCheck struct {
@@ -866,10 +1491,13 @@ func getFreezeFilePath(environment ServiceEnvironment) string {
 	return environment.TemplatePath
 }
 
-type options struct {
-	ServiceName string
-	Environment string
-	Version     string
+// getEnvironmentFreezeFilePath returns the folder of the freeze file that freezes every service of the environment
+func (d *githubDeployer) getEnvironmentFreezeFilePath(environmentName string) string {
+	if d.config.EnvironmentFreezePath != "" {
+		return path.Join(d.config.EnvironmentFreezePath, environmentName)
+	}
+
+	return path.Join(defaultEnvironmentFreezePath, environmentName)
 }
 
 func (d *githubDeployer) ListServices() []Service {
@@ -0,0 +1,585 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/github"
+	"github.com/apono-io/argo-bot/pkg/github/githubtest"
+)
+
+const (
+	testOrganization = "apono-io"
+	testRepository   = "services"
+	testCommit       = "0123456789abcdef0123456789abcdef01234567"
+	testUserFullname = "Jane Doe"
+	testUserEmail    = "jane@example.com"
+)
+
+func newTestDeployer(t *testing.T, services ...Service) (*githubDeployer, *githubtest.Client) {
+	t.Helper()
+
+	client := githubtest.NewClient()
+	client.AddServiceCommit(testOrganization, testRepository, testCommit, "")
+	client.SetServiceBranch(testOrganization, testRepository, "main", testCommit)
+
+	deployer := &githubDeployer{
+		config: Config{
+			Github:   github.Config{CloneTmpDir: t.TempDir()},
+			Services: services,
+		},
+		githubClient: client,
+	}
+
+	return deployer, client
+}
+
+func testService(name string, environments ...ServiceEnvironment) Service {
+	return Service{
+		Name:               name,
+		GithubOrganization: testOrganization,
+		GithubRepository:   testRepository,
+		Environments:       environments,
+	}
+}
+
+func testEnvironment(name, service string) ServiceEnvironment {
+	return ServiceEnvironment{
+		Name:          name,
+		TemplatePath:  "templates/" + service,
+		GeneratedPath: "generated/" + name + "/" + service,
+	}
+}
+
+func deployAndApprove(t *testing.T, deployer *githubDeployer, services []string, environment string) string {
+	t.Helper()
+
+	pr, diff, err := deployer.Deploy(services, environment, testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	return diff
+}
+
+func assertValidationErr(t *testing.T, err error, contains string) {
+	t.Helper()
+
+	var validationErr api.ValidationErr
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error containing %q, got %v", contains, err)
+	}
+
+	if !strings.Contains(err.Error(), contains) {
+		t.Fatalf("expected error containing %q, got %q", contains, err.Error())
+	}
+}
+
+func TestDeployRendersGoTemplates(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "name: {{ .ServiceName }}\nnamespace: {{ .Environment }}\nimage: users:{{ .Version }}\n",
+	})
+
+	pr, diff, err := deployer.Deploy([]string{"users"}, "staging", testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+
+	if !strings.Contains(diff, "+image: users:"+testCommit) {
+		t.Errorf("diff does not contain rendered image, diff:\n%s", diff)
+	}
+
+	opened := client.PullRequest(pr.Id)
+	if opened.State != githubtest.PullRequestOpen || opened.Branch != "deploy-users-staging" {
+		t.Errorf("unexpected pull request %+v", opened)
+	}
+
+	wantTitle := "Deploy users to staging with version 0123456 triggered by Jane Doe (jane@example.com)"
+	if opened.Title != wantTitle {
+		t.Errorf("title = %q, want %q", opened.Title, wantTitle)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	want := "name: users\nnamespace: staging\nimage: users:" + testCommit + "\n"
+	if got := client.Files("")["generated/staging/users/deployment.yaml"]; got != want {
+		t.Errorf("rendered file = %q, want %q", got, want)
+	}
+
+	if client.HasBranch("deploy-users-staging") {
+		t.Error("deployment branch was not deleted after merge")
+	}
+}
+
+func TestDeployMissingTemplateKey(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "image: {{ .Image }}\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "staging", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil {
+		t.Fatal("expected deploy to fail on unknown template key")
+	}
+}
+
+func TestDeployHelmChart(t *testing.T) {
+	environment := testEnvironment("staging", "users")
+	environment.HelmValuesTargetFile = "values.yaml"
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":            "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/values.yaml":           "replicas: 2\n",
+		"templates/users/templates/deploy.yaml": "image: {{ .Values.argoBot.version }}\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	files := client.Files("")
+	if got := files["generated/staging/users/templates/deploy.yaml"]; got != "image: {{ .Values.argoBot.version }}\n" {
+		t.Errorf("helm template should be copied as is, got %q", got)
+	}
+
+	values := files["generated/staging/users/values.yaml"]
+	for _, want := range []string{"replicas: 2", "argoBot:", "serviceName: users", "environment: staging", "version: " + testCommit} {
+		if !strings.Contains(values, want) {
+			t.Errorf("values file does not contain %q:\n%s", want, values)
+		}
+	}
+
+	if _, ok := files["generated/staging/users/argo-bot-values.yaml"]; ok {
+		t.Error("default values file should not be created when a target file is configured")
+	}
+}
+
+func TestDeployHelmChartRejectsArgoBotValues(t *testing.T) {
+	environment := testEnvironment("staging", "users")
+	environment.HelmValuesTargetFile = "values.yaml"
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":  "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/values.yaml": "argoBot:\n  version: manual\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "staging", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil || !strings.Contains(err.Error(), "must not contain argoBot section") {
+		t.Fatalf("expected argoBot section error, got %v", err)
+	}
+}
+
+func TestDeployRemovesStaleGeneratedFiles(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml":         "version: {{ .Version }}\n",
+		"generated/staging/users/deployment.yaml": "version: old\n",
+		"generated/staging/users/legacy.yaml":     "legacy: true\n",
+	})
+
+	diff := deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	if !strings.Contains(diff, "--- a/generated/staging/users/legacy.yaml\n+++ /dev/null") {
+		t.Errorf("diff does not delete stale file:\n%s", diff)
+	}
+
+	files := client.Files("")
+	if _, ok := files["generated/staging/users/legacy.yaml"]; ok {
+		t.Error("stale generated file was not deleted")
+	}
+
+	if got := files["generated/staging/users/deployment.yaml"]; got != "version: "+testCommit+"\n" {
+		t.Errorf("deployment.yaml = %q", got)
+	}
+}
+
+func TestDeployFileConflict(t *testing.T) {
+	users := testEnvironment("staging", "users")
+	accounts := testEnvironment("staging", "accounts")
+	accounts.GeneratedPath = users.GeneratedPath
+	deployer, client := newTestDeployer(t, testService("users", users), testService("accounts", accounts))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml":    "name: {{ .ServiceName }}\n",
+		"templates/accounts/deployment.yaml": "name: {{ .ServiceName }}\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users", "accounts"}, "staging", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil || !strings.Contains(err.Error(), "file conflict") {
+		t.Fatalf("expected file conflict error, got %v", err)
+	}
+}
+
+func TestDeployAllowedBranches(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.AllowedBranches = []string{"main"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "version: {{ .Version }}\n",
+	})
+
+	featureCommit := "fedcba9876543210fedcba9876543210fedcba98"
+	client.AddServiceCommit(testOrganization, testRepository, featureCommit, testCommit)
+	client.SetServiceBranch(testOrganization, testRepository, "feature", featureCommit)
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", featureCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "commit is not in allowed branches")
+
+	if _, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail); err != nil {
+		t.Fatalf("deploy of commit on allowed branch failed: %v", err)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "version: {{ .Version }}\n",
+	})
+
+	pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	if _, ok := client.Files("")["templates/users/.freeze"]; !ok {
+		t.Fatal("freeze file was not created")
+	}
+
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "services are frozen: users")
+
+	pr, _, err = deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionUnfreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	if _, ok := client.Files("")["templates/users/.freeze"]; ok {
+		t.Fatal("freeze file was not removed")
+	}
+
+	pr, _, err = deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionUnfreeze, FreezeDetails{})
+	if err != nil || pr != nil {
+		t.Fatalf("unfreeze of unfrozen service should be a no-op, got pr %v, error %v", pr, err)
+	}
+}
+
+func TestCancelClosesPullRequest(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "version: {{ .Version }}\n",
+	})
+
+	pr, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+
+	if err = deployer.Cancel(context.Background(), pr.Id); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+
+	if state := client.PullRequest(pr.Id).State; state != githubtest.PullRequestClosed {
+		t.Errorf("pull request state = %s, want %s", state, githubtest.PullRequestClosed)
+	}
+
+	if _, ok := client.Files("")["generated/prod/users/deployment.yaml"]; ok {
+		t.Error("cancelled deployment should not change the base branch")
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err == nil {
+		t.Error("approving a closed pull request should fail")
+	}
+}
+
+func TestListServiceEnvironmentsStatus(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users"), testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "version: {{ .Version }}\n",
+		"freeze/prod/users/README.md":     "Freeze marker of users in prod\n",
+	})
+
+	prodEnvironment := deployer.config.Services[0].Environments[1]
+	prodEnvironment.FreezeFilePath = "freeze/prod/users"
+	deployer.config.Services[0].Environments[1] = prodEnvironment
+
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	statuses, err := deployer.ListServiceEnvironmentsStatus([]string{"users"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	userStatuses := statuses["users"]
+	if len(userStatuses) != 2 {
+		t.Fatalf("expected 2 environment statuses, got %+v", userStatuses)
+	}
+
+	staging, prod := userStatuses[0], userStatuses[1]
+	if staging.EnvironmentName != "staging" || staging.IsFrozen || staging.DeployedCommit != testCommit || staging.DeployedBy != testUserFullname {
+		t.Errorf("unexpected staging status %+v", staging)
+	}
+
+	if prod.EnvironmentName != "prod" || !prod.IsFrozen || prod.DeployedCommit != "" {
+		t.Errorf("unexpected prod status %+v", prod)
+	}
+}
+
+// failingHistoryClient fails to list the commits of a path, like a provider outage for one environment
+type failingHistoryClient struct {
+	*githubtest.Client
+	failingPath string
+}
+
+func (c *failingHistoryClient) ListCommits(ctx context.Context, branch, path string, page, perPage int) ([]*github.Commit, error) {
+	if path == c.failingPath {
+		return nil, errors.New("rate limited")
+	}
+
+	return c.Client.ListCommits(ctx, branch, path, page, perPage)
+}
+
+func TestListServiceEnvironmentsStatusHistoryFailure(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users"), testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "version: {{ .Version }}\n"})
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	deployer.githubClient = &failingHistoryClient{Client: client, failingPath: "generated/prod/users"}
+	statuses, err := deployer.ListServiceEnvironmentsStatus([]string{"users"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	userStatuses := statuses["users"]
+	if len(userStatuses) != 2 {
+		t.Fatalf("expected 2 environment statuses, got %+v", userStatuses)
+	}
+
+	staging, prod := userStatuses[0], userStatuses[1]
+	if staging.EnvironmentName != "staging" || staging.DeployedCommit != testCommit {
+		t.Errorf("unexpected staging status %+v", staging)
+	}
+	if prod.EnvironmentName != "prod" || prod.DeployedCommit != "" {
+		t.Errorf("unexpected prod status %+v", prod)
+	}
+}
+
+func TestLookupServicesByTag(t *testing.T) {
+	users := testService("users", testEnvironment("staging", "users"))
+	users.Tags = []string{"backend"}
+	accounts := testService("accounts", testEnvironment("staging", "accounts"))
+	accounts.Tags = []string{"Backend"}
+	deployer, _ := newTestDeployer(t, users, accounts, testService("frontend", testEnvironment("staging", "frontend")))
+
+	resolved := deployer.ResolveTags([]string{"backend", "users"})
+	if strings.Join(resolved, ",") != "users,accounts" {
+		t.Errorf("resolved = %v", resolved)
+	}
+
+	_, err := deployer.LookupServices([]string{"unknown"})
+	assertValidationErr(t, err, "could not find any service")
+}
+
+func TestDeployTemplateValuesAndMetadata(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.Values = map[string]any{"replicas": 3, "resources": map[string]any{"cpu": "500m"}}
+	service := testService("users", environment)
+	service.Values = map[string]any{"replicas": 1, "team": "identity", "resources": map[string]any{"cpu": "100m", "memory": "128Mi"}}
+	deployer, client := newTestDeployer(t, service)
+	client.SetServiceCommitDetails(testOrganization, testRepository, testCommit, github.Commit{
+		Message:    "Fix login redirect\n\nLonger description",
+		AuthorName: "John Smith",
+	})
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "replicas: {{ .Values.replicas }}\nteam: {{ .Values.team }}\n" +
+			"cpu: {{ .Values.resources.cpu }}\nmemory: {{ .Values.resources.memory }}\n" +
+			"tag: {{ .ShortVersion }}\nauthor: {{ .CommitAuthor }}\nmessage: {{ .CommitMessage }}\n" +
+			"requestedBy: {{ .RequestedBy }}\npullRequest: {{ .PullRequest }}\n",
+	})
+
+	pr, diff, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+
+	if !strings.Contains(diff, "+pullRequest: 1") {
+		t.Errorf("diff should contain the pull request number:\n%s", diff)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	want := "replicas: 3\nteam: identity\ncpu: 500m\nmemory: 128Mi\ntag: 0123456\nauthor: John Smith\n" +
+		"message: Fix login redirect\nrequestedBy: Jane Doe\npullRequest: 1\n"
+	if got := client.Files("")["generated/prod/users/deployment.yaml"]; got != want {
+		t.Errorf("rendered file = %q, want %q", got, want)
+	}
+}
+
+func TestDeployHelmChartMetadata(t *testing.T) {
+	tests := []struct {
+		name               string
+		helmDeployMetadata bool
+		want               []string
+		unwanted           []string
+		commits            int
+	}{
+		{
+			name:     "stable keys by default",
+			want:     []string{"serviceName: users", "shortVersion: \"0123456\"", "values:\n        replicas: 3"},
+			unwanted: []string{"requestedBy", "pullRequest", "deployedAt"},
+			commits:  1,
+		},
+		{
+			name:               "deploy metadata enabled",
+			helmDeployMetadata: true,
+			want:               []string{"shortVersion: \"0123456\"", "requestedBy: Jane Doe", "pullRequest: 1", "values:\n        replicas: 3", "deployedAt: "},
+			commits:            2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := testEnvironment("prod", "users")
+			environment.Values = map[string]any{"replicas": 3}
+			environment.HelmDeployMetadata = tt.helmDeployMetadata
+			deployer, client := newTestDeployer(t, testService("users", environment))
+			client.WriteFiles("", "Add chart", map[string]string{
+				"templates/users/Chart.yaml":         "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+				"templates/users/templates/pod.yaml": "pr: {{ .Values.argoBot.pullRequest }}\n",
+			})
+
+			pr, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+			if err != nil {
+				t.Fatalf("deploy failed: %v", err)
+			}
+
+			// The pull request number is committed separately once the pull request is opened
+			commits, err := client.ListCommits(context.Background(), client.PullRequest(pr.Id).Branch, "generated/prod/users", 1, 10)
+			if err != nil {
+				t.Fatalf("list commits failed: %v", err)
+			}
+			if len(commits) != tt.commits {
+				t.Errorf("got %d commits on the deployment branch, want %d", len(commits), tt.commits)
+			}
+
+			values := client.Files(client.PullRequest(pr.Id).Branch)["generated/prod/users/argo-bot-values.yaml"]
+			for _, want := range tt.want {
+				if !strings.Contains(values, want) {
+					t.Errorf("values file does not contain %q:\n%s", want, values)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(values, unwanted) {
+					t.Errorf("values file contains %q:\n%s", unwanted, values)
+				}
+			}
+		})
+	}
+}
+
+func TestDeployTemplateFunctionsAndSharedPartials(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	deployer.config.SharedTemplatesPath = "templates/_shared"
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/_shared/labels.tpl": "{{ define \"labels\" }}app: {{ .ServiceName }}\nenv: {{ .Environment | upper }}{{ end }}",
+		"templates/users/deployment.yaml": "labels:\n{{ include \"labels\" . | indent 2 }}\n" +
+			"tag: {{ .Version | trunc 7 }}\nchecksum: {{ .ServiceName | sha256sum | trunc 8 }}\n" +
+			"team: {{ get .Values \"team\" | default \"platform\" }}\nencoded: {{ .ServiceName | b64enc }}\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	files := client.Files("")
+	want := "labels:\n  app: users\n  env: PROD\ntag: 0123456\nchecksum: 7dfb4cf6\nteam: platform\nencoded: dXNlcnM=\n"
+	if got := files["generated/prod/users/deployment.yaml"]; got != want {
+		t.Errorf("rendered file = %q, want %q", got, want)
+	}
+
+	if _, ok := files["generated/prod/users/labels.tpl"]; ok {
+		t.Error("shared partials should not be rendered as files")
+	}
+}
+
+func TestDeployTemplatesCannotReadEnvironment(t *testing.T) {
+	for _, function := range []string{`env "SLACK_BOT_TOKEN"`, `expandenv "$SLACK_BOT_TOKEN"`, `getHostByName "localhost"`} {
+		deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+		client.WriteFiles("", "Add templates", map[string]string{
+			"templates/users/deployment.yaml": "token: {{ " + function + " | b64enc }}\n",
+		})
+
+		_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+		if err == nil || !strings.Contains(err.Error(), "not defined") {
+			t.Errorf("expected %s to fail to parse, got %v", function, err)
+		}
+	}
+}
+
+func TestDeployNestedGoTemplates(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.CopyWithoutRender = []string{"*.bin", "README*"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/{{ .ServiceName }}-deployment.yaml":                      "name: {{ .ServiceName }}\n",
+		"templates/users/config/{{ .Environment }}/app.yaml":                      "env: {{ .Environment }}\n",
+		"templates/users/{{ if eq .Environment \"staging\" }}debug.yaml{{ end }}": "debug: true\n",
+		"templates/users/files/data.bin":                                          "{{ not a template",
+		"templates/users/README.md":                                               "Rendered with {{ .Values }}",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	files := client.Files("")
+	for path, want := range map[string]string{
+		"generated/prod/users/users-deployment.yaml": "name: users\n",
+		"generated/prod/users/config/prod/app.yaml":  "env: prod\n",
+		"generated/prod/users/files/data.bin":        "{{ not a template",
+		"generated/prod/users/README.md":             "Rendered with {{ .Values }}",
+	} {
+		if got, ok := files[path]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	for path := range files {
+		if strings.HasPrefix(path, "generated/prod/users/") && strings.Contains(path, "debug") {
+			t.Errorf("conditional file should be skipped, got %s", path)
+		}
+	}
+}
+
+func TestDeployTemplatedFileNameOutsideGeneratedPath(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/{{ \"..\\x2f..\\x2fescape.yaml\" }}": "name: {{ .ServiceName }}\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil || !strings.Contains(err.Error(), "outside the generated folder") {
+		t.Fatalf("expected error for file name outside the generated folder, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/github"
+)
+
+// emergencyTitlePrefix marks the pull request and the commit of an emergency deployment
+const emergencyTitlePrefix = "[EMERGENCY] "
+
+// EmergencyApprovers decides who approves emergency deployments
+type EmergencyApprovers interface {
+	// IsEmergencyApprover reports whether the user with the email may approve emergency deployments
+	IsEmergencyApprover(ctx context.Context, email string) (bool, error)
+}
+
+// EmergencyDeploy deploys the commit like Deploy, but through service and environment freezes. The justification is
+// recorded in the pull request and the commit message. The pull request is merged by ApproveEmergency only, which
+// requires an emergency approver other than the deployer.
+func (d *githubDeployer) EmergencyDeploy(serviceNames []string, environmentName, commit, commitUrl, userFullname, userEmail, justification string) (*github.PullRequest, string, error) {
+	if d.emergencyApprovers == nil {
+		return nil, "", api.NewValidationErr("emergency deployments are disabled, no emergency approvers are configured")
+	}
+
+	justification = strings.TrimSpace(justification)
+	if justification == "" {
+		return nil, "", api.NewValidationErr("emergency deployments require a justification")
+	}
+
+	return d.deployCommit(serviceNames, environmentName, commit, commitUrl, userFullname, userEmail, justification)
+}
+
+// ValidateEmergencyApprover checks that the user may approve the emergency deployment of the pull request
+func (d *githubDeployer) ValidateEmergencyApprover(ctx context.Context, pullRequestId int, approverEmail string) error {
+	pr, err := d.githubClient.GetPR(ctx, pullRequestId)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request %d, error: %w", pullRequestId, err)
+	}
+
+	return d.validateEmergencyApprover(ctx, pr, approverEmail)
+}
+
+// ApproveEmergency merges the pull request of an emergency deployment, recording the approver in the merge commit
+func (d *githubDeployer) ApproveEmergency(ctx context.Context, pullRequestId int, approverFullname, approverEmail string) error {
+	pr, err := d.githubClient.GetPR(ctx, pullRequestId)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request %d, error: %w", pullRequestId, err)
+	}
+
+	if err = d.validateEmergencyApprover(ctx, pr, approverEmail); err != nil {
+		return err
+	}
+
+	return d.githubClient.MergePR(ctx, pullRequestId, fmt.Sprintf("Emergency deployment approved by %s (%s)", approverFullname, approverEmail))
+}
+
+// validateEmergencyApprover allows emergency approvers other than the deployer, who is taken from the pull request title
+func (d *githubDeployer) validateEmergencyApprover(ctx context.Context, pr *github.PullRequest, approverEmail string) error {
+	if !isEmergencyTitle(pr.Title) {
+		return api.NewValidationErr(fmt.Sprintf("pull request #%d is not an emergency deployment", pr.Id))
+	}
+
+	if d.emergencyApprovers == nil {
+		return api.NewValidationErr("emergency deployments are disabled, no emergency approvers are configured")
+	}
+
+	if approverEmail == "" {
+		return api.NewValidationErr("the email of the approver is unknown")
+	}
+
+	match := deployCommitPattern.FindStringSubmatch(pr.Title)
+	if match == nil {
+		return fmt.Errorf("failed to find the deployer of pull request #%d", pr.Id)
+	}
+
+	if strings.EqualFold(match[5], approverEmail) {
+		return api.NewValidationErr("emergency deployments must be approved by someone other than the deployer")
+	}
+
+	approver, err := d.emergencyApprovers.IsEmergencyApprover(ctx, approverEmail)
+	if err != nil {
+		return fmt.Errorf("failed to check the emergency approver, error: %w", err)
+	}
+
+	if !approver {
+		return api.NewValidationErr("only emergency approvers can approve emergency deployments")
+	}
+
+	return nil
+}
+
+func isEmergencyTitle(title string) bool {
+	return strings.HasPrefix(title, emergencyTitlePrefix)
+}
+
+func formatEmergencyNotice(justification, userFullname, userEmail string) string {
+	return fmt.Sprintf("EMERGENCY DEPLOYMENT: freezes were bypassed by %s (%s)\nJustification: %s", userFullname, userEmail, justification)
+}
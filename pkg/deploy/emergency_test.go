@@ -0,0 +1,135 @@
+package deploy
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/apono-io/argo-bot/pkg/github/githubtest"
+)
+
+const testApproverEmail = "john@example.com"
+
+// testEmergencyApprovers approves emergency deployments by the listed emails
+type testEmergencyApprovers []string
+
+func (a testEmergencyApprovers) IsEmergencyApprover(_ context.Context, email string) (bool, error) {
+	return slices.Contains(a, email), nil
+}
+
+func TestEmergencyDeployBypassesFreezes(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	deployer.emergencyApprovers = testEmergencyApprovers{testUserEmail, testApproverEmail}
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "image: users:{{ .Version }}\n",
+	})
+
+	pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	pr, _, err = deployer.FreezeEnvironment("prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("freeze environment failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	_, _, err = deployer.EmergencyDeploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail, "  ")
+	assertValidationErr(t, err, "emergency deployments require a justification")
+
+	pr, _, err = deployer.EmergencyDeploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail, "incident 123 hotfix")
+	if err != nil {
+		t.Fatalf("emergency deploy failed: %v", err)
+	}
+
+	opened := client.PullRequest(pr.Id)
+	if !strings.HasPrefix(opened.Title, "[EMERGENCY] Deploy users to prod") {
+		t.Errorf("unexpected title %q", opened.Title)
+	}
+	if !strings.HasPrefix(opened.Description, "EMERGENCY DEPLOYMENT: freezes were bypassed by "+testUserFullname) ||
+		!strings.Contains(opened.Description, "Justification: incident 123 hotfix") {
+		t.Errorf("description does not start with the emergency notice:\n%s", opened.Description)
+	}
+
+	commits, err := client.ListCommits(context.Background(), opened.Branch, "generated/prod/users", 1, 1)
+	if err != nil {
+		t.Fatalf("list commits failed: %v", err)
+	}
+	if message := commits[0].Message; !strings.HasPrefix(message, "[EMERGENCY] Deploy") || !strings.Contains(message, "Justification: incident 123 hotfix") {
+		t.Errorf("commit message does not record the emergency deployment:\n%s", message)
+	}
+
+	if err = deployer.ApproveEmergency(context.Background(), pr.Id, "John Doe", testApproverEmail); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	history, _, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if history[0].Event != HistoryEventDeploy || history[0].PullRequestId != pr.Id {
+		t.Errorf("emergency deployment is missing from the history, got %+v", history[0])
+	}
+
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "environment prod is frozen")
+}
+
+func TestEmergencyDeployApproval(t *testing.T) {
+	ctx := context.Background()
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml": "image: users:{{ .Version }}\n",
+	})
+
+	_, _, err := deployer.EmergencyDeploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail, "incident 123 hotfix")
+	assertValidationErr(t, err, "emergency deployments are disabled")
+
+	deployer.emergencyApprovers = testEmergencyApprovers{testUserEmail, testApproverEmail}
+	pr, _, err := deployer.EmergencyDeploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail, "incident 123 hotfix")
+	if err != nil {
+		t.Fatalf("emergency deploy failed: %v", err)
+	}
+
+	err = deployer.Approve(ctx, pr.Id)
+	assertValidationErr(t, err, "emergency deployments must be approved by an emergency approver")
+
+	err = deployer.ApproveEmergency(ctx, pr.Id, testUserFullname, strings.ToUpper(testUserEmail))
+	assertValidationErr(t, err, "emergency deployments must be approved by someone other than the deployer")
+
+	err = deployer.ValidateEmergencyApprover(ctx, pr.Id, "mallory@example.com")
+	assertValidationErr(t, err, "only emergency approvers can approve emergency deployments")
+
+	if state := client.PullRequest(pr.Id).State; state != githubtest.PullRequestOpen {
+		t.Fatalf("rejected approvals merged the pull request, state %s", state)
+	}
+
+	if err = deployer.ValidateEmergencyApprover(ctx, pr.Id, testApproverEmail); err != nil {
+		t.Fatalf("validate approver failed: %v", err)
+	}
+	if err = deployer.ApproveEmergency(ctx, pr.Id, "John Doe", testApproverEmail); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	commits, err := client.ListCommits(ctx, "", "generated/prod/users", 1, 1)
+	if err != nil {
+		t.Fatalf("list commits failed: %v", err)
+	}
+	if message := commits[0].Message; !strings.HasSuffix(message, "Emergency deployment approved by John Doe ("+testApproverEmail+")") {
+		t.Errorf("merge commit does not record the approver:\n%s", message)
+	}
+
+	pr, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	err = deployer.ApproveEmergency(ctx, pr.Id, "John Doe", testApproverEmail)
+	assertValidationErr(t, err, "is not an emergency deployment")
+}
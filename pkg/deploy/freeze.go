@@ -0,0 +1,249 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/github"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const freezeFileHeader = "# This file is managed by the GitOps deployment bot.\n# DO NOT EDIT OR DELETE THIS FILE MANUALLY.\n# Use the bot commands to manage service freezes.\n"
+
+// FreezeDetails are the optional parts of a freeze request
+type FreezeDetails struct {
+	Reason   string
+	Duration time.Duration
+	// Channel is where the notice about an expired freeze is posted
+	Channel string
+}
+
+// FreezeInfo is the metadata stored in the .freeze file, freeze files created before it was added have none
+type FreezeInfo struct {
+	FrozenBy      string    `yaml:"frozenBy,omitempty"`
+	FrozenByEmail string    `yaml:"frozenByEmail,omitempty"`
+	FrozenAt      time.Time `yaml:"frozenAt,omitempty"`
+	Reason        string    `yaml:"reason,omitempty"`
+	// Duration of a timed freeze, it starts when the freeze is merged. ExpiresAt is resolved from the merge when the
+	// freeze file is read, older freeze files store ExpiresAt instead.
+	Duration  time.Duration `yaml:"duration,omitempty"`
+	ExpiresAt time.Time     `yaml:"expiresAt,omitempty"`
+	Channel   string        `yaml:"channel,omitempty"`
+}
+
+// ExpiredFreeze describes a freeze lifted by UnfreezeExpired
+type ExpiredFreeze struct {
+	ServiceNames []string
+	Environment  string
+	// EnvironmentWide is set when the whole environment was frozen, ServiceNames is then empty
+	EnvironmentWide bool
+	Info            FreezeInfo
+	PullRequest     int
+}
+
+// readFreezeInfo returns the metadata of the freeze file, or nil when the service is not frozen
+func readFreezeInfo(baseFolder, freezeFilePath string) (*FreezeInfo, error) {
+	content, exists, err := readOptionalFile(filepath.Join(baseFolder, freezeFilePath, freezeFileName))
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var info FreezeInfo
+	if err = yaml.Unmarshal([]byte(content), &info); err != nil {
+		return nil, fmt.Errorf("invalid freeze file %s, error: %w", filepath.Join(freezeFilePath, freezeFileName), err)
+	}
+
+	return &info, nil
+}
+
+// readFreeze returns the metadata of the freeze file like readFreezeInfo, with the expiry of a timed freeze resolved
+// from the commit that merged the freeze file into the deployment branch
+func (d *githubDeployer) readFreeze(ctx context.Context, baseFolder, branch, freezeFilePath string) (*FreezeInfo, error) {
+	info, err := readFreezeInfo(baseFolder, freezeFilePath)
+	if err != nil || info == nil || info.Duration <= 0 || !info.ExpiresAt.IsZero() {
+		return info, err
+	}
+
+	commits, err := d.githubClient.ListCommits(ctx, branch, path.Join(freezeFilePath, freezeFileName), 1, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find when the freeze of %s was merged, error: %w", freezeFilePath, err)
+	}
+
+	if len(commits) > 0 {
+		info.ExpiresAt = commits[0].Date.UTC().Add(info.Duration)
+	}
+
+	return info, nil
+}
+
+func newFreezeInfo(userFullname, userEmail string, details FreezeDetails) FreezeInfo {
+	info := FreezeInfo{
+		FrozenBy:      userFullname,
+		FrozenByEmail: userEmail,
+		FrozenAt:      timeNow().UTC().Truncate(time.Second),
+		Reason:        details.Reason,
+		Duration:      details.Duration,
+		Channel:       details.Channel,
+	}
+
+	return info
+}
+
+// formatFreezeDetails describes why and until when a service is frozen, for error messages and PR descriptions
+func formatFreezeDetails(info *FreezeInfo) string {
+	var details []string
+	if info.Reason != "" {
+		details = append(details, info.Reason)
+	}
+	if info.FrozenBy != "" {
+		details = append(details, fmt.Sprintf("by %s", info.FrozenBy))
+	}
+	if !info.ExpiresAt.IsZero() {
+		details = append(details, fmt.Sprintf("until %s", info.ExpiresAt.Format(time.RFC1123)))
+	} else if info.Duration > 0 {
+		details = append(details, fmt.Sprintf("for %s", info.Duration))
+	}
+
+	return strings.Join(details, ", ")
+}
+
+// UnfreezeExpired opens and merges an unfreeze pull request for every freeze whose expiry passed. Expired services of
+// the same environment are unfrozen together, but every freeze is reported on its own, so each gets its own notice. A
+// failure to unfreeze some does not stop the others.
+func (d *githubDeployer) UnfreezeExpired(ctx context.Context) ([]ExpiredFreeze, error) {
+	type freezeKey struct {
+		branch          string
+		environment     string
+		environmentWide bool
+	}
+
+	branches := make(map[string][]serviceEnvToCheck)
+	for _, service := range d.config.Services {
+		for _, environment := range service.Environments {
+			branches[environment.DeploymentRepoBranch] = append(branches[environment.DeploymentRepoBranch], serviceEnvToCheck{
+				ServiceName:    service.Name,
+				Environment:    environment,
+				FreezeFilePath: getFreezeFilePath(environment),
+			})
+		}
+	}
+
+	// Expired services of the same environment are unfrozen by a single pull request, services frozen by the same
+	// freeze share its metadata
+	now := timeNow()
+	groups := make(map[freezeKey][]*ExpiredFreeze)
+	checkedEnvironments := make(map[freezeKey]bool)
+	var errs []error
+	for branch, environments := range branches {
+		baseFolder, err := d.downloadBranch(ctx, "expire-freezes", branch)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, env := range environments {
+			environmentKey := freezeKey{branch: branch, environment: env.Environment.Name, environmentWide: true}
+			if !checkedEnvironments[environmentKey] {
+				checkedEnvironments[environmentKey] = true
+				info, err := d.readFreeze(ctx, baseFolder, branch, d.getEnvironmentFreezeFilePath(env.Environment.Name))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to read freeze of environment %s, error: %w", env.Environment.Name, err))
+				} else if isFreezeExpired(info, now) {
+					groups[environmentKey] = []*ExpiredFreeze{{Environment: env.Environment.Name, EnvironmentWide: true, Info: *info}}
+				}
+			}
+
+			info, err := d.readFreeze(ctx, baseFolder, branch, env.FreezeFilePath)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read freeze of service %s in %s, error: %w", env.ServiceName, env.Environment.Name, err))
+				continue
+			}
+
+			if !isFreezeExpired(info, now) {
+				continue
+			}
+
+			key := freezeKey{branch: branch, environment: env.Environment.Name}
+			index := slices.IndexFunc(groups[key], func(freeze *ExpiredFreeze) bool { return sameFreeze(freeze.Info, *info) })
+			if index < 0 {
+				groups[key] = append(groups[key], &ExpiredFreeze{Environment: env.Environment.Name, Info: *info})
+				index = len(groups[key]) - 1
+			}
+			groups[key][index].ServiceNames = append(groups[key][index].ServiceNames, env.ServiceName)
+		}
+
+		if err = os.RemoveAll(baseFolder); err != nil {
+			log.WithError(err).Error("failed to remove source folder")
+		}
+	}
+
+	var unfrozen []ExpiredFreeze
+	for key, freezes := range groups {
+		var serviceNames []string
+		for _, freeze := range freezes {
+			sort.Strings(freeze.ServiceNames)
+			serviceNames = append(serviceNames, freeze.ServiceNames...)
+		}
+		sort.Strings(serviceNames)
+		logWithCtx := log.WithField("environment", key.environment).WithField("serviceNames", serviceNames)
+
+		var pr *github.PullRequest
+		var err error
+		target := strings.Join(serviceNames, ",")
+		if key.environmentWide {
+			target = "all services"
+			pr, _, err = d.FreezeEnvironment(key.environment, d.config.Github.AuthorName, d.config.Github.AuthorEmail, FreezeActionUnfreeze, FreezeDetails{})
+		} else {
+			pr, _, err = d.Freeze(serviceNames, key.environment, d.config.Github.AuthorName, d.config.Github.AuthorEmail, FreezeActionUnfreeze, FreezeDetails{})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to unfreeze expired freeze of %s in %s, error: %w", target, key.environment, err))
+			continue
+		}
+
+		if pr == nil {
+			continue
+		}
+
+		if err = d.Approve(ctx, pr.Id); err != nil {
+			errs = append(errs, fmt.Errorf("failed to merge unfreeze pull request %d, error: %w", pr.Id, err))
+			continue
+		}
+
+		logWithCtx.Info("Unfroze expired freeze")
+		for _, freeze := range freezes {
+			freeze.PullRequest = pr.Id
+			unfrozen = append(unfrozen, *freeze)
+		}
+	}
+
+	sort.Slice(unfrozen, func(i, j int) bool {
+		if unfrozen[i].Environment != unfrozen[j].Environment {
+			return unfrozen[i].Environment < unfrozen[j].Environment
+		}
+		if unfrozen[i].EnvironmentWide != unfrozen[j].EnvironmentWide {
+			return unfrozen[i].EnvironmentWide
+		}
+		return strings.Join(unfrozen[i].ServiceNames, ",") < strings.Join(unfrozen[j].ServiceNames, ",")
+	})
+	return unfrozen, errors.Join(errs...)
+}
+
+func isFreezeExpired(info *FreezeInfo, now time.Time) bool {
+	return info != nil && !info.ExpiresAt.IsZero() && !now.Before(info.ExpiresAt)
+}
+
+// sameFreeze reports whether both services were frozen by the same freeze request
+func sameFreeze(a, b FreezeInfo) bool {
+	return a.FrozenBy == b.FrozenBy && a.FrozenByEmail == b.FrozenByEmail && a.FrozenAt.Equal(b.FrozenAt) &&
+		a.Reason == b.Reason && a.Channel == b.Channel && a.ExpiresAt.Equal(b.ExpiresAt)
+}
@@ -0,0 +1,238 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimedFreezeExpires(t *testing.T) {
+	frozenAt := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	mergedAt := frozenAt.Add(2 * time.Hour)
+	timeNow = func() time.Time { return frozenAt }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")), testService("orders", testEnvironment("prod", "orders")))
+	deployer.config.Github.AuthorName = "Argo Bot"
+	deployer.config.Github.AuthorEmail = "argo-bot@example.com"
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml":  "image: users:{{ .Version }}\n",
+		"templates/orders/deployment.yaml": "image: orders:{{ .Version }}\n",
+	})
+
+	details := FreezeDetails{Reason: "incident 123", Duration: 4 * time.Hour, Channel: "C123"}
+	pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, details)
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+
+	// The freeze is approved two hours after it was requested, the expiry starts with the merge
+	client.SetClock(mergedAt.Add(-time.Minute))
+	timeNow = func() time.Time { return mergedAt }
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	description := client.PullRequest(pr.Id).Description
+	for _, want := range []string{"Reason: incident 123", "Expires: 4h0m0s after merge"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("pull request description does not contain %q:\n%s", want, description)
+		}
+	}
+
+	pr, _, err = deployer.Freeze([]string{"orders"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	freezeFile := client.Files("")["templates/users/.freeze"]
+	for _, want := range []string{"# DO NOT EDIT", "reason: incident 123", "duration: 4h0m0s", "channel: C123"} {
+		if !strings.Contains(freezeFile, want) {
+			t.Errorf("freeze file does not contain %q:\n%s", want, freezeFile)
+		}
+	}
+
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "services are frozen: users (incident 123, by "+testUserFullname+", until Fri, 08 Mar 2024 16:00:00 UTC)")
+
+	statuses, err := deployer.ListServiceEnvironmentsStatus([]string{"users"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if freeze := statuses["users"][0].Freeze; freeze == nil || freeze.Reason != "incident 123" || freeze.FrozenByEmail != testUserEmail {
+		t.Errorf("unexpected freeze status %+v", freeze)
+	}
+
+	timeNow = func() time.Time { return frozenAt.Add(4 * time.Hour) }
+	unfrozen, err := deployer.UnfreezeExpired(context.Background())
+	if err != nil || len(unfrozen) != 0 {
+		t.Fatalf("freeze should not expire yet, got %+v, error %v", unfrozen, err)
+	}
+
+	timeNow = func() time.Time { return mergedAt.Add(4 * time.Hour) }
+	unfrozen, err = deployer.UnfreezeExpired(context.Background())
+	if err != nil {
+		t.Fatalf("unfreeze expired failed: %v", err)
+	}
+
+	if len(unfrozen) != 1 || unfrozen[0].ServiceNames[0] != "users" || unfrozen[0].Info.Channel != "C123" {
+		t.Fatalf("unexpected unfrozen freezes %+v", unfrozen)
+	}
+
+	files := client.Files("")
+	if _, ok := files["templates/users/.freeze"]; ok {
+		t.Error("expired freeze file was not removed")
+	}
+	if _, ok := files["templates/orders/.freeze"]; !ok {
+		t.Error("freeze without expiry should not be removed")
+	}
+
+	history, _, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if history[0].Event != HistoryEventUnfreeze || history[0].UserFullname != "Argo Bot" {
+		t.Errorf("unexpected latest history entry %+v", history[0])
+	}
+}
+
+func TestUnfreezeExpiredReportsEveryFreeze(t *testing.T) {
+	frozenAt := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return frozenAt }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	deployer, client := newTestDeployer(t,
+		testService("users", testEnvironment("prod", "users")),
+		testService("orders", testEnvironment("prod", "orders")),
+		testService("billing", testEnvironment("prod", "billing")))
+	deployer.config.Github.AuthorName = "Argo Bot"
+	deployer.config.Github.AuthorEmail = "argo-bot@example.com"
+	client.SetClock(frozenAt)
+
+	freezes := []struct {
+		serviceNames []string
+		details      FreezeDetails
+	}{
+		{serviceNames: []string{"users", "orders"}, details: FreezeDetails{Reason: "incident 123", Duration: time.Hour, Channel: "C123"}},
+		{serviceNames: []string{"billing"}, details: FreezeDetails{Reason: "billing migration", Duration: time.Hour, Channel: "C456"}},
+	}
+	for _, freeze := range freezes {
+		pr, _, err := deployer.Freeze(freeze.serviceNames, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, freeze.details)
+		if err != nil {
+			t.Fatalf("freeze failed: %v", err)
+		}
+		if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	timeNow = func() time.Time { return frozenAt.Add(2 * time.Hour) }
+	unfrozen, err := deployer.UnfreezeExpired(context.Background())
+	if err != nil {
+		t.Fatalf("unfreeze expired failed: %v", err)
+	}
+
+	if len(unfrozen) != 2 {
+		t.Fatalf("expected 2 expired freezes, got %+v", unfrozen)
+	}
+	if freeze := unfrozen[0]; strings.Join(freeze.ServiceNames, ",") != "billing" || freeze.Info.Channel != "C456" || freeze.Info.Reason != "billing migration" {
+		t.Errorf("unexpected expired freeze %+v", freeze)
+	}
+	if freeze := unfrozen[1]; strings.Join(freeze.ServiceNames, ",") != "orders,users" || freeze.Info.Channel != "C123" || freeze.Info.Reason != "incident 123" {
+		t.Errorf("unexpected expired freeze %+v", freeze)
+	}
+	if unfrozen[0].PullRequest != unfrozen[1].PullRequest {
+		t.Errorf("services of the same environment should be unfrozen by a single pull request, got %d and %d", unfrozen[0].PullRequest, unfrozen[1].PullRequest)
+	}
+
+	for _, service := range []string{"users", "orders", "billing"} {
+		if _, ok := client.Files("")["templates/"+service+"/.freeze"]; ok {
+			t.Errorf("expired freeze file of %s was not removed", service)
+		}
+	}
+}
+
+func TestFreezeEnvironment(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users"), testEnvironment("staging", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"templates/users/deployment.yaml":  "image: users:{{ .Version }}\n",
+		"templates/orders/deployment.yaml": "image: orders:{{ .Version }}\n",
+	})
+
+	pr, _, err := deployer.FreezeEnvironment("prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{Reason: "release freeze"})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	if _, ok := client.Files("")["freeze/prod/.freeze"]; !ok {
+		t.Fatal("environment freeze file was not created")
+	}
+
+	// Services added to the environment after the freeze are frozen as well
+	deployer.config.Services = append(deployer.config.Services, testService("orders", testEnvironment("prod", "orders")))
+	_, _, err = deployer.Deploy([]string{"orders"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "environment prod is frozen (release freeze, by "+testUserFullname+")")
+
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	statuses, err := deployer.ListServiceEnvironmentsStatus([]string{"users", "orders"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if status := statuses["orders"][0]; !status.IsFrozen || !status.EnvironmentFrozen || status.Freeze.Reason != "release freeze" {
+		t.Errorf("unexpected prod status %+v", status)
+	}
+	if status := statuses["users"][1]; status.IsFrozen {
+		t.Errorf("staging should not be frozen, got %+v", status)
+	}
+
+	pr, _, err = deployer.FreezeEnvironment("prod", testUserFullname, testUserEmail, FreezeActionUnfreeze, FreezeDetails{})
+	if err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	deployAndApprove(t, deployer, []string{"orders"}, "prod")
+
+	history, _, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 2 || history[0].Event != HistoryEventUnfreeze || history[1].Event != HistoryEventFreeze {
+		t.Errorf("unexpected history %+v", history)
+	}
+
+	_, _, err = deployer.FreezeEnvironment("qa", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+	assertValidationErr(t, err, "environment qa does not exist")
+}
+
+func TestFreezeEnvironmentIgnoresNameCase(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+
+	pr, _, err := deployer.FreezeEnvironment("PROD", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{Reason: "release freeze"})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	if _, ok := client.Files("")["freeze/prod/.freeze"]; !ok {
+		t.Fatal("environment freeze file was not created under the configured name")
+	}
+
+	for _, environment := range []string{"prod", "PROD", "Prod"} {
+		_, _, err = deployer.Deploy([]string{"users"}, environment, testCommit, "", testUserFullname, testUserEmail)
+		assertValidationErr(t, err, "environment prod is frozen (release freeze, by "+testUserFullname+")")
+	}
+}
@@ -0,0 +1,58 @@
+package deploy
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// templateFuncs returns the functions available to Go templates, the sprig library plus the helpers Helm users are
+// used to, so the same snippets work in both template modes. include executes templates of the given set.
+func templateFuncs(tmpl *template.Template) template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	// Like Helm, templates must not read the environment of the bot, which holds its tokens, or resolve hosts
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	delete(funcs, "getHostByName")
+
+	funcs["toYaml"] = toYaml
+	funcs["fromYaml"] = fromYaml
+	funcs["required"] = required
+	funcs["include"] = func(name string, data any) (string, error) {
+		var sb strings.Builder
+		err := tmpl.ExecuteTemplate(&sb, name, data)
+		return sb.String(), err
+	}
+
+	return funcs
+}
+
+func toYaml(value any) (string, error) {
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+func fromYaml(content string) (map[string]any, error) {
+	values := map[string]any{}
+	err := yaml.Unmarshal([]byte(content), &values)
+	return values, err
+}
+
+func required(message string, value any) (any, error) {
+	if value == nil {
+		return nil, errors.New(message)
+	}
+
+	if s, ok := value.(string); ok && s == "" {
+		return nil, errors.New(message)
+	}
+
+	return value, nil
+}
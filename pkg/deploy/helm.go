@@ -0,0 +1,314 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// helmRenderNamespace matches the namespace used by helm template when no cluster is configured
+const helmRenderNamespace = "default"
+
+// renderHelmChart runs the Helm template engine over the chart and writes the resulting manifests, sorted in install
+// order like helm template does. Dependencies are only loaded from the charts folder, nothing is fetched.
+func (d *githubDeployer) renderHelmChart(baseFolder, templateFolder, generatedFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	helmChart, err := loader.Load(templateFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load helm chart, error: %w", err)
+	}
+
+	err = checkChartDependencies(helmChart)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := helmRenderValues(templateFolder, env, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = chartutil.ProcessDependenciesWithMerge(helmChart, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process helm chart dependencies, error: %w", err)
+	}
+
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      opts.ServiceName,
+		Namespace: helmRenderNamespace,
+		Revision:  1,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(helmChart, values, releaseOptions, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare helm values, error: %w", err)
+	}
+
+	rendered, err := engine.Render(helmChart, renderValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart, error: %w", err)
+	}
+
+	manifests, err := joinHelmManifests(helmChart, rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestsPath := filepath.Join(generatedFolder, renderedManifestsFileName)
+	err = os.WriteFile(manifestsPath, []byte(manifests), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, err := filepath.Rel(baseFolder, manifestsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{relPath}, nil
+}
+
+// helmRenderValues returns the values passed on top of the chart defaults, the configured values file of the chart
+// followed by the layered values and the argoBot section.
+func helmRenderValues(templateFolder string, env *ServiceEnvironment, opts options) (map[string]any, error) {
+	var values map[string]any
+	if env.HelmValuesTargetFile != "" {
+		targetValues, found, err := readHelmValuesFile(templateFolder, env.HelmValuesTargetFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			values = targetValues
+		}
+	}
+
+	layeredValues, err := layeredHelmValues(templateFolder, env)
+	if err != nil {
+		return nil, err
+	}
+	values = mergeValues(values, layeredValues)
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	// Round trip through yaml so the section has the same keys as the generated values file
+	argoBotNode, err := helmArgoBotValues(opts, env)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := yaml.Marshal(argoBotNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal argoBot values: %w", err)
+	}
+
+	argoBotValues, err := chartutil.ReadValues(content)
+	if err != nil {
+		return nil, err
+	}
+
+	values["argoBot"] = argoBotValues.AsMap()
+	return values, nil
+}
+
+// helmValuesFiles returns the values files layered for the environment, by default values-<environment>.yaml when the
+// chart has one.
+func helmValuesFiles(chartFolder string, env *ServiceEnvironment) []string {
+	if len(env.HelmValuesFiles) > 0 {
+		return env.HelmValuesFiles
+	}
+
+	environmentFile := fmt.Sprintf("values-%s.yaml", env.Name)
+	if environmentFile == env.HelmValuesTargetFile {
+		// The target file is the base of the generated values file already
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(chartFolder, environmentFile)); err == nil {
+		return []string{environmentFile}
+	}
+
+	return nil
+}
+
+// layeredHelmValues deep merges the layered values files in order and then the values overrides of the environment.
+func layeredHelmValues(chartFolder string, env *ServiceEnvironment) (map[string]any, error) {
+	var values map[string]any
+	for _, file := range helmValuesFiles(chartFolder, env) {
+		fileValues, found, err := readHelmValuesFile(chartFolder, file)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, fmt.Errorf("values file %s was not found in the helm chart", file)
+		}
+
+		values = mergeValues(values, fileValues)
+	}
+
+	return mergeValues(values, env.HelmValues), nil
+}
+
+// helmValuesContent returns the content of the target values file with the layered values merged in. When only the
+// helmValues overrides apply, the changed values are edited in place so the rest of the file, including its comments,
+// stays as it is. Layered values files are merged by rewriting the file.
+func helmValuesContent(valuesPath string, existingValues, layeredValues map[string]any, onlyOverrides bool) (string, error) {
+	merged := mergeValues(existingValues, layeredValues)
+	if onlyOverrides && len(existingValues) > 0 {
+		content, err := os.ReadFile(valuesPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read existing values file: %w", err)
+		}
+
+		edited, err := mergeYamlValues(content, layeredValues, merged)
+		if err == nil {
+			return string(edited), nil
+		}
+
+		log.WithError(err).WithField("valuesFile", filepath.Base(valuesPath)).Warn("Failed to edit values file in place, rewriting it")
+	}
+
+	mergedYAML, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal layered values: %w", err)
+	}
+
+	return string(mergedYAML), nil
+}
+
+// mergeYamlValues edits the overrides into the values file content, checking the result against the merged values
+func mergeYamlValues(content []byte, overrides, merged map[string]any) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	if len(document.Content) == 0 || !isBlockCollection(document.Content[0], yaml.MappingNode) {
+		return nil, errors.New("values file must be a block mapping")
+	}
+
+	editor := &yamlEditor{content: content, lineOffsets: yamlLineOffsets(content)}
+	if err := editor.mergeMapping(document.Content[0], overrides); err != nil {
+		return nil, err
+	}
+	edited := editor.apply()
+
+	// Values are compared after a round trip through yaml, which gives both sides the same types
+	mergedYAML, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	var want, got map[string]any
+	if err = yaml.Unmarshal(mergedYAML, &want); err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(edited, &got); err != nil {
+		return nil, fmt.Errorf("edited values file is not valid yaml, error: %w", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		return nil, errors.New("edited values file does not match the merged values")
+	}
+
+	return edited, nil
+}
+
+func readHelmValuesFile(chartFolder, file string) (map[string]any, bool, error) {
+	content, err := os.ReadFile(filepath.Join(chartFolder, file))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read values file %s, error: %w", file, err)
+	}
+
+	var values map[string]any
+	err = yaml.Unmarshal(content, &values)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse values file %s, error: %w", file, err)
+	}
+
+	if _, hasArgoBot := values["argoBot"]; hasArgoBot {
+		return nil, false, fmt.Errorf("values file %s must not contain argoBot section as it is auto-generated by argo-bot", file)
+	}
+
+	return values, true, nil
+}
+
+func checkChartDependencies(helmChart *chart.Chart) error {
+	var missing []string
+	for _, dependency := range helmChart.Metadata.Dependencies {
+		found := false
+		for _, subChart := range helmChart.Dependencies() {
+			if subChart.Name() == dependency.Name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, dependency.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("helm chart dependencies %s are missing in the charts folder, run helm dependency build and commit them",
+			strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func joinHelmManifests(helmChart *chart.Chart, rendered map[string]string) (string, error) {
+	files := make(map[string]string)
+	for name, content := range rendered {
+		if strings.HasSuffix(name, "NOTES.txt") {
+			continue
+		}
+		files[name] = content
+	}
+
+	hooks, manifests, err := releaseutil.SortManifests(files, nil, releaseutil.InstallOrder)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rendered helm manifests, error: %w", err)
+	}
+
+	var sb strings.Builder
+	crds := helmChart.CRDObjects()
+	sort.Slice(crds, func(i, j int) bool { return crds[i].Filename < crds[j].Filename })
+	for _, crd := range crds {
+		writeHelmManifest(&sb, crd.Filename, string(crd.File.Data))
+	}
+
+	for _, manifest := range manifests {
+		writeHelmManifest(&sb, manifest.Name, manifest.Content)
+	}
+
+	for _, hook := range hooks {
+		writeHelmManifest(&sb, hook.Path, hook.Manifest)
+	}
+
+	return sb.String(), nil
+}
+
+func writeHelmManifest(sb *strings.Builder, source, content string) {
+	sb.WriteString("---\n# Source: ")
+	sb.WriteString(source)
+	sb.WriteString("\n")
+	sb.WriteString(strings.TrimSpace(content))
+	sb.WriteString("\n")
+}
@@ -0,0 +1,179 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDeployHelmChartRender(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.HelmRender = true
+	environment.HelmValuesTargetFile = "values-prod.yaml"
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":                      "apiVersion: v2\nname: users\nversion: 0.1.0\ndependencies:\n  - name: redis\n    version: 1.0.0\n",
+		"templates/users/values.yaml":                     "replicas: 1\nredis:\n  port: 6379\n",
+		"templates/users/values-prod.yaml":                "replicas: 3\n",
+		"templates/users/templates/_helpers.tpl":          "{{ define \"users.name\" }}{{ .Release.Name }}-app{{ end }}",
+		"templates/users/templates/deployment.yaml":       "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: {{ include \"users.name\" . }}\n  namespace: {{ .Release.Namespace }}\nspec:\n  replicas: {{ .Values.replicas }}\n  template:\n    spec:\n      containers:\n        - image: users:{{ .Values.argoBot.version }}\n",
+		"templates/users/templates/namespace.yaml":        "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: {{ .Values.argoBot.environment }}\n",
+		"templates/users/templates/NOTES.txt":             "Deployed {{ .Release.Name }}\n",
+		"templates/users/charts/redis/Chart.yaml":         "apiVersion: v2\nname: redis\nversion: 1.0.0\n",
+		"templates/users/charts/redis/templates/svc.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: redis\nspec:\n  ports:\n    - port: {{ .Values.port }}\n",
+		"generated/prod/users/Chart.yaml":                 "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	files := client.Files("")
+	if _, ok := files["generated/prod/users/Chart.yaml"]; ok {
+		t.Error("previously copied chart should be replaced by the rendered manifests")
+	}
+
+	manifests := files["generated/prod/users/"+renderedManifestsFileName]
+	for _, want := range []string{
+		"# Source: users/templates/deployment.yaml\napiVersion: apps/v1",
+		"name: users-app\n  namespace: default",
+		"replicas: 3",
+		"image: users:" + testCommit,
+		"# Source: users/charts/redis/templates/svc.yaml",
+		"port: 6379",
+	} {
+		if !strings.Contains(manifests, want) {
+			t.Errorf("manifests do not contain %q:\n%s", want, manifests)
+		}
+	}
+
+	if strings.Contains(manifests, "Deployed") {
+		t.Errorf("manifests should not contain the chart notes:\n%s", manifests)
+	}
+
+	if strings.Index(manifests, "kind: Namespace") > strings.Index(manifests, "kind: Deployment") {
+		t.Errorf("manifests should be sorted in install order:\n%s", manifests)
+	}
+}
+
+func TestDeployHelmChartRenderMissingDependency(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.HelmRender = true
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":                "apiVersion: v2\nname: users\nversion: 0.1.0\ndependencies:\n  - name: redis\n    version: 1.0.0\n    repository: https://charts.example.com\n",
+		"templates/users/templates/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: users\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil || !strings.Contains(err.Error(), "redis are missing in the charts folder") {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+}
+
+func TestDeployHelmValuesLayering(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.HelmValues = map[string]any{"resources": map[string]any{"cpu": "2"}}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":          "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/values.yaml":         "replicas: 1\n",
+		"templates/users/values-prod.yaml":    "replicas: 3\nresources:\n  cpu: \"1\"\n  memory: 1Gi\n",
+		"templates/users/values-staging.yaml": "replicas: 2\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	values := client.Files("")["generated/prod/users/"+defaultHelmValuesFileName]
+	for _, want := range []string{"replicas: 3", "cpu: \"2\"", "memory: 1Gi", "argoBot:", "environment: prod"} {
+		if !strings.Contains(values, want) {
+			t.Errorf("values file does not contain %q:\n%s", want, values)
+		}
+	}
+}
+
+func TestDeployHelmValuesLayeringRejectsArgoBotValues(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.HelmRender = true
+	environment.HelmValuesFiles = []string{"values-common.yaml", "values-eu.yaml"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":         "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/values-common.yaml": "replicas: 3\n",
+		"templates/users/values-eu.yaml":     "argoBot:\n  version: manual\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err == nil || !strings.Contains(err.Error(), "values-eu.yaml must not contain argoBot section") {
+		t.Fatalf("expected argoBot section error, got %v", err)
+	}
+}
+
+func TestDeployHelmValuesOverridesKeepTargetFile(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.HelmValuesTargetFile = "values-prod.yaml"
+	environment.HelmValues = map[string]any{
+		"replicas":     4,
+		"resources":    map[string]any{"cpu": "2"},
+		"nodeSelector": map[string]any{"zone": "eu"},
+	}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":       "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/values.yaml":      "replicas: 1\n",
+		"templates/users/values-prod.yaml": "# Production values\nreplicas: 3 # scaled for traffic\nresources:\n  cpu: \"1\" # per pod\n  memory: 1Gi\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	values := client.Files("")["generated/prod/users/values-prod.yaml"]
+	want := "# Production values\nreplicas: 4 # scaled for traffic\nresources:\n  cpu: \"2\" # per pod\n  memory: 1Gi\nnodeSelector:\n  zone: eu\n\nargoBot:\n"
+	if !strings.HasPrefix(values, want) {
+		t.Errorf("values = %q, want prefix %q", values, want)
+	}
+}
+
+func TestMergeYamlValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		overrides map[string]any
+		want      string
+	}{
+		{
+			name:      "nested keys",
+			content:   "image:\n  repository: users # registry\nenv: {}\n",
+			overrides: map[string]any{"image": map[string]any{"tag": "v2", "pullPolicy": "Always"}, "env": map[string]any{"LOG": "debug"}},
+			want:      "image:\n  repository: users # registry\n  pullPolicy: Always\n  tag: v2\nenv: {LOG: debug}\n",
+		},
+		{
+			name:      "block values",
+			content:   "tolerations:\n- key: a\n- key: b\n# pods\nresources:\n  cpu: 1\n",
+			overrides: map[string]any{"tolerations": []any{}, "resources": "small"},
+			want:      "tolerations: []\n# pods\nresources: small\n",
+		},
+		{
+			name:      "empty value",
+			content:   "annotations:\nreplicas: 1\n",
+			overrides: map[string]any{"annotations": map[string]any{"team": "identity"}},
+			want:      "annotations: {team: identity}\nreplicas: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values map[string]any
+			if err := yaml.Unmarshal([]byte(tt.content), &values); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := mergeYamlValues([]byte(tt.content), tt.overrides, mergeValues(values, tt.overrides))
+			if err != nil {
+				t.Fatalf("merge failed: %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("values = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const historyPageSize = 50
+const historyMaxPages = 10
+const shortShaLength = 7
+const historyEntriesPerPage = 10
+
+// deployCommitPattern matches the first line of commits created by deployVersions, including emergency deployments and the
+// " (#<pr>)" suffix GitHub appends when squash merging the pull request, or " (!<mr>)" for GitLab merge requests.
+var deployCommitPattern = regexp.MustCompile(`^(?:\[EMERGENCY\] )?Deploy (\S+) to (\S+)(?: with version ([0-9a-fA-F]+))? triggered by (.*?) \(([^()]*)\)(?: \([#!](\d+)\))?$`)
+
+// freezeCommitPattern matches the first line of commits and squash merges created by Freeze.
+var freezeCommitPattern = regexp.MustCompile(`^(freeze|unfreeze) (\S+) (?:to|on) (\S+) triggered by (.*?) \(([^()]*)\)(?: \([#!](\d+)\))?$`)
+
+type HistoryEvent string
+
+const (
+	HistoryEventDeploy   HistoryEvent = "deploy"
+	HistoryEventFreeze   HistoryEvent = HistoryEvent(FreezeActionFreeze)
+	HistoryEventUnfreeze HistoryEvent = HistoryEvent(FreezeActionUnfreeze)
+)
+
+type HistoryEntry struct {
+	Event           HistoryEvent
+	Version         string
+	UserFullname    string
+	UserEmail       string
+	Time            time.Time
+	PullRequestId   int
+	PullRequestLink string
+	CommitLink      string
+}
+
+type deploymentRecord struct {
+	Version       string
+	UserFullname  string
+	UserEmail     string
+	PullRequestId int
+	Commit        *github.Commit
+}
+
+func (d *githubDeployer) History(serviceName, environmentName string, page int) ([]HistoryEntry, bool, error) {
+	ctx := context.Background()
+	if page < 1 {
+		page = 1
+	}
+
+	services, err := d.LookupServices([]string{serviceName})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(services) != 1 {
+		return nil, false, api.NewValidationErr(fmt.Sprintf("%s matches %d services, history requires a single service", serviceName, len(services)))
+	}
+
+	service := services[0]
+	environment, err := d.LookupEnvironment(service, environmentName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Fetch one entry more than needed from each timeline to know whether there is another page
+	limit := page*historyEntriesPerPage + 1
+
+	var deployments []HistoryEntry
+	err = d.walkDeployments(ctx, service, environment, func(record deploymentRecord) bool {
+		deployments = append(deployments, HistoryEntry{
+			Event:         HistoryEventDeploy,
+			Version:       record.Version,
+			UserFullname:  record.UserFullname,
+			UserEmail:     record.UserEmail,
+			Time:          record.Commit.Date,
+			PullRequestId: record.PullRequestId,
+			CommitLink:    record.Commit.Link,
+		})
+		return len(deployments) < limit
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var freezes []HistoryEntry
+	err = d.walkFreezeEvents(ctx, service, environment, getFreezeFilePath(*environment), func(entry HistoryEntry) bool {
+		freezes = append(freezes, entry)
+		return len(freezes) < limit
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var environmentFreezes []HistoryEntry
+	err = d.walkFreezeEvents(ctx, service, environment, d.getEnvironmentFreezeFilePath(environment.Name), func(entry HistoryEntry) bool {
+		environmentFreezes = append(environmentFreezes, entry)
+		return len(environmentFreezes) < limit
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := append(deployments, freezes...)
+	entries = append(entries, environmentFreezes...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+
+	start := (page - 1) * historyEntriesPerPage
+	if start >= len(entries) {
+		return nil, false, nil
+	}
+
+	end := min(start+historyEntriesPerPage, len(entries))
+	entries = entries[start:end]
+	for i := range entries {
+		if entries[i].PullRequestId != 0 {
+			entries[i].PullRequestLink = d.githubClient.PullRequestLink(entries[i].PullRequestId)
+		}
+	}
+
+	return entries, len(deployments)+len(freezes)+len(environmentFreezes) > end, nil
+}
+
+func (d *githubDeployer) findCurrentVersion(ctx context.Context, service *Service, environment *ServiceEnvironment) (ServiceVersion, error) {
+	var current string
+	err := d.walkDeployments(ctx, service, environment, func(record deploymentRecord) bool {
+		current = record.Version
+		return false
+	})
+	if err != nil {
+		return ServiceVersion{}, err
+	}
+
+	if current == "" {
+		return ServiceVersion{}, api.NewValidationErr(fmt.Sprintf("no deployment found for service %s in %s", service.Name, environment.Name))
+	}
+
+	return d.resolveVersion(ctx, service, current)
+}
+
+func (d *githubDeployer) findPreviousVersion(ctx context.Context, service *Service, environment *ServiceEnvironment) (ServiceVersion, error) {
+	var current, previous string
+	err := d.walkDeployments(ctx, service, environment, func(record deploymentRecord) bool {
+		if current == "" {
+			current = record.Version
+			return true
+		}
+
+		if !sameVersion(current, record.Version) {
+			previous = record.Version
+			return false
+		}
+
+		return true
+	})
+	if err != nil {
+		return ServiceVersion{}, err
+	}
+
+	if previous == "" {
+		return ServiceVersion{}, api.NewValidationErr(fmt.Sprintf("cannot rollback: no earlier deployment found for service %s in %s", service.Name, environment.Name))
+	}
+
+	return d.resolveVersion(ctx, service, previous)
+}
+
+func (d *githubDeployer) addDeploymentStatus(ctx context.Context, service *Service, environment *ServiceEnvironment, status *EnvironmentStatus) error {
+	var latest *deploymentRecord
+	err := d.walkDeployments(ctx, service, environment, func(record deploymentRecord) bool {
+		latest = &record
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	if latest == nil {
+		return nil
+	}
+
+	status.DeployedCommit = latest.Version
+	status.DeployedBy = latest.UserFullname
+	status.DeployedAt = latest.Commit.Date
+
+	version, err := d.resolveVersion(ctx, service, latest.Version)
+	if err != nil {
+		log.WithError(err).WithField("service", service.Name).Warn("Failed to resolve deployed version")
+		return nil
+	}
+
+	status.DeployedCommit = version.Commit
+	status.DeployedCommitUrl = version.CommitUrl
+	return nil
+}
+
+func (d *githubDeployer) resolveVersion(ctx context.Context, service *Service, version string) (ServiceVersion, error) {
+	commit, commitUrl, err := d.githubClient.GetCommitSha(ctx, service.GithubOrganization, service.GithubRepository, version)
+	if err != nil {
+		return ServiceVersion{}, fmt.Errorf("failed to resolve version %s for service %s, error: %w", version, service.Name, err)
+	}
+
+	return ServiceVersion{Commit: commit, CommitUrl: commitUrl}, nil
+}
+
+// walkDeployments calls fn for every deployment of the service environment, newest first, until fn returns false.
+func (d *githubDeployer) walkDeployments(ctx context.Context, service *Service, environment *ServiceEnvironment, fn func(record deploymentRecord) bool) error {
+	err := d.walkCommits(ctx, environment.DeploymentRepoBranch, environment.GeneratedPath, func(commit *github.Commit) bool {
+		record, ok := parseDeploymentCommit(commit, service.Name)
+		if !ok {
+			return true
+		}
+
+		return fn(record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list deployment history for service %s, error: %w", service.Name, err)
+	}
+
+	return nil
+}
+
+// walkFreezeEvents calls fn for every freeze and unfreeze of the freeze file in the folder, newest first, until fn
+// returns false. The folder is either the freeze folder of the service environment or that of the whole environment.
+func (d *githubDeployer) walkFreezeEvents(ctx context.Context, service *Service, environment *ServiceEnvironment, freezeFilePath string, fn func(entry HistoryEntry) bool) error {
+	freezeFile := path.Join(freezeFilePath, freezeFileName)
+	err := d.walkCommits(ctx, environment.DeploymentRepoBranch, freezeFile, func(commit *github.Commit) bool {
+		entry, ok := parseFreezeCommit(commit)
+		if !ok {
+			return true
+		}
+
+		return fn(entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list freeze history for service %s, error: %w", service.Name, err)
+	}
+
+	return nil
+}
+
+func (d *githubDeployer) walkCommits(ctx context.Context, branch, filePath string, fn func(commit *github.Commit) bool) error {
+	for page := 1; page <= historyMaxPages; page++ {
+		commits, err := d.githubClient.ListCommits(ctx, branch, filePath, page, historyPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, commit := range commits {
+			if !fn(commit) {
+				return nil
+			}
+		}
+
+		if len(commits) < historyPageSize {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func parseDeploymentCommit(commit *github.Commit, serviceName string) (deploymentRecord, bool) {
+	title, _, _ := strings.Cut(commit.Message, "\n")
+	match := deployCommitPattern.FindStringSubmatch(strings.TrimSpace(title))
+	if match == nil {
+		return deploymentRecord{}, false
+	}
+
+	version := match[3]
+	if version == "" {
+		for _, serviceVersion := range strings.Split(match[1], ",") {
+			name, serviceCommit, found := strings.Cut(serviceVersion, "@")
+			if found && name == serviceName {
+				version = serviceCommit
+				break
+			}
+		}
+	}
+
+	if version == "" {
+		return deploymentRecord{}, false
+	}
+
+	prId, _ := strconv.Atoi(match[6])
+	userFullname, userEmail := commitRequester(commit, match[4], match[5], prId)
+	return deploymentRecord{
+		Version:       version,
+		UserFullname:  userFullname,
+		UserEmail:     userEmail,
+		PullRequestId: prId,
+		Commit:        commit,
+	}, true
+}
+
+func parseFreezeCommit(commit *github.Commit) (HistoryEntry, bool) {
+	title, _, _ := strings.Cut(commit.Message, "\n")
+	match := freezeCommitPattern.FindStringSubmatch(strings.TrimSpace(title))
+	if match == nil {
+		return HistoryEntry{}, false
+	}
+
+	prId, _ := strconv.Atoi(match[6])
+	userFullname, userEmail := commitRequester(commit, match[4], match[5], prId)
+	return HistoryEntry{
+		Event:         HistoryEvent(match[1]),
+		UserFullname:  userFullname,
+		UserEmail:     userEmail,
+		Time:          commit.Date,
+		PullRequestId: prId,
+		CommitLink:    commit.Link,
+	}, true
+}
+
+// commitRequester returns the user who requested the change of the commit. PushCommit authors the commit as the
+// requester, which is exact even for names the title pattern cannot split. Squash merges are authored by whoever the
+// platform picks, so the requester in their title is used unless the author matches it.
+func commitRequester(commit *github.Commit, titleFullname, titleEmail string, prId int) (string, string) {
+	if commit.AuthorEmail != "" && (prId == 0 || strings.EqualFold(commit.AuthorEmail, titleEmail)) {
+		return commit.AuthorName, commit.AuthorEmail
+	}
+
+	return titleFullname, titleEmail
+}
+
+func formatDeployTitle(servicesString, environmentName string, versions map[ServiceName]ServiceVersion, userFullname, userEmail string) string {
+	if commit, ok := singleVersion(versions); ok {
+		return fmt.Sprintf("Deploy %s to %s with version %s triggered by %s (%s)", servicesString, environmentName, shortSha(commit), userFullname, userEmail)
+	}
+
+	var serviceVersions []string
+	for _, name := range sortedServiceNames(versions) {
+		serviceVersions = append(serviceVersions, fmt.Sprintf("%s@%s", name, shortSha(versions[name].Commit)))
+	}
+
+	return fmt.Sprintf("Deploy %s to %s triggered by %s (%s)", strings.Join(serviceVersions, ","), environmentName, userFullname, userEmail)
+}
+
+func formatDeployCommits(versions map[ServiceName]ServiceVersion) string {
+	if _, ok := singleVersion(versions); ok {
+		for _, version := range versions {
+			return fmt.Sprintf("Commit: [%s](%s)", shortSha(version.Commit), version.CommitUrl)
+		}
+	}
+
+	lines := []string{"Commits:"}
+	for _, name := range sortedServiceNames(versions) {
+		version := versions[name]
+		lines = append(lines, fmt.Sprintf("- %s: [%s](%s)", name, shortSha(version.Commit), version.CommitUrl))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func singleVersion(versions map[ServiceName]ServiceVersion) (string, bool) {
+	var commit string
+	for _, version := range versions {
+		if commit != "" && commit != version.Commit {
+			return "", false
+		}
+		commit = version.Commit
+	}
+
+	return commit, true
+}
+
+func sortedServiceNames(versions map[ServiceName]ServiceVersion) []ServiceName {
+	names := make([]ServiceName, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	return names
+}
+
+func sameVersion(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func shortSha(commit string) string {
+	if len(commit) > shortShaLength {
+		return commit[:shortShaLength]
+	}
+
+	return commit
+}
@@ -0,0 +1,294 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/apono-io/argo-bot/pkg/github"
+	"github.com/apono-io/argo-bot/pkg/github/githubtest"
+)
+
+const (
+	testSecondCommit = "1123456789abcdef0123456789abcdef01234567"
+	testThirdCommit  = "2123456789abcdef0123456789abcdef01234567"
+)
+
+// newHistoryTestDeployer creates a deployer for users in prod with three consecutive service commits
+func newHistoryTestDeployer(t *testing.T) (*githubDeployer, func(commit string)) {
+	t.Helper()
+
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.AddServiceCommit(testOrganization, testRepository, testSecondCommit, testCommit)
+	client.AddServiceCommit(testOrganization, testRepository, testThirdCommit, testSecondCommit)
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+
+	deploy := func(commit string) {
+		t.Helper()
+
+		pr, _, err := deployer.Deploy([]string{"users"}, "prod", commit, "", testUserFullname, testUserEmail)
+		if err != nil {
+			t.Fatalf("deploy of %s failed: %v", commit, err)
+		}
+
+		if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	return deployer, deploy
+}
+
+func TestRollback(t *testing.T) {
+	deployer, deploy := newHistoryTestDeployer(t)
+	deploy(testCommit)
+	deploy(testSecondCommit)
+	deploy(testThirdCommit)
+
+	_, _, versions, err := deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+
+	if got := versions["users"].Commit; got != testSecondCommit {
+		t.Errorf("rollback version = %s, want %s", got, testSecondCommit)
+	}
+}
+
+func TestRollbackSkipsRedeployments(t *testing.T) {
+	deployer, deploy := newHistoryTestDeployer(t)
+	deploy(testCommit)
+	deploy(testSecondCommit)
+	deploy(testSecondCommit)
+
+	pr, _, versions, err := deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+
+	if got := versions["users"].Commit; got != testCommit {
+		t.Errorf("rollback version = %s, want %s", got, testCommit)
+	}
+
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	// The rollback is a deployment itself, rolling back again returns to the version it replaced
+	_, _, versions, err = deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("second rollback failed: %v", err)
+	}
+
+	if got := versions["users"].Commit; got != testSecondCommit {
+		t.Errorf("second rollback version = %s, want %s", got, testSecondCommit)
+	}
+}
+
+func TestRollbackWithoutEarlierDeployment(t *testing.T) {
+	deployer, deploy := newHistoryTestDeployer(t)
+
+	_, _, _, err := deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "cannot rollback: no earlier deployment found for service users in prod")
+
+	deploy(testCommit)
+	deploy(testCommit)
+
+	_, _, _, err = deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "cannot rollback: no earlier deployment found for service users in prod")
+}
+
+func TestRollbackFrozenService(t *testing.T) {
+	deployer, deploy := newHistoryTestDeployer(t)
+	deploy(testCommit)
+	deploy(testSecondCommit)
+
+	pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{Reason: "incident 123"})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	_, _, _, err = deployer.Rollback([]string{"users"}, "prod", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "services are frozen: users (incident 123")
+}
+
+func TestHistoryRequesterFromCommitAuthor(t *testing.T) {
+	const userFullname = "Jane Doe (she/her)"
+
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+
+	pr, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", userFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+
+	// A squash merge authored by the platform instead of the requester
+	client.WriteFiles("", "Deploy users to prod with version 1123456 triggered by John Roe (john@example.com) (#42)\n\nRequested by: John Roe",
+		map[string]string{"generated/prod/users/deployment.yaml": "image: users:1123456\n"})
+
+	history, _, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries, got %+v", history)
+	}
+
+	if entry := history[0]; entry.UserFullname != "John Roe" || entry.UserEmail != "john@example.com" || entry.PullRequestId != 42 {
+		t.Errorf("unexpected squash merge entry %+v", entry)
+	}
+	if entry := history[1]; entry.UserFullname != userFullname || entry.UserEmail != testUserEmail || entry.PullRequestId != pr.Id {
+		t.Errorf("unexpected deployment entry %+v", entry)
+	}
+}
+
+// writeDeployCommits commits squash merged deployments of users to prod straight to the deployment repository
+func writeDeployCommits(client *githubtest.Client, count int) {
+	for i := 1; i <= count; i++ {
+		title := fmt.Sprintf("Deploy users to prod with version %07x triggered by %s (%s) (#%d)", i, testUserFullname, testUserEmail, i)
+		client.WriteFiles("", title, map[string]string{"generated/prod/users/deployment.yaml": fmt.Sprintf("image: users:%07x\n", i)})
+	}
+}
+
+func TestHistoryPaging(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	writeDeployCommits(client, 2*historyEntriesPerPage)
+
+	history, hasMore, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != historyEntriesPerPage || !hasMore {
+		t.Fatalf("page 1 has %d entries and hasMore %v", len(history), hasMore)
+	}
+	if history[0].Version != "0000014" || history[0].PullRequestId != 20 {
+		t.Errorf("page 1 should start with the newest deployment, got %+v", history[0])
+	}
+
+	// The last page is full, there is nothing after it
+	history, hasMore, err = deployer.History("users", "prod", 2)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != historyEntriesPerPage || hasMore {
+		t.Fatalf("page 2 has %d entries and hasMore %v", len(history), hasMore)
+	}
+	if history[0].Version != "000000a" || history[len(history)-1].Version != "0000001" {
+		t.Errorf("page 2 = %s..%s, want 000000a..0000001", history[0].Version, history[len(history)-1].Version)
+	}
+
+	history, hasMore, err = deployer.History("users", "prod", 3)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 0 || hasMore {
+		t.Errorf("page 3 has %d entries and hasMore %v", len(history), hasMore)
+	}
+
+	writeDeployCommits(client, 1)
+	_, hasMore, err = deployer.History("users", "prod", 2)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if !hasMore {
+		t.Error("page 2 should have more entries after another deployment")
+	}
+}
+
+func TestHistoryInterleavesFreezes(t *testing.T) {
+	deployer, deploy := newHistoryTestDeployer(t)
+	approve := func(pr *github.PullRequest, err error) {
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	var want []HistoryEvent
+	for _, commit := range []string{testCommit, testSecondCommit, testThirdCommit} {
+		deploy(commit)
+		pr, _, err := deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+		approve(pr, err)
+		pr, _, err = deployer.FreezeEnvironment("prod", testUserFullname, testUserEmail, FreezeActionFreeze, FreezeDetails{})
+		approve(pr, err)
+		pr, _, err = deployer.Freeze([]string{"users"}, "prod", testUserFullname, testUserEmail, FreezeActionUnfreeze, FreezeDetails{})
+		approve(pr, err)
+		pr, _, err = deployer.FreezeEnvironment("prod", testUserFullname, testUserEmail, FreezeActionUnfreeze, FreezeDetails{})
+		approve(pr, err)
+
+		want = append([]HistoryEvent{HistoryEventUnfreeze, HistoryEventUnfreeze, HistoryEventFreeze, HistoryEventFreeze, HistoryEventDeploy}, want...)
+	}
+
+	var history []HistoryEntry
+	for page := 1; ; page++ {
+		entries, hasMore, err := deployer.History("users", "prod", page)
+		if err != nil {
+			t.Fatalf("history failed: %v", err)
+		}
+
+		history = append(history, entries...)
+		if !hasMore {
+			break
+		}
+	}
+
+	if len(history) != len(want) {
+		t.Fatalf("got %d history entries, want %d", len(history), len(want))
+	}
+
+	for i, entry := range history {
+		if entry.Event != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, entry.Event, want[i])
+		}
+		if i > 0 && !entry.Time.Before(history[i-1].Time) {
+			t.Errorf("entry %d at %s is not older than the entry before it", i, entry.Time)
+		}
+	}
+
+	if history[0].Event != HistoryEventUnfreeze || history[4].Version != "2123456" || history[14].Version != "0123456" {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
+
+// TestHistorySquashMergeRequester is a regression test for requesters of squash merged commits, whose title ends with
+// the pull request number, being parsed with the requester email as part of the name.
+func TestHistorySquashMergeRequester(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	client.WriteFiles("", "Deploy users to prod with version 0123456 triggered by Jane Doe (jane@example.com) (#7)",
+		map[string]string{"generated/prod/users/deployment.yaml": "image: users:0123456\n"})
+	client.WriteFiles("", "Deploy users to prod with version 1123456 triggered by John Roe (john@example.com) (!8)",
+		map[string]string{"generated/prod/users/deployment.yaml": "image: users:1123456\n"})
+	client.WriteFiles("", "freeze users on prod triggered by Jane Doe (jane@example.com) (#9)",
+		map[string]string{"templates/users/.freeze": "frozen\n"})
+
+	history, _, err := deployer.History("users", "prod", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history entries, got %+v", history)
+	}
+
+	for i, want := range []HistoryEntry{
+		{Event: HistoryEventFreeze, UserFullname: "Jane Doe", UserEmail: "jane@example.com", PullRequestId: 9},
+		{Event: HistoryEventDeploy, Version: "1123456", UserFullname: "John Roe", UserEmail: "john@example.com", PullRequestId: 8},
+		{Event: HistoryEventDeploy, Version: "0123456", UserFullname: "Jane Doe", UserEmail: "jane@example.com", PullRequestId: 7},
+	} {
+		got := history[i]
+		if got.Event != want.Event || got.Version != want.Version || got.UserFullname != want.UserFullname ||
+			got.UserEmail != want.UserEmail || got.PullRequestId != want.PullRequestId {
+			t.Errorf("entry %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
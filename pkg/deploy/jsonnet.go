@@ -0,0 +1,242 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultJsonnetEntrypoint = "main.jsonnet"
+	jsonnetArgoBotVariable   = "argoBot"
+
+	JsonnetOutputObject = "object"
+	JsonnetOutputSingle = "single"
+)
+
+func (d *githubDeployer) isJsonnet(templateFolder string, env *ServiceEnvironment) bool {
+	_, err := os.Stat(filepath.Join(templateFolder, jsonnetEntrypoint(env)))
+	return err == nil
+}
+
+func jsonnetEntrypoint(env *ServiceEnvironment) string {
+	if env.JsonnetEntrypoint != "" {
+		return env.JsonnetEntrypoint
+	}
+
+	return defaultJsonnetEntrypoint
+}
+
+// processJsonnet evaluates the entrypoint and writes the Kubernetes objects it returns as yaml files. The deployment
+// details are available both as the argoBot external variable and as the argoBot top level argument.
+func (d *githubDeployer) processJsonnet(baseFolder, templateFolder, generatedFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	argoBot, err := jsonnetArgoBotCode(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Imports resolve relative to the importing file, then the template folder, the library paths and the repository root
+	importPaths := []string{templateFolder}
+	for _, libPath := range env.JsonnetLibPaths {
+		importPaths = append(importPaths, filepath.Join(baseFolder, libPath))
+	}
+	importPaths = append(importPaths, baseFolder)
+
+	vm := jsonnet.MakeVM()
+	vm.Importer(&repositoryImporter{root: baseFolder, importer: &jsonnet.FileImporter{JPaths: importPaths}})
+	vm.ExtCode(jsonnetArgoBotVariable, argoBot)
+	vm.TLACode(jsonnetArgoBotVariable, argoBot)
+
+	output, err := vm.EvaluateFile(filepath.Join(templateFolder, jsonnetEntrypoint(env)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate jsonnet, error: %w", err)
+	}
+
+	var result any
+	err = json.Unmarshal([]byte(output), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]any
+	collectKubernetesObjects(result, &objects)
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("jsonnet %s did not return any kubernetes objects", jsonnetEntrypoint(env))
+	}
+
+	files := make(map[string][]map[string]any)
+	var fileNames []string
+	switch env.JsonnetOutput {
+	case JsonnetOutputObject, "":
+		for _, object := range objects {
+			fileName := jsonnetObjectFileName(object)
+			if _, exists := files[fileName]; exists {
+				return nil, fmt.Errorf("more than one object is written to %s, use the %s jsonnet output", fileName, JsonnetOutputSingle)
+			}
+			files[fileName] = []map[string]any{object}
+			fileNames = append(fileNames, fileName)
+		}
+	case JsonnetOutputSingle:
+		files[renderedManifestsFileName] = objects
+		fileNames = append(fileNames, renderedManifestsFileName)
+	default:
+		return nil, fmt.Errorf("unknown jsonnet output %s", env.JsonnetOutput)
+	}
+
+	var renderedFiles []string
+	for _, fileName := range fileNames {
+		content, err := marshalYamlDocuments(files[fileName])
+		if err != nil {
+			return nil, err
+		}
+
+		absolutePath := filepath.Join(generatedFolder, fileName)
+		err = os.WriteFile(absolutePath, content, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		relPath, err := filepath.Rel(baseFolder, absolutePath)
+		if err != nil {
+			return nil, err
+		}
+		renderedFiles = append(renderedFiles, relPath)
+	}
+
+	return renderedFiles, nil
+}
+
+// repositoryImporter limits jsonnet imports to files of the deployment repository, so templates cannot read files of
+// the bot host such as its configuration.
+type repositoryImporter struct {
+	root     string
+	importer jsonnet.Importer
+}
+
+func (i *repositoryImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	// Absolute paths are checked before they are read, the entrypoint is imported by its absolute path
+	if filepath.IsAbs(importedPath) {
+		inside, err := isWithinFolder(i.root, importedPath)
+		if err != nil || !inside {
+			return jsonnet.Contents{}, "", fmt.Errorf("import %s is outside the deployment repository", importedPath)
+		}
+	}
+
+	contents, foundAt, err := i.importer.Import(importedFrom, importedPath)
+	if err != nil {
+		return jsonnet.Contents{}, "", err
+	}
+
+	inside, err := isWithinFolder(i.root, foundAt)
+	if err != nil {
+		return jsonnet.Contents{}, "", err
+	}
+	if !inside {
+		return jsonnet.Contents{}, "", fmt.Errorf("import %s is outside the deployment repository", importedPath)
+	}
+
+	return contents, foundAt, nil
+}
+
+// isWithinFolder reports whether the path is inside the folder once symbolic links are resolved
+func isWithinFolder(folder, path string) (bool, error) {
+	resolvedFolder, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		return false, err
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+
+	relPath, err := filepath.Rel(resolvedFolder, resolvedPath)
+	if err != nil {
+		return false, nil
+	}
+
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)), nil
+}
+
+// jsonnetArgoBotCode returns the deployment details as a jsonnet object with the keys of the Helm argoBot values,
+// including the deploy metadata.
+func jsonnetArgoBotCode(opts options) (string, error) {
+	content, err := yaml.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+
+	var values map[string]any
+	err = yaml.Unmarshal(content, &values)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal argoBot variable, error: %w", err)
+	}
+
+	return string(code), nil
+}
+
+// collectKubernetesObjects walks the jsonnet output, anything with an apiVersion and a kind is an object, other
+// arrays and objects are searched for nested objects. Items of list kinds are written as separate objects.
+func collectKubernetesObjects(value any, objects *[]map[string]any) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			collectKubernetesObjects(item, objects)
+		}
+	case map[string]any:
+		kind, hasKind := v["kind"].(string)
+		_, hasApiVersion := v["apiVersion"].(string)
+		if !hasKind || !hasApiVersion {
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				collectKubernetesObjects(v[key], objects)
+			}
+			return
+		}
+
+		if items, ok := v["items"].([]any); ok && strings.HasSuffix(kind, "List") {
+			collectKubernetesObjects(items, objects)
+			return
+		}
+
+		*objects = append(*objects, v)
+	}
+}
+
+func jsonnetObjectFileName(object map[string]any) string {
+	name := ""
+	if metadata, ok := object["metadata"].(map[string]any); ok {
+		name, _ = metadata["name"].(string)
+	}
+
+	return strings.ToLower(fmt.Sprintf("%s-%s.yaml", object["kind"], name))
+}
+
+func marshalYamlDocuments(documents []map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
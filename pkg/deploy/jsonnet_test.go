@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJsonnetLibrary = `{
+  deployment(name, image, replicas):: {
+    apiVersion: 'apps/v1',
+    kind: 'Deployment',
+    metadata: { name: name },
+    spec: { replicas: replicas, template: { spec: { containers: [{ name: name, image: image }] } } },
+  },
+}
+`
+
+const testJsonnetMain = `local k = import 'k.libsonnet';
+local labels = import 'labels.libsonnet';
+function(argoBot) {
+  deployment: k.deployment(argoBot.serviceName, 'users:' + std.extVar('argoBot').version, argoBot.values.replicas) + { metadata+: { labels: labels } },
+  services: [{ apiVersion: 'v1', kind: 'Service', metadata: { name: argoBot.serviceName, namespace: argoBot.environment } }],
+}
+`
+
+func TestDeployJsonnet(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.Values = map[string]any{"replicas": 3}
+	environment.JsonnetLibPaths = []string{"jsonnet/lib"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add jsonnet", map[string]string{
+		"jsonnet/lib/k.libsonnet":              testJsonnetLibrary,
+		"templates/users/main.jsonnet":         testJsonnetMain,
+		"templates/users/labels.libsonnet":     "{ team: 'platform' }\n",
+		"generated/prod/users/old-object.yaml": "kind: ConfigMap\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	files := client.Files("")
+	wantDeployment := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    team: platform\n  name: users\n" +
+		"spec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n        - image: users:" + testCommit + "\n          name: users\n"
+	if got := files["generated/prod/users/deployment-users.yaml"]; got != wantDeployment {
+		t.Errorf("deployment = %q, want %q", got, wantDeployment)
+	}
+
+	if got := files["generated/prod/users/service-users.yaml"]; !strings.Contains(got, "namespace: prod") {
+		t.Errorf("service = %q", got)
+	}
+
+	for _, unexpected := range []string{"generated/prod/users/old-object.yaml", "generated/prod/users/main.jsonnet"} {
+		if _, ok := files[unexpected]; ok {
+			t.Errorf("unexpected file %s", unexpected)
+		}
+	}
+}
+
+func TestDeployJsonnetSingleOutput(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.JsonnetEntrypoint = "users.jsonnet"
+	environment.JsonnetOutput = JsonnetOutputSingle
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add jsonnet", map[string]string{
+		"templates/users/users.jsonnet": `{ apiVersion: 'v1', kind: 'List', items: [
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'a' } },
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'b' } },
+] }`,
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n"
+	if got := client.Files("")["generated/prod/users/"+renderedManifestsFileName]; got != want {
+		t.Errorf("manifests = %q, want %q", got, want)
+	}
+}
+
+func TestDeployJsonnetImportsOutsideRepository(t *testing.T) {
+	for _, importPath := range []string{"secret.txt", "../../../secret.txt", "/proc/self/environ"} {
+		deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+		// The repository is cloned into a folder of the clone directory, next to the secret
+		secret := filepath.Join(deployer.config.Github.CloneTmpDir, "secret.txt")
+		if err := os.WriteFile(secret, []byte("token"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if importPath == "secret.txt" {
+			importPath = secret
+		}
+
+		client.WriteFiles("", "Add jsonnet", map[string]string{
+			"templates/users/main.jsonnet": "{ apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'users' }, data: { token: importstr '" + importPath + "' } }\n",
+		})
+
+		_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+		if err == nil || !strings.Contains(err.Error(), "outside the deployment repository") {
+			t.Errorf("expected import of %s to be rejected, got %v", importPath, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	kustomizeServiceLabel        = "argo-bot/service"
+	kustomizeEnvironmentLabel    = "argo-bot/environment"
+	kustomizeVersionAnnotation   = "argo-bot/version"
+	kustomizeImagesKey           = "images"
+	kustomizeLabelsKey           = "labels"
+	kustomizeCommonAnnotationKey = "commonAnnotations"
+)
+
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+func (d *githubDeployer) isKustomization(templateFolder string) bool {
+	_, found := findKustomizationFile(templateFolder)
+	return found
+}
+
+// processKustomization copies the kustomization to the generated folder and pins it to the deployed version. With
+// KustomizeBuild the kustomization is pinned in place and only the built manifests are written, which keeps overlays
+// referencing bases outside the template folder working.
+func (d *githubDeployer) processKustomization(baseFolder, templateFolder, generatedFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	if env.KustomizeBuild {
+		kustomizationFile, _ := findKustomizationFile(templateFolder)
+		err := updateKustomization(kustomizationFile, opts.ServiceName, opts.Environment, opts.Version, env.KustomizeImages)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests, err := buildKustomization(templateFolder)
+		if err != nil {
+			return nil, err
+		}
+
+		manifestsPath := filepath.Join(generatedFolder, renderedManifestsFileName)
+		err = os.WriteFile(manifestsPath, manifests, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		relPath, err := filepath.Rel(baseFolder, manifestsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{relPath}, nil
+	}
+
+	copiedFiles, err := d.copyDirectory(baseFolder, templateFolder, generatedFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	kustomizationFile, _ := findKustomizationFile(generatedFolder)
+	err = updateKustomization(kustomizationFile, opts.ServiceName, opts.Environment, opts.Version, env.KustomizeImages)
+	if err != nil {
+		return nil, err
+	}
+
+	return copiedFiles, nil
+}
+
+func findKustomizationFile(folder string) (string, bool) {
+	for _, name := range kustomizationFileNames {
+		path := filepath.Join(folder, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func buildKustomization(folder string) ([]byte, error) {
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kustomization, error: %w", err)
+	}
+
+	return resources.AsYaml()
+}
+
+// kustomizeImage is an entry of the images field
+type kustomizeImage struct {
+	Name   string `yaml:"name"`
+	NewTag string `yaml:"newTag"`
+}
+
+// kustomizeLabels is an entry of the labels field, unlike commonLabels it leaves the selectors of the resources as
+// they are, as changing them is rejected for existing deployments
+type kustomizeLabels struct {
+	Pairs            map[string]string `yaml:"pairs"`
+	IncludeSelectors bool              `yaml:"includeSelectors"`
+	IncludeTemplates bool              `yaml:"includeTemplates"`
+}
+
+// updateKustomization sets the tag of the deployed images and labels the resources with the deployment details. Like
+// patchFile, only the bytes of the changed values are replaced and new entries are inserted as lines, so comments and
+// formatting of the kustomization stay as they are. When no image names are configured, every image already listed in
+// the kustomization is pinned.
+func updateKustomization(path, serviceName, environment, commit string, imageNames []string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	updated, err := editKustomization(content, serviceName, environment, commit, imageNames)
+	if err != nil {
+		return fmt.Errorf("failed to update kustomization %s, error: %w", filepath.Base(path), err)
+	}
+
+	return os.WriteFile(path, updated, 0644)
+}
+
+func editKustomization(content []byte, serviceName, environment, commit string, imageNames []string) ([]byte, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(document.Content) > 0 {
+		root = document.Content[0]
+	}
+	if root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+		return nil, errors.New("kustomization must be a block mapping")
+	}
+
+	editor := &yamlEditor{content: content, lineOffsets: yamlLineOffsets(content)}
+	if err = editor.pinImages(root, commit, imageNames); err != nil {
+		return nil, err
+	}
+
+	labels := kustomizeLabels{
+		Pairs:            map[string]string{kustomizeServiceLabel: serviceName, kustomizeEnvironmentLabel: environment},
+		IncludeTemplates: true,
+	}
+	if err = editor.appendToSequence(root, kustomizeLabelsKey, labels); err != nil {
+		return nil, err
+	}
+
+	if err = editor.setMappingEntry(root, kustomizeCommonAnnotationKey, kustomizeVersionAnnotation, commit); err != nil {
+		return nil, err
+	}
+
+	return editor.apply(), nil
+}
+
+func (e *yamlEditor) pinImages(root *yaml.Node, commit string, imageNames []string) error {
+	pinned := func(image *yaml.Node) bool {
+		name := lookupMappingKey(image, "name")
+		return len(imageNames) == 0 || (name != nil && slices.Contains(imageNames, name.Value))
+	}
+
+	var missing []kustomizeImage
+	images := lookupMappingKey(root, kustomizeImagesKey)
+	for _, name := range imageNames {
+		if images == nil || findImage(images, name) == nil {
+			missing = append(missing, kustomizeImage{Name: name, NewTag: commit})
+		}
+	}
+
+	if images == nil || !isBlockCollection(images, yaml.SequenceNode) {
+		if len(missing) == 0 && (images == nil || len(images.Content) == 0) {
+			return nil
+		}
+
+		return e.setValue(root, kustomizeImagesKey, images, yaml.SequenceNode, func(value *yaml.Node) error {
+			for _, image := range value.Content {
+				if pinned(image) {
+					setMappingScalar(image, "newTag", commit)
+				}
+			}
+			return appendEncoded(value, missing)
+		})
+	}
+
+	for _, image := range images.Content {
+		if !pinned(image) {
+			continue
+		}
+
+		if err := e.setScalar(image, "newTag", commit); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return e.insertBlock(e.nodeEnd(images), images.Column-1, missing)
+}
+
+// appendToSequence adds the item at the end of the sequence of the key
+func (e *yamlEditor) appendToSequence(root *yaml.Node, key string, item any) error {
+	sequence := lookupMappingKey(root, key)
+	if sequence == nil || !isBlockCollection(sequence, yaml.SequenceNode) {
+		return e.setValue(root, key, sequence, yaml.SequenceNode, func(value *yaml.Node) error {
+			return appendEncoded(value, []any{item})
+		})
+	}
+
+	return e.insertBlock(e.nodeEnd(sequence), sequence.Column-1, []any{item})
+}
+
+// setMappingEntry sets the entry of the mapping of the key
+func (e *yamlEditor) setMappingEntry(root *yaml.Node, key, entryKey, entryValue string) error {
+	mapping := lookupMappingKey(root, key)
+	if mapping == nil || !isBlockCollection(mapping, yaml.MappingNode) {
+		return e.setValue(root, key, mapping, yaml.MappingNode, func(value *yaml.Node) error {
+			setMappingScalar(value, entryKey, entryValue)
+			return nil
+		})
+	}
+
+	return e.setScalar(mapping, entryKey, entryValue)
+}
+
+// setValue sets a value that is missing, empty or written in flow style. A missing key is added at the end of the
+// root mapping, other values are rewritten in flow style on the line of their key.
+func (e *yamlEditor) setValue(root *yaml.Node, key string, value *yaml.Node, kind yaml.Kind, update func(value *yaml.Node) error) error {
+	if value == nil {
+		value = &yaml.Node{Kind: kind}
+		if err := update(value); err != nil {
+			return err
+		}
+
+		return e.insertBlock(len(e.content), 0, map[string]*yaml.Node{key: value})
+	}
+
+	start, end, err := e.inlineRange(value)
+	if err != nil {
+		return fmt.Errorf("%s, error: %w", key, err)
+	}
+
+	if value.Kind != kind {
+		if value.Tag != "!!null" {
+			return fmt.Errorf("%s at line %d has an unexpected type", key, value.Line)
+		}
+		value.Kind, value.Tag, value.Value = kind, "", ""
+	}
+
+	if err = update(value); err != nil {
+		return err
+	}
+
+	value.Style = yaml.FlowStyle
+	text, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	flow := strings.TrimSuffix(string(text), "\n")
+	if start == end {
+		// An empty value, e.g. "images:"
+		flow = " " + flow
+	}
+
+	e.edits = append(e.edits, yamlEdit{start: start, end: end, text: flow})
+	return nil
+}
+
+func appendEncoded[T any](sequence *yaml.Node, items []T) error {
+	for _, item := range items {
+		var node yaml.Node
+		if err := node.Encode(item); err != nil {
+			return err
+		}
+		sequence.Content = append(sequence.Content, &node)
+	}
+
+	return nil
+}
+
+func findImage(images *yaml.Node, name string) *yaml.Node {
+	for _, image := range images.Content {
+		if image.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(image.Content); i += 2 {
+			if image.Content[i].Value == "name" && image.Content[i+1].Value == name {
+				return image
+			}
+		}
+	}
+
+	return nil
+}
+
+func setMappingScalar(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1].Kind = yaml.ScalarNode
+			mapping.Content[i+1].Tag = "!!str"
+			mapping.Content[i+1].Value = value
+			return
+		}
+	}
+
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKustomization = `# Users service overlay
+resources:
+  - deployment.yaml
+images:
+  - name: registry.example.com/users # pinned by argo-bot
+    newTag: latest
+  - name: registry.example.com/sidecar
+    newTag: "1.2"
+`
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: users
+spec:
+  selector:
+    matchLabels:
+      app: users
+  template:
+    metadata:
+      labels:
+        app: users
+    spec:
+      containers:
+        - name: users
+          image: registry.example.com/users
+        - name: sidecar
+          image: registry.example.com/sidecar
+`
+
+func TestDeployKustomization(t *testing.T) {
+	environment := testEnvironment("staging", "users")
+	environment.KustomizeImages = []string{"registry.example.com/users"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add kustomization", map[string]string{
+		"templates/users/kustomization.yaml": testKustomization,
+		"templates/users/deployment.yaml":    testDeployment,
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	files := client.Files("")
+	if files["generated/staging/users/deployment.yaml"] != testDeployment {
+		t.Errorf("resources should be copied as is, got:\n%s", files["generated/staging/users/deployment.yaml"])
+	}
+
+	want := `# Users service overlay
+resources:
+  - deployment.yaml
+images:
+  - name: registry.example.com/users # pinned by argo-bot
+    newTag: ` + testCommit + `
+  - name: registry.example.com/sidecar
+    newTag: "1.2"
+labels:
+  - pairs:
+      argo-bot/environment: staging
+      argo-bot/service: users
+    includeSelectors: false
+    includeTemplates: true
+commonAnnotations:
+  argo-bot/version: ` + testCommit + `
+`
+	if got := files["generated/staging/users/kustomization.yaml"]; got != want {
+		t.Errorf("kustomization = %q, want %q", got, want)
+	}
+
+	if files["templates/users/kustomization.yaml"] != testKustomization {
+		t.Error("template kustomization should not be changed")
+	}
+}
+
+func TestDeployKustomizationBuild(t *testing.T) {
+	environment := testEnvironment("staging", "users")
+	environment.TemplatePath = "kustomize/users/overlays/staging"
+	environment.KustomizeBuild = true
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add kustomization", map[string]string{
+		"kustomize/users/base/kustomization.yaml":             "resources:\n  - deployment.yaml\n",
+		"kustomize/users/base/deployment.yaml":                testDeployment,
+		"kustomize/users/overlays/staging/kustomization.yaml": "resources:\n  - ../../base\nimages:\n  - name: registry.example.com/users\n",
+		"generated/staging/users/deployment.yaml":             testDeployment,
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	files := client.Files("")
+	if _, ok := files["generated/staging/users/deployment.yaml"]; ok {
+		t.Error("previously generated files should be replaced by the built manifests")
+	}
+
+	manifests := files["generated/staging/users/"+renderedManifestsFileName]
+	for _, want := range []string{
+		"image: registry.example.com/users:" + testCommit,
+		"image: registry.example.com/sidecar\n",
+		"argo-bot/version: " + testCommit,
+		"argo-bot/service: users",
+		"selector:\n    matchLabels:\n      app: users\n  template:",
+	} {
+		if !strings.Contains(manifests, want) {
+			t.Errorf("manifests do not contain %q:\n%s", want, manifests)
+		}
+	}
+
+	if _, ok := files["kustomize/users/overlays/staging/kustomization.yaml"]; !ok || strings.Contains(files["kustomize/users/overlays/staging/kustomization.yaml"], testCommit) {
+		t.Error("template kustomization should not be changed")
+	}
+}
+
+func TestEditKustomization(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		imageNames []string
+		want       string
+		wantErr    string
+	}{
+		{
+			name:       "empty",
+			content:    "",
+			imageNames: []string{"users"},
+			want: "images:\n  - name: users\n    newTag: \"1234567\"\nlabels:\n  - pairs:\n      argo-bot/environment: staging\n      argo-bot/service: users\n" +
+				"    includeSelectors: false\n    includeTemplates: true\ncommonAnnotations:\n  argo-bot/version: \"1234567\"\n",
+		},
+		{
+			name:       "flow style and empty values",
+			content:    "resources: [deployment.yaml]\nimages: # pinned\ncommonAnnotations: {team: identity}\nlabels: []",
+			imageNames: []string{"users"},
+			want: "resources: [deployment.yaml]\nimages: [{name: users, newTag: \"1234567\"}] # pinned\ncommonAnnotations: {team: identity, argo-bot/version: \"1234567\"}\n" +
+				"labels: [{pairs: {argo-bot/environment: staging, argo-bot/service: users}, includeSelectors: false, includeTemplates: true}]",
+		},
+		{
+			name:    "existing entries",
+			content: "images:\n- name: users\n  newTag:\nlabels:\n- pairs:\n    team: identity\ncommonAnnotations:\n  note: |\n    multi\n    line\n# trailing comment\n",
+			want: "images:\n- name: users\n  newTag: \"1234567\"\nlabels:\n- pairs:\n    team: identity\n- pairs:\n    argo-bot/environment: staging\n    argo-bot/service: users\n" +
+				"  includeSelectors: false\n  includeTemplates: true\ncommonAnnotations:\n  note: |\n    multi\n    line\n  argo-bot/version: \"1234567\"\n# trailing comment\n",
+		},
+		{
+			name:    "multi line flow collection",
+			content: "commonAnnotations: {\n  team: identity\n}\n",
+			wantErr: "must be on a single line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editKustomization([]byte(tt.content), "users", "staging", "1234567", tt.imageNames)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("kustomization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
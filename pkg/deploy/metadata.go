@@ -0,0 +1,193 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/github"
+	"gopkg.in/yaml.v3"
+)
+
+// deployMetadataKeys are the argoBot keys that change with every deployment, even of the same version. Helm values only
+// get them with helmDeployMetadata, otherwise every deployment and dry run would change the generated values file.
+var deployMetadataKeys = []string{"deployedAt", "requestedBy", "requestedByEmail", "pullRequest"}
+
+// deployMetadata describes the deployment request, it is shared by all the services deployed together.
+type deployMetadata struct {
+	DeployedAt       time.Time
+	RequestedBy      string
+	RequestedByEmail string
+	PullRequest      int
+	// EmergencyJustification is set for emergency deployments, which are not blocked by freezes
+	EmergencyJustification string
+}
+
+// options is the data available to Go templates and jsonnet. The same fields, without the deploy metadata unless
+// enabled, are written to the argoBot section of Helm values.
+type options struct {
+	ServiceName       string         `yaml:"serviceName"`
+	Environment       string         `yaml:"environment"`
+	Version           string         `yaml:"version"`
+	ShortVersion      string         `yaml:"shortVersion"`
+	CommitUrl         string         `yaml:"commitUrl,omitempty"`
+	CommitAuthor      string         `yaml:"commitAuthor,omitempty"`
+	CommitAuthorEmail string         `yaml:"commitAuthorEmail,omitempty"`
+	CommitMessage     string         `yaml:"commitMessage,omitempty"`
+	DeployedAt        string         `yaml:"deployedAt"`
+	RequestedBy       string         `yaml:"requestedBy,omitempty"`
+	RequestedByEmail  string         `yaml:"requestedByEmail,omitempty"`
+	PullRequest       int            `yaml:"pullRequest,omitempty"`
+	Values            map[string]any `yaml:"values,omitempty"`
+}
+
+func (d *githubDeployer) templateOptions(ctx context.Context, service *Service, environment *ServiceEnvironment, environmentName string, version ServiceVersion, metadata deployMetadata) (options, error) {
+	commit, err := d.githubClient.GetCommit(ctx, service.GithubOrganization, service.GithubRepository, version.Commit)
+	if err != nil {
+		return options{}, fmt.Errorf("failed to get commit %s of service %s, error: %w", version.Commit, service.Name, err)
+	}
+
+	commitUrl := version.CommitUrl
+	if commitUrl == "" {
+		commitUrl = commit.Link
+	}
+
+	return options{
+		ServiceName:       service.Name,
+		Environment:       environmentName,
+		Version:           version.Commit,
+		ShortVersion:      shortSha(version.Commit),
+		CommitUrl:         commitUrl,
+		CommitAuthor:      commit.AuthorName,
+		CommitAuthorEmail: commit.AuthorEmail,
+		CommitMessage:     commitTitle(commit),
+		DeployedAt:        metadata.DeployedAt.Format(time.RFC3339),
+		RequestedBy:       metadata.RequestedBy,
+		RequestedByEmail:  metadata.RequestedByEmail,
+		PullRequest:       metadata.PullRequest,
+		Values:            mergeValues(service.Values, environment.Values),
+	}, nil
+}
+
+// helmArgoBotValues returns the argoBot section of Helm values, keeping the field order of the options
+func helmArgoBotValues(opts options, env *ServiceEnvironment) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(opts); err != nil {
+		return nil, fmt.Errorf("failed to marshal argoBot values: %w", err)
+	}
+
+	if env.HelmDeployMetadata {
+		return &node, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); {
+		if slices.Contains(deployMetadataKeys, node.Content[i].Value) {
+			node.Content = slices.Delete(node.Content, i, i+2)
+			continue
+		}
+		i += 2
+	}
+
+	return &node, nil
+}
+
+// referencesPullRequest reports whether the pull request number may end up in the rendered files, which then have to
+// be rendered again once the pull request is opened. Template files are searched for the name of the variable.
+func (d *githubDeployer) referencesPullRequest(baseFolder string, serviceToEnvironment map[*Service]*ServiceEnvironment) (bool, error) {
+	for _, environment := range serviceToEnvironment {
+		if len(environment.PatchPaths) > 0 {
+			continue
+		}
+
+		if d.isHelmChart(filepath.Join(baseFolder, environment.TemplatePath)) {
+			if environment.HelmDeployMetadata {
+				return true, nil
+			}
+			continue
+		}
+
+		folders := append([]string{environment.TemplatePath}, environment.JsonnetLibPaths...)
+		if d.config.SharedTemplatesPath != "" {
+			folders = append(folders, d.config.SharedTemplatesPath)
+		}
+
+		for _, folder := range folders {
+			found, err := folderContains(filepath.Join(baseFolder, folder), []byte("pullrequest"))
+			if err != nil {
+				return false, fmt.Errorf("failed to search templates of %s, error: %w", environment.TemplatePath, err)
+			}
+
+			if found {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// folderContains reports whether a file in the folder contains the lower case text, ignoring case. A missing folder
+// contains nothing.
+func folderContains(folder string, text []byte) (bool, error) {
+	found := false
+	err := filepath.WalkDir(folder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Contains(bytes.ToLower(content), text) {
+			found = true
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return found, err
+}
+
+func commitTitle(commit *github.Commit) string {
+	title, _, _ := strings.Cut(commit.Message, "\n")
+	return strings.TrimSpace(title)
+}
+
+// mergeValues returns the values with the overrides applied, nested maps are merged key by key
+// while any other value, including lists, is replaced.
+func mergeValues(values, overrides map[string]any) map[string]any {
+	if len(values) == 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]any, len(values)+len(overrides))
+	for key, value := range values {
+		merged[key] = value
+	}
+
+	for key, override := range overrides {
+		current, currentIsMap := merged[key].(map[string]any)
+		overrideMap, overrideIsMap := override.(map[string]any)
+		if currentIsMap && overrideIsMap {
+			merged[key] = mergeValues(current, overrideMap)
+			continue
+		}
+
+		merged[key] = override
+	}
+
+	return merged
+}
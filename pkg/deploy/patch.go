@@ -0,0 +1,565 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlPathSegment is a single step of a yaml path, a mapping key optionally followed by a sequence selector such as
+// [0] or [name=image.tag]
+type yamlPathSegment struct {
+	key           string
+	hasSelector   bool
+	index         int
+	selectorKey   string
+	selectorValue string
+}
+
+// patchFile sets the nodes at the configured yaml paths of GeneratedPath to the deployed version. Only the bytes of the
+// patched scalars are replaced, so comments, ordering and formatting of the file stay as they are.
+func (d *githubDeployer) patchFile(baseFolder string, env *ServiceEnvironment, opts options) ([]string, error) {
+	filePath := filepath.Join(baseFolder, env.GeneratedPath)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patched file %s, error: %w", env.GeneratedPath, err)
+	}
+
+	patched, err := patchYamlPaths(content, env.PatchPaths, opts.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch %s, error: %w", env.GeneratedPath, err)
+	}
+
+	err = os.WriteFile(filePath, patched, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{env.GeneratedPath}, nil
+}
+
+func patchYamlPaths(content []byte, paths []string, value string) ([]byte, error) {
+	var documents []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		documents = append(documents, &document)
+	}
+
+	var nodes []*yaml.Node
+	for _, yamlPath := range paths {
+		segments, err := parseYamlPath(yamlPath)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, document := range documents {
+			if len(document.Content) == 0 {
+				continue
+			}
+
+			node := lookupYamlPath(document.Content[0], segments)
+			if node == nil {
+				continue
+			}
+
+			if node.Kind != yaml.ScalarNode || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) != 0 {
+				return nil, fmt.Errorf("yaml path %s must point to a single line scalar", yamlPath)
+			}
+
+			nodes = append(nodes, node)
+			found = true
+		}
+
+		if !found {
+			return nil, fmt.Errorf("yaml path %s was not found", yamlPath)
+		}
+	}
+
+	lineOffsets := yamlLineOffsets(content)
+	styles := make(map[[2]int]yaml.Style)
+	for _, node := range nodes {
+		start, end, err := scalarRange(content, lineOffsets, node)
+		if err != nil {
+			return nil, err
+		}
+		styles[[2]int{start, end}] = node.Style
+	}
+
+	ranges := slices.Collect(maps.Keys(styles))
+	slices.SortFunc(ranges, func(a, b [2]int) int { return b[0] - a[0] })
+
+	// Replace from the end of the file so the offsets of the remaining scalars stay valid
+	patched := slices.Clone(content)
+	for _, r := range ranges {
+		patched = slices.Replace(patched, r[0], r[1], []byte(formatScalar(value, styles[r]))...)
+	}
+
+	return patched, nil
+}
+
+// parseYamlPath splits a path like spec.source.helm.parameters[name=image.tag].value, dots inside selectors are part of
+// the selector value.
+func parseYamlPath(yamlPath string) ([]yamlPathSegment, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range yamlPath {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == '.' && depth == 0:
+			parts = append(parts, yamlPath[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, yamlPath[start:])
+
+	var segments []yamlPathSegment
+	for _, part := range parts {
+		segment := yamlPathSegment{key: part}
+		if open := strings.Index(part, "["); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("invalid yaml path %s", yamlPath)
+			}
+
+			segment.key = part[:open]
+			segment.hasSelector = true
+			selector := part[open+1 : len(part)-1]
+			if key, selectorValue, ok := strings.Cut(selector, "="); ok {
+				segment.selectorKey, segment.selectorValue = key, selectorValue
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector [%s] in yaml path %s", selector, yamlPath)
+				}
+				segment.index = index
+			}
+		}
+
+		if segment.key == "" && !segment.hasSelector {
+			return nil, fmt.Errorf("invalid yaml path %s", yamlPath)
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func lookupYamlPath(node *yaml.Node, segments []yamlPathSegment) *yaml.Node {
+	for _, segment := range segments {
+		if segment.key != "" {
+			node = lookupMappingKey(node, segment.key)
+			if node == nil {
+				return nil
+			}
+		}
+
+		if segment.hasSelector {
+			node = selectSequenceItem(node, segment)
+			if node == nil {
+				return nil
+			}
+		}
+	}
+
+	return node
+}
+
+func lookupMappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func selectSequenceItem(node *yaml.Node, segment yamlPathSegment) *yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	if segment.selectorKey == "" {
+		if segment.index < 0 || segment.index >= len(node.Content) {
+			return nil
+		}
+		return node.Content[segment.index]
+	}
+
+	for _, item := range node.Content {
+		value := lookupMappingKey(item, segment.selectorKey)
+		if value != nil && value.Kind == yaml.ScalarNode && value.Value == segment.selectorValue {
+			return item
+		}
+	}
+
+	return nil
+}
+
+func yamlLineOffsets(content []byte) []int {
+	offsets := []int{0}
+	for i, b := range content {
+		if b == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+
+	return offsets
+}
+
+// yamlOffset returns the offset of the start of the node in the file.
+func yamlOffset(content []byte, lineOffsets []int, node *yaml.Node) (int, error) {
+	if node.Line < 1 || node.Line > len(lineOffsets) {
+		return 0, fmt.Errorf("failed to locate yaml node at line %d", node.Line)
+	}
+
+	// Columns are counted in characters
+	start := lineOffsets[node.Line-1]
+	for column := 1; column < node.Column && start < len(content); column++ {
+		_, size := utf8.DecodeRune(content[start:])
+		start += size
+	}
+
+	return start, nil
+}
+
+// scalarRange returns the byte range of the scalar in the file, including its quotes.
+func scalarRange(content []byte, lineOffsets []int, node *yaml.Node) (int, int, error) {
+	start, err := yamlOffset(content, lineOffsets, node)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lineEnd := bytes.IndexByte(content[start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(content)
+	} else {
+		lineEnd += start
+	}
+	line := content[start:lineEnd]
+
+	switch node.Style {
+	case yaml.DoubleQuotedStyle:
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				return start, start + i + 1, nil
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return start, start + i + 1, nil
+			}
+		}
+	default:
+		// A plain scalar on a single line is written exactly as its value
+		if bytes.HasPrefix(line, []byte(node.Value)) {
+			return start, start + len(node.Value), nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("scalar at line %d must be on a single line", node.Line)
+}
+
+// formatScalar writes the value in the style of the replaced scalar, plain values that yaml would not read back as a
+// string (e.g. a numeric commit prefix) are double quoted.
+func formatScalar(value string, style yaml.Style) string {
+	switch style {
+	case yaml.DoubleQuotedStyle:
+		return strconv.Quote(value)
+	case yaml.SingleQuotedStyle:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+
+	var parsed any
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return strconv.Quote(value)
+	}
+
+	if s, ok := parsed.(string); !ok || s != value {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+// yamlEdit replaces the bytes between start and end with text, an insertion when both are equal
+type yamlEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// yamlEditor collects edits of a yaml file, all offsets refer to the original content
+type yamlEditor struct {
+	content     []byte
+	lineOffsets []int
+	edits       []yamlEdit
+}
+
+// setScalar replaces the value of the key in the mapping, or adds the key as the last line of a block mapping
+func (e *yamlEditor) setScalar(mapping *yaml.Node, key, value string) error {
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d must be a mapping", mapping.Line)
+	}
+
+	if node := lookupMappingKey(mapping, key); node != nil {
+		if node.Kind != yaml.ScalarNode || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) != 0 {
+			return fmt.Errorf("%s at line %d must be a single line scalar", key, node.Line)
+		}
+
+		start, end, err := scalarRange(e.content, e.lineOffsets, node)
+		if err != nil {
+			return err
+		}
+
+		text := formatScalar(value, node.Style)
+		if start == end {
+			// An empty value, e.g. "newTag:"
+			text = " " + text
+		}
+
+		e.edits = append(e.edits, yamlEdit{start: start, end: end, text: text})
+		return nil
+	}
+
+	if !isBlockCollection(mapping, yaml.MappingNode) {
+		return fmt.Errorf("mapping at line %d must be written in block style", mapping.Line)
+	}
+
+	return e.insertBlock(e.nodeEnd(mapping), mapping.Content[0].Column-1, map[string]string{key: value})
+}
+
+// insertBlock inserts the value as block yaml at the offset, indented by indent spaces
+func (e *yamlEditor) insertBlock(offset, indent int, value any) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	if offset == len(e.content) && offset > 0 && e.content[offset-1] != '\n' {
+		text.WriteString("\n")
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		text.WriteString(strings.Repeat(" ", indent) + line)
+	}
+	text.WriteString("\n")
+
+	e.edits = append(e.edits, yamlEdit{start: offset, end: offset, text: text.String()})
+	return nil
+}
+
+// nodeEnd returns the offset of the line following the node, where entries are appended to a block collection
+func (e *yamlEditor) nodeEnd(node *yaml.Node) int {
+	last := node
+	for len(last.Content) > 0 {
+		last = last.Content[len(last.Content)-1]
+	}
+
+	line := last.Line
+	if last.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// The lines of a block scalar are indented deeper than the collection holding it
+		for line < len(e.lineOffsets) {
+			text := e.content[e.lineOffsets[line]:]
+			if end := bytes.IndexByte(text, '\n'); end >= 0 {
+				text = text[:end]
+			}
+
+			trimmed := bytes.TrimLeft(text, " ")
+			if len(trimmed) > 0 && len(text)-len(trimmed) < node.Column {
+				break
+			}
+			line++
+		}
+	}
+
+	if line < len(e.lineOffsets) {
+		return e.lineOffsets[line]
+	}
+
+	return len(e.content)
+}
+
+// inlineRange returns the byte range of an empty value or of a flow collection written on a single line
+func (e *yamlEditor) inlineRange(node *yaml.Node) (int, int, error) {
+	if node.Kind == yaml.ScalarNode {
+		return scalarRange(e.content, e.lineOffsets, node)
+	}
+
+	start, err := yamlOffset(e.content, e.lineOffsets, node)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	depth := 0
+	var quote byte
+	for i := start; i < len(e.content) && e.content[i] != '\n'; i++ {
+		c := e.content[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+			if depth == 0 {
+				return start, i + 1, nil
+			}
+		}
+	}
+
+	return 0, 0, fmt.Errorf("flow collection at line %d must be on a single line", node.Line)
+}
+
+// apply returns the content with the edits, edits at the same offset keep the order they were added in
+func (e *yamlEditor) apply() []byte {
+	order := make([]int, len(e.edits))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		if e.edits[a].start != e.edits[b].start {
+			return e.edits[b].start - e.edits[a].start
+		}
+		return b - a
+	})
+
+	// Edit from the end of the file so the offsets of the remaining edits stay valid
+	edited := slices.Clone(e.content)
+	for _, i := range order {
+		edited = slices.Replace(edited, e.edits[i].start, e.edits[i].end, []byte(e.edits[i].text)...)
+	}
+
+	return edited
+}
+
+func isBlockCollection(node *yaml.Node, kind yaml.Kind) bool {
+	return node.Kind == kind && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+// mergeMapping deep merges the values into the block mapping like mergeValues. Existing keys are edited first, so
+// lines added to nested mappings come before keys added at the end of the mapping holding them.
+func (e *yamlEditor) mergeMapping(mapping *yaml.Node, values map[string]any) error {
+	var missing []string
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		var keyNode, existing *yaml.Node
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == key {
+				keyNode, existing = mapping.Content[i], mapping.Content[i+1]
+				break
+			}
+		}
+
+		if existing == nil {
+			missing = append(missing, key)
+			continue
+		}
+
+		if nested, ok := values[key].(map[string]any); ok && isBlockCollection(existing, yaml.MappingNode) {
+			if err := e.mergeMapping(existing, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := e.replaceValue(keyNode, existing, values[key]); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range missing {
+		if err := e.insertBlock(e.nodeEnd(mapping), mapping.Content[0].Column-1, map[string]any{key: values[key]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceValue writes the value in flow style in place of the value of the key. Single line scalars keep the rest of
+// their line, other values are replaced from the colon of the key to their last line.
+func (e *yamlEditor) replaceValue(key, value *yaml.Node, newValue any) error {
+	var node yaml.Node
+	if err := node.Encode(newValue); err != nil {
+		return err
+	}
+	node.Style |= yaml.FlowStyle
+
+	text, err := yaml.Marshal(&node)
+	if err != nil {
+		return err
+	}
+	flow := strings.TrimSuffix(string(text), "\n")
+
+	if value.Kind == yaml.ScalarNode && value.Line == key.Line && value.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) == 0 {
+		start, end, err := scalarRange(e.content, e.lineOffsets, value)
+		if err == nil {
+			if start == end {
+				flow = " " + flow
+			}
+			e.edits = append(e.edits, yamlEdit{start: start, end: end, text: flow})
+			return nil
+		}
+	}
+
+	_, keyEnd, err := scalarRange(e.content, e.lineOffsets, key)
+	if err != nil {
+		return err
+	}
+
+	colon := bytes.IndexByte(e.content[keyEnd:], ':')
+	if colon < 0 {
+		return fmt.Errorf("failed to locate the value of %s at line %d", key.Value, key.Line)
+	}
+
+	start, end := keyEnd+colon+1, e.nodeEnd(value)
+	if end > start && e.content[end-1] == '\n' {
+		end--
+	}
+
+	e.edits = append(e.edits, yamlEdit{start: start, end: end, text: " " + flow})
+	return nil
+}
@@ -0,0 +1,123 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+const testApplication = `# Users application, managed by argo-bot
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: users
+spec:
+  source:
+    repoURL: https://github.com/apono-io/charts
+    targetRevision: "old"   # pinned chart version
+    helm:
+      parameters:
+      - name: replicas
+        value: '2'
+      - name: image.tag
+        value: old
+`
+
+func TestDeployPatchPaths(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.GeneratedPath = "apps/prod/users.yaml"
+	environment.PatchPaths = []string{"spec.source.targetRevision", "spec.source.helm.parameters[name=image.tag].value"}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add application", map[string]string{
+		"apps/prod/users.yaml":  testApplication,
+		"apps/prod/orders.yaml": "kind: Application\n",
+	})
+
+	diff := deployAndApprove(t, deployer, []string{"users"}, "prod")
+
+	files := client.Files("")
+	want := strings.Replace(testApplication, `targetRevision: "old"`, `targetRevision: "`+testCommit+`"`, 1)
+	want = strings.Replace(want, "value: old", "value: "+testCommit, 1)
+	if got := files["apps/prod/users.yaml"]; got != want {
+		t.Errorf("patched file = %q, want %q", got, want)
+	}
+
+	if _, ok := files["apps/prod/orders.yaml"]; !ok {
+		t.Error("files next to the patched file should be kept")
+	}
+
+	if strings.Count(diff, "\n-") != 3 { // including the --- file header
+		t.Errorf("diff should only change the patched lines:\n%s", diff)
+	}
+}
+
+func TestPatchYamlPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		paths   []string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "flow mapping",
+			content: "image: {repository: users, tag: v1} # current\n",
+			paths:   []string{"image.tag"},
+			value:   "abc",
+			want:    "image: {repository: users, tag: abc} # current\n",
+		},
+		{
+			name:    "numeric value is quoted",
+			content: "image:\n  tag: v1\n",
+			paths:   []string{"image.tag"},
+			value:   "1234567",
+			want:    "image:\n  tag: \"1234567\"\n",
+		},
+		{
+			name:    "single quoted with index selector",
+			content: "tags:\n  - 'v1'\n  - 'v2'\n",
+			paths:   []string{"tags[1]"},
+			value:   "it's",
+			want:    "tags:\n  - 'v1'\n  - 'it''s'\n",
+		},
+		{
+			name:    "multiple documents",
+			content: "kind: A\nversion: v1\n---\nkind: B\nversion: v1\n",
+			paths:   []string{"version"},
+			value:   "v2",
+			want:    "kind: A\nversion: v2\n---\nkind: B\nversion: v2\n",
+		},
+		{
+			name:    "missing path",
+			content: "image:\n  tag: v1\n",
+			paths:   []string{"image.digest"},
+			wantErr: "yaml path image.digest was not found",
+		},
+		{
+			name:    "mapping node",
+			content: "image:\n  tag: v1\n",
+			paths:   []string{"image"},
+			wantErr: "must point to a single line scalar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patchYamlPaths([]byte(tt.content), tt.paths, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("patched = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
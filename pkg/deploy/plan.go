@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+)
+
+const devNull = "/dev/null"
+
+func (d *githubDeployer) Plan(serviceNames []string, environmentName, commit, commitUrl string) (string, error) {
+	ctx := context.Background()
+	environmentName = d.configuredEnvironmentName(environmentName)
+	logWithCtx := log.WithFields(log.Fields{
+		"environment":  environmentName,
+		"serviceNames": serviceNames,
+		"commit":       commit,
+		"dryRun":       true,
+	})
+
+	services, err := d.LookupServices(serviceNames)
+	if err != nil {
+		return "", err
+	}
+
+	versions := make(map[ServiceName]ServiceVersion)
+	for _, service := range services {
+		versions[ServiceName(service.Name)] = ServiceVersion{Commit: commit, CommitUrl: commitUrl}
+	}
+
+	serviceToEnvironment, deploymentBranch, err := d.resolveServicesAndEnvironment(serviceNames, environmentName)
+	if err != nil {
+		return "", err
+	}
+
+	err = d.validatePromotionPath(ctx, serviceToEnvironment, versions)
+	if err != nil {
+		return "", err
+	}
+
+	baseFolder, err := d.downloadBranch(ctx, "plan-"+environmentName, deploymentBranch)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err := os.RemoveAll(baseFolder)
+		if err != nil {
+			logWithCtx.WithError(err).Error("failed to remove source folder")
+		}
+	}()
+
+	originalFolder, err := os.MkdirTemp(d.config.Github.CloneTmpDir, "plan-original-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory, error: %w", err)
+	}
+	defer func() {
+		err := os.RemoveAll(originalFolder)
+		if err != nil {
+			logWithCtx.WithError(err).Error("failed to remove original folder")
+		}
+	}()
+
+	if _, err = d.copyDirectory(originalFolder, baseFolder, originalFolder); err != nil {
+		return "", fmt.Errorf("failed to copy deployment repository, error: %w", err)
+	}
+
+	metadata := deployMetadata{DeployedAt: time.Now().UTC()}
+	files, _, err := d.prepareDeployment(ctx, baseFolder, deploymentBranch, serviceToEnvironment, environmentName, versions, metadata, logWithCtx)
+	if err != nil {
+		return "", err
+	}
+
+	return diffFiles(originalFolder, baseFolder, files)
+}
+
+func (d *githubDeployer) downloadBranch(ctx context.Context, tmpPrefix, deploymentBranch string) (string, error) {
+	baseFolder, err := os.MkdirTemp(d.config.Github.CloneTmpDir, tmpPrefix+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory, error: %w", err)
+	}
+
+	err = d.githubClient.Download(ctx, deploymentBranch, baseFolder)
+	if err != nil {
+		_ = os.RemoveAll(baseFolder)
+		return "", fmt.Errorf("failed to download deployment repository, error: %w", err)
+	}
+
+	return baseFolder, nil
+}
+
+// diffFiles returns a unified diff of the given files between the original and the rendered folder.
+// Files missing from the rendered folder are the deletion markers added by addDeletionMarkers and are shown as deleted.
+func diffFiles(originalFolder, renderedFolder string, files []string) (string, error) {
+	sortedFiles := make([]string, len(files))
+	copy(sortedFiles, files)
+	sort.Strings(sortedFiles)
+
+	var diff strings.Builder
+	for _, file := range sortedFiles {
+		original, originalExists, err := readOptionalFile(filepath.Join(originalFolder, file))
+		if err != nil {
+			return "", err
+		}
+
+		rendered, renderedExists, err := readOptionalFile(filepath.Join(renderedFolder, file))
+		if err != nil {
+			return "", err
+		}
+
+		if original == rendered && originalExists == renderedExists {
+			continue
+		}
+
+		fromFile, toFile := "a/"+file, "b/"+file
+		if !originalExists {
+			fromFile = devNull
+		}
+		if !renderedExists {
+			toFile = devNull
+		}
+
+		fileDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(original),
+			B:        splitLines(rendered),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to diff file %s, error: %w", file, err)
+		}
+
+		diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", file, file))
+		diff.WriteString(fileDiff)
+	}
+
+	return diff.String(), nil
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+
+	lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	return lines
+}
+
+func readOptionalFile(path string) (string, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return string(content), true, nil
+}
@@ -0,0 +1,161 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+)
+
+const (
+	PolicyEnforcementBlock = "block"
+	PolicyEnforcementWarn  = "warn"
+
+	policyQuery = "data.argobot.deny"
+)
+
+type manifestObject struct {
+	file     string
+	document int
+	object   map[string]any
+}
+
+// evaluatePolicies runs the policy sets of every environment against its rendered objects. Violations of blocking
+// sets fail the deployment, the violations of the other sets are returned as warnings.
+func (d *githubDeployer) evaluatePolicies(ctx context.Context, baseFolder string, serviceToEnvironment map[*Service]*ServiceEnvironment,
+	versions map[ServiceName]ServiceVersion) ([]string, error) {
+	services := make([]*Service, 0, len(serviceToEnvironment))
+	for service := range serviceToEnvironment {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	var violations, warnings []string
+	for _, service := range services {
+		environment := serviceToEnvironment[service]
+		if len(environment.Policies) == 0 || !d.rendersManifests(baseFolder, environment) {
+			continue
+		}
+
+		objects, err := readManifestObjects(baseFolder, environment.GeneratedPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifests of service %s, error: %w", service.Name, err)
+		}
+
+		argoBot := map[string]any{
+			"serviceName": service.Name,
+			"environment": environment.Name,
+			"version":     versions[ServiceName(service.Name)].Commit,
+		}
+
+		for _, policySet := range environment.Policies {
+			messages, err := evaluatePolicySet(ctx, baseFolder, policySet.Path, argoBot, objects)
+			if err != nil {
+				return nil, err
+			}
+
+			switch policySet.Enforcement {
+			case PolicyEnforcementBlock, "":
+				violations = append(violations, messages...)
+			case PolicyEnforcementWarn:
+				warnings = append(warnings, messages...)
+			default:
+				return nil, fmt.Errorf("unknown enforcement %s of policy set %s", policySet.Enforcement, policySet.Path)
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, api.NewValidationErr(fmt.Sprintf("deployment violates policies:\n%s", strings.Join(violations, "\n")))
+	}
+
+	return warnings, nil
+}
+
+// evaluatePolicySet evaluates the deny rules of the argobot package for every object. The object is the input of the
+// policy and the deployment details are available as data.argoBot.
+func evaluatePolicySet(ctx context.Context, baseFolder, policyPath string, argoBot map[string]any, objects []manifestObject) ([]string, error) {
+	options := []func(*rego.Rego){
+		rego.Query(policyQuery),
+		rego.Store(inmem.NewFromObject(map[string]any{"argoBot": argoBot})),
+	}
+
+	policyFolder := filepath.Join(baseFolder, policyPath)
+	err := filepath.WalkDir(policyFolder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".rego" || strings.HasSuffix(path, "_test.rego") {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(baseFolder, path)
+		if err != nil {
+			return err
+		}
+
+		options = append(options, rego.Module(filepath.ToSlash(relPath), string(content)))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy set %s, error: %w", policyPath, err)
+	}
+
+	query, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile policy set %s, error: %w", policyPath, err)
+	}
+
+	var messages []string
+	for _, object := range objects {
+		results, err := query.Eval(ctx, rego.EvalInput(object.object))
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate policy set %s on %s, error: %w", policyPath, object.file, err)
+		}
+
+		for _, result := range results {
+			for _, expression := range result.Expressions {
+				denied, _ := expression.Value.([]any)
+				for _, message := range denied {
+					messages = append(messages, fmt.Sprintf("%s document %d %s: %v (%s)", object.file, object.document, object.name(), message, policyPath))
+				}
+			}
+		}
+	}
+
+	sort.Strings(messages)
+	return messages, nil
+}
+
+func (o manifestObject) name() string {
+	metadata, _ := o.object["metadata"].(map[string]any)
+	return fmt.Sprintf("%v/%v", o.object["kind"], metadata["name"])
+}
+
+func readManifestObjects(baseFolder, generatedPath string) ([]manifestObject, error) {
+	var objects []manifestObject
+	err := walkYamlFiles(baseFolder, filepath.Join(baseFolder, generatedPath), func(relPath string, content []byte) error {
+		documents, err := decodeYamlDocuments(content)
+		if err != nil {
+			return fmt.Errorf("%s is not valid yaml, error: %w", relPath, err)
+		}
+
+		for i, document := range documents {
+			if object, ok := document.(map[string]any); ok {
+				objects = append(objects, manifestObject{file: relPath, document: i + 1, object: object})
+			}
+		}
+
+		return nil
+	})
+
+	return objects, err
+}
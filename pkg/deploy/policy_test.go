@@ -0,0 +1,83 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+const testReplicasPolicy = `package argobot
+
+deny contains msg if {
+	input.kind == "Deployment"
+	data.argoBot.environment == "prod"
+	input.spec.replicas < 2
+	msg := sprintf("%s must have at least 2 replicas", [data.argoBot.serviceName])
+}
+`
+
+const testLatestPolicy = `package argobot
+
+deny contains msg if {
+	some container in input.spec.template.spec.containers
+	endswith(container.image, ":latest")
+	msg := sprintf("container %s uses the latest tag", [container.name])
+}
+`
+
+const testPolicyDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: users
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: users
+          image: users:{{ .Version }}
+        - name: sidecar
+          image: sidecar:latest
+`
+
+func TestDeployBlockingPolicies(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.Policies = []PolicySet{{Path: "policies/prod", Enforcement: PolicyEnforcementBlock}}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"policies/prod/replicas.rego":      testReplicasPolicy,
+		"policies/prod/replicas_test.rego": "package argobot\n\ntest_invalid if { not_defined }\n",
+		"templates/users/deployment.yaml":  testPolicyDeployment,
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "generated/prod/users/deployment.yaml document 1 Deployment/users: users must have at least 2 replicas (policies/prod)")
+
+	if client.PullRequest(1) != nil {
+		t.Error("pull request should not be opened when a blocking policy is violated")
+	}
+}
+
+func TestDeployWarningPolicies(t *testing.T) {
+	environment := testEnvironment("prod", "users")
+	environment.Policies = []PolicySet{{Path: "policies/common", Enforcement: PolicyEnforcementWarn}}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{
+		"policies/common/latest.rego":     testLatestPolicy,
+		"policies/prod/replicas.rego":     testReplicasPolicy,
+		"templates/users/deployment.yaml": testPolicyDeployment,
+	})
+
+	pr, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+
+	want := "generated/prod/users/deployment.yaml document 1 Deployment/users: container sidecar uses the latest tag (policies/common)"
+	if len(pr.Warnings) != 1 || pr.Warnings[0] != want {
+		t.Errorf("warnings = %q, want %q", pr.Warnings, want)
+	}
+
+	if description := client.PullRequest(pr.Id).Description; !strings.Contains(description, "Policy warnings:\n- "+want) {
+		t.Errorf("pull request description does not list the warnings:\n%s", description)
+	}
+}
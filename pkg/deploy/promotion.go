@@ -0,0 +1,70 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+)
+
+// validatePromotionPath checks that every version was deployed to the environment its target environment requires
+// first, and stayed there for at least the minimum soak time.
+func (d *githubDeployer) validatePromotionPath(ctx context.Context, serviceToEnvironment map[*Service]*ServiceEnvironment, versions map[ServiceName]ServiceVersion) error {
+	for service, environment := range serviceToEnvironment {
+		if environment.RequiresPriorEnvironment == "" {
+			continue
+		}
+
+		priorEnvironment, err := d.LookupEnvironment(service, environment.RequiresPriorEnvironment)
+		if err != nil {
+			return err
+		}
+
+		minimumSoakTime, err := parseDurationSetting(environment.MinimumSoakTime)
+		if err != nil {
+			return fmt.Errorf("invalid minimumSoakTime of environment %s, error: %w", environment.Name, err)
+		}
+
+		commit := versions[ServiceName(service.Name)].Commit
+		soakTime, deployed, err := d.deployedDuration(ctx, service, priorEnvironment, commit)
+		if err != nil {
+			return err
+		}
+
+		if !deployed {
+			return api.NewValidationErr(fmt.Sprintf("cannot deploy to %s: commit %s of service %s must be deployed to %s first",
+				environment.Name, shortSha(commit), service.Name, priorEnvironment.Name))
+		}
+
+		if soakTime < minimumSoakTime {
+			return api.NewValidationErr(fmt.Sprintf("cannot deploy to %s: commit %s of service %s has run in %s for %s, it must run there for at least %s",
+				environment.Name, shortSha(commit), service.Name, priorEnvironment.Name, soakTime.Round(time.Minute), minimumSoakTime))
+		}
+	}
+
+	return nil
+}
+
+// deployedDuration returns the longest time the commit ran in the environment without being replaced by another
+// version, a commit that is still deployed counts until now.
+func (d *githubDeployer) deployedDuration(ctx context.Context, service *Service, environment *ServiceEnvironment, commit string) (time.Duration, bool, error) {
+	var longest time.Duration
+	var deployed bool
+	replacedAt := timeNow()
+	err := d.walkDeployments(ctx, service, environment, func(record deploymentRecord) bool {
+		if !sameVersion(commit, record.Version) {
+			replacedAt = record.Commit.Date
+			return true
+		}
+
+		deployed = true
+		longest = max(longest, replacedAt.Sub(record.Commit.Date))
+		return true
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return longest, deployed, nil
+}
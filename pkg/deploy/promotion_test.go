@@ -0,0 +1,70 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeployRequiresPriorEnvironment(t *testing.T) {
+	const nextCommit = "89abcdef0123456789abcdef0123456789abcdef"
+
+	prod := testEnvironment("prod", "users")
+	prod.RequiresPriorEnvironment = "staging"
+	prod.MinimumSoakTime = "1h"
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users"), prod))
+	client.AddServiceCommit(testOrganization, testRepository, nextCommit, testCommit)
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "cannot deploy to prod: commit 0123456 of service users must be deployed to staging first")
+
+	_, err = deployer.Plan([]string{"users"}, "prod", testCommit, "")
+	assertValidationErr(t, err, "must be deployed to staging first")
+
+	for _, commit := range []string{testCommit, nextCommit} {
+		pr, _, err := deployer.Deploy([]string{"users"}, "staging", commit, "", testUserFullname, testUserEmail)
+		if err != nil {
+			t.Fatalf("deploy to staging failed: %v", err)
+		}
+
+		if err = deployer.Approve(context.Background(), pr.Id); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	// The first commit was replaced in staging a few minutes after it was deployed
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "it must run there for at least 1h0m0s")
+
+	_, _, _, err = deployer.Promote([]string{"users"}, "staging", "prod", testUserFullname, testUserEmail)
+	if err != nil {
+		t.Fatalf("promote of the commit still running in staging failed: %v", err)
+	}
+}
+
+func TestDeployRequiresMinimumSoakTime(t *testing.T) {
+	prod := testEnvironment("prod", "users")
+	prod.RequiresPriorEnvironment = "staging"
+	prod.MinimumSoakTime = "1h"
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("staging", "users"), prod))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+	deployAndApprove(t, deployer, []string{"users"}, "staging")
+
+	history, _, err := deployer.History("users", "staging", 1)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	deployedAt := history[0].Time
+
+	timeNow = func() time.Time { return deployedAt.Add(30 * time.Minute) }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	_, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "cannot deploy to prod: commit 0123456 of service users has run in staging for 30m0s, it must run there for at least 1h0m0s")
+
+	timeNow = func() time.Time { return deployedAt.Add(time.Hour) }
+	if _, _, err = deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail); err != nil {
+		t.Errorf("deploy after the soak time failed: %v", err)
+	}
+}
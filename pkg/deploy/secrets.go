@@ -0,0 +1,227 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	secretEntropyRule         = "high-entropy-secret-data"
+	secretEntropyThreshold    = 4.0
+	secretEntropyMinLength    = 20
+	secretRedactedPrefixChars = 4
+	maxSecretFindings         = 20
+)
+
+var builtinSecretRules = []SecretRule{
+	{Name: "aws-access-key-id", Pattern: `\b(AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret-access-key", Pattern: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`},
+	{Name: "private-key", Pattern: `-----BEGIN ((RSA|EC|DSA|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`},
+	{Name: "slack-token", Pattern: `\bxox[abposr]-[0-9A-Za-z-]{10,}`},
+	{Name: "slack-webhook", Pattern: `https://hooks\.slack\.com/services/T[A-Za-z0-9_]+/B[A-Za-z0-9_]+/[A-Za-z0-9_]+`},
+	{Name: "github-token", Pattern: `\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b`},
+	{Name: "github-fine-grained-token", Pattern: `\bgithub_pat_[A-Za-z0-9_]{22,}\b`},
+}
+
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type secretFinding struct {
+	file  string
+	line  int
+	rule  string
+	match string
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s:%d %s %s", f.file, f.line, f.rule, redactSecret(f.match))
+}
+
+// scanSecrets looks for credentials in the files about to be committed. Every finding that is not allowlisted blocks
+// the deployment, the report only holds the first characters of each secret.
+func (d *githubDeployer) scanSecrets(baseFolder string, files []string) error {
+	scanConfig := d.config.SecretScanning
+	if scanConfig.Disabled {
+		return nil
+	}
+
+	rules, err := compileSecretRules(slices.Concat(builtinSecretRules, scanConfig.Rules))
+	if err != nil {
+		return err
+	}
+
+	allowlist, err := compilePatterns(scanConfig.Allowlist)
+	if err != nil {
+		return fmt.Errorf("invalid secret scanning allowlist, error: %w", err)
+	}
+
+	var findings []string
+	sortedFiles := append([]string(nil), files...)
+	sort.Strings(sortedFiles)
+	for _, file := range sortedFiles {
+		if matchesGlob(scanConfig.AllowedPaths, filepath.ToSlash(file)) {
+			continue
+		}
+
+		content, exists, err := readOptionalFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		fileFindings := scanSecretRules([]byte(content), rules)
+		if isYamlFile(file) {
+			fileFindings = append(fileFindings, scanSecretData([]byte(content))...)
+		}
+
+		for _, finding := range fileFindings {
+			if isAllowlisted(allowlist, finding.match) {
+				continue
+			}
+
+			finding.file = file
+			findings = append(findings, finding.String())
+		}
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	if len(findings) > maxSecretFindings {
+		findings = append(findings[:maxSecretFindings], fmt.Sprintf("and %d more", len(findings)-maxSecretFindings))
+	}
+
+	return api.NewValidationErr(fmt.Sprintf("secrets found in generated files:\n%s", strings.Join(findings, "\n")))
+}
+
+func compileSecretRules(rules []SecretRule) ([]secretRule, error) {
+	compiled := make([]secretRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret scanning rule %s, error: %w", rule.Name, err)
+		}
+		compiled = append(compiled, secretRule{name: rule.Name, pattern: pattern})
+	}
+
+	return compiled, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+func isAllowlisted(allowlist []*regexp.Regexp, match string) bool {
+	for _, re := range allowlist {
+		if re.MatchString(match) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func scanSecretRules(content []byte, rules []secretRule) []secretFinding {
+	var findings []secretFinding
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		for _, rule := range rules {
+			for _, match := range rule.pattern.FindAllString(scanner.Text(), -1) {
+				findings = append(findings, secretFinding{line: line, rule: rule.name, match: match})
+			}
+		}
+	}
+
+	return findings
+}
+
+// scanSecretData reports the high entropy values of Secret objects. SealedSecrets are encrypted and have another kind,
+// so they are not reported. Files that are not valid yaml, e.g. copied Helm templates, are skipped.
+func scanSecretData(content []byte) []secretFinding {
+	var findings []secretFinding
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			return findings
+		}
+
+		if len(document.Content) == 0 {
+			continue
+		}
+
+		root := document.Content[0]
+		kind := lookupMappingKey(root, "kind")
+		if kind == nil || kind.Value != "Secret" {
+			continue
+		}
+
+		for _, key := range []string{"data", "stringData"} {
+			data := lookupMappingKey(root, key)
+			if data == nil || data.Kind != yaml.MappingNode {
+				continue
+			}
+
+			for i := 0; i+1 < len(data.Content); i += 2 {
+				value := data.Content[i+1]
+				if value.Kind == yaml.ScalarNode && isHighEntropy(value.Value) {
+					findings = append(findings, secretFinding{line: value.Line, rule: secretEntropyRule, match: value.Value})
+				}
+			}
+		}
+	}
+}
+
+func isHighEntropy(value string) bool {
+	if len(value) < secretEntropyMinLength {
+		return false
+	}
+
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	length := float64(len([]rune(value)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy >= secretEntropyThreshold
+}
+
+func redactSecret(secret string) string {
+	if len(secret) <= secretRedactedPrefixChars*2 {
+		return strings.Repeat("*", len(secret))
+	}
+
+	return secret[:secretRedactedPrefixChars] + strings.Repeat("*", 8)
+}
@@ -0,0 +1,396 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"gopkg.in/yaml.v3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	crdKind                    = "CustomResourceDefinition"
+	preserveUnknownFieldsKey   = "x-kubernetes-preserve-unknown-fields"
+	intOrStringKey             = "x-kubernetes-int-or-string"
+	intOrStringFormat          = "int-or-string"
+	maxManifestValidationFails = 20
+)
+
+type manifestSchemas map[kyaml.TypeMeta]*openapi.ResourceSchema
+
+// validateManifests checks the rendered manifests of every service before they are committed. Every document must be
+// a Kubernetes object and is validated against the bundled Kubernetes schemas or the CRDs of the deployment repository.
+// Objects of unknown kinds only get the basic checks.
+func (d *githubDeployer) validateManifests(baseFolder string, serviceToEnvironment map[*Service]*ServiceEnvironment) error {
+	if !d.config.ManifestValidation.Enabled {
+		return nil
+	}
+
+	var generatedFolders []string
+	for _, environment := range serviceToEnvironment {
+		if !environment.SkipManifestValidation && d.rendersManifests(baseFolder, environment) {
+			generatedFolders = append(generatedFolders, filepath.Join(baseFolder, environment.GeneratedPath))
+		}
+	}
+
+	if len(generatedFolders) == 0 {
+		return nil
+	}
+
+	schemas, err := d.loadCRDSchemas(baseFolder)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	slices.Sort(generatedFolders)
+	for _, folder := range generatedFolders {
+		err = walkYamlFiles(baseFolder, folder, func(relPath string, content []byte) error {
+			for _, failure := range validateManifestFile(content, schemas) {
+				failures = append(failures, fmt.Sprintf("%s %s", relPath, failure))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to validate manifests, error: %w", err)
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	if len(failures) > maxManifestValidationFails {
+		failures = append(failures[:maxManifestValidationFails], fmt.Sprintf("and %d more", len(failures)-maxManifestValidationFails))
+	}
+
+	return api.NewValidationErr(fmt.Sprintf("invalid manifests:\n%s", strings.Join(failures, "\n")))
+}
+
+// rendersManifests reports whether the generated folder holds plain manifests. Copied Helm charts and kustomizations
+// are rendered by ArgoCD and patched files may be values files, so they are not checked.
+func (d *githubDeployer) rendersManifests(baseFolder string, env *ServiceEnvironment) bool {
+	if len(env.PatchPaths) > 0 {
+		return false
+	}
+
+	templateFolder := filepath.Join(baseFolder, env.TemplatePath)
+	if d.isHelmChart(templateFolder) {
+		return env.HelmRender
+	}
+
+	if d.isKustomization(templateFolder) {
+		return env.KustomizeBuild
+	}
+
+	return true
+}
+
+// loadCRDSchemas reads the schema of every version of the CRDs found in the configured folder.
+func (d *githubDeployer) loadCRDSchemas(baseFolder string) (manifestSchemas, error) {
+	schemas := make(manifestSchemas)
+	if d.config.ManifestValidation.CrdsPath == "" {
+		return schemas, nil
+	}
+
+	crdsFolder := filepath.Join(baseFolder, d.config.ManifestValidation.CrdsPath)
+	err := filepath.WalkDir(crdsFolder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isYamlFile(path) {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		documents, err := decodeYamlDocuments(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse CRD file %s, error: %w", filepath.Base(path), err)
+		}
+
+		for _, document := range documents {
+			crd, ok := document.(map[string]any)
+			if !ok || crd["kind"] != crdKind {
+				continue
+			}
+
+			err = addCRDSchemas(schemas, crd)
+			if err != nil {
+				return fmt.Errorf("failed to read CRD schema from %s, error: %w", filepath.Base(path), err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
+
+func addCRDSchemas(schemas manifestSchemas, crd map[string]any) error {
+	crdSpec, _ := crd["spec"].(map[string]any)
+	group, _ := crdSpec["group"].(string)
+	names, _ := crdSpec["names"].(map[string]any)
+	kind, _ := names["kind"].(string)
+	versions, _ := crdSpec["versions"].([]any)
+	for _, item := range versions {
+		version, _ := item.(map[string]any)
+		versionName, _ := version["name"].(string)
+		versionSchema, _ := version["schema"].(map[string]any)
+		openAPISchema, ok := versionSchema["openAPIV3Schema"]
+		if !ok {
+			continue
+		}
+
+		content, err := json.Marshal(openAPISchema)
+		if err != nil {
+			return err
+		}
+
+		var schema spec.Schema
+		err = schema.UnmarshalJSON(content)
+		if err != nil {
+			return err
+		}
+
+		typeMeta := kyaml.TypeMeta{APIVersion: group + "/" + versionName, Kind: kind}
+		schemas[typeMeta] = &openapi.ResourceSchema{Schema: &schema}
+	}
+
+	return nil
+}
+
+func validateManifestFile(content []byte, crdSchemas manifestSchemas) []string {
+	documents, err := decodeYamlDocuments(content)
+	if err != nil {
+		return []string{fmt.Sprintf("is not valid yaml: %v", err)}
+	}
+
+	var failures []string
+	for i, document := range documents {
+		if document == nil {
+			continue
+		}
+
+		for _, failure := range validateManifest(document, crdSchemas) {
+			failures = append(failures, fmt.Sprintf("document %d: %s", i+1, failure))
+		}
+	}
+
+	return failures
+}
+
+func validateManifest(document any, crdSchemas manifestSchemas) []string {
+	object, ok := document.(map[string]any)
+	if !ok {
+		return []string{"must be a kubernetes object"}
+	}
+
+	apiVersion, _ := object["apiVersion"].(string)
+	kind, _ := object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]any)
+	name, _ := metadata["name"].(string)
+	generateName, _ := metadata["generateName"].(string)
+
+	var failures []string
+	if apiVersion == "" {
+		failures = append(failures, "missing apiVersion")
+	}
+	if kind == "" {
+		failures = append(failures, "missing kind")
+	}
+	if name == "" && generateName == "" {
+		failures = append(failures, "missing metadata.name")
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+
+	typeMeta := kyaml.TypeMeta{APIVersion: apiVersion, Kind: kind}
+	schema, found := crdSchemas[typeMeta]
+	if !found {
+		schema = openapi.SchemaForResourceType(typeMeta)
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	return validateSchema(object, schema, "")
+}
+
+// validateSchema checks the value against the schema, unknown fields are rejected unless the schema allows them.
+func validateSchema(value any, schema *openapi.ResourceSchema, path string) []string {
+	if value == nil || schema == nil || schema.Schema == nil {
+		return nil
+	}
+
+	schemaType := ""
+	if len(schema.Schema.Type) == 1 {
+		schemaType = schema.Schema.Type[0]
+	} else if len(schema.Schema.Properties) > 0 {
+		schemaType = "object"
+	}
+
+	switch schemaType {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an object", fieldName(path))}
+		}
+		return validateObject(object, schema, path)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a list", fieldName(path))}
+		}
+
+		var failures []string
+		elements := schema.Elements()
+		for i, item := range items {
+			failures = append(failures, validateSchema(item, elements, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return failures
+	case "string":
+		switch value.(type) {
+		case string, time.Time:
+			return nil
+		case int, int64, uint64, float64:
+			// Quantities and int-or-string values may be written as numbers
+			return nil
+		}
+		return []string{fmt.Sprintf("%s must be a string", fieldName(path))}
+	case "integer":
+		switch value.(type) {
+		case int, int64, uint64:
+			return nil
+		case string:
+			if isIntOrString(schema.Schema) {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s must be an integer", fieldName(path))}
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+			return nil
+		}
+		return []string{fmt.Sprintf("%s must be a number", fieldName(path))}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s must be a boolean", fieldName(path))}
+		}
+	}
+
+	return nil
+}
+
+func validateObject(object map[string]any, schema *openapi.ResourceSchema, path string) []string {
+	var failures []string
+	for _, required := range schema.Schema.Required {
+		if _, ok := object[required]; !ok {
+			failures = append(failures, fmt.Sprintf("missing required field %s", joinField(path, required)))
+		}
+	}
+
+	preserveUnknown, _ := schema.Schema.Extensions.GetBool(preserveUnknownFieldsKey)
+	freeForm := len(schema.Schema.Properties) == 0 || preserveUnknown ||
+		(schema.Schema.AdditionalProperties != nil && schema.Schema.AdditionalProperties.Allows)
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		field := joinField(path, key)
+		fieldSchema := schema.Field(key)
+		if fieldSchema == nil {
+			if !freeForm {
+				failures = append(failures, fmt.Sprintf("unknown field %s", field))
+			}
+			continue
+		}
+
+		failures = append(failures, validateSchema(object[key], fieldSchema, field)...)
+	}
+
+	return failures
+}
+
+func isIntOrString(schema *spec.Schema) bool {
+	intOrString, _ := schema.Extensions.GetBool(intOrStringKey)
+	return intOrString || schema.Format == intOrStringFormat
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func fieldName(path string) string {
+	if path == "" {
+		return "document"
+	}
+
+	return path
+}
+
+func decodeYamlDocuments(content []byte) ([]any, error) {
+	var documents []any
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document any
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
+
+// walkYamlFiles calls fn with the path relative to the base folder and the content of every yaml file in the folder.
+// A missing folder has no files.
+func walkYamlFiles(baseFolder, folder string, fn func(relPath string, content []byte) error) error {
+	err := filepath.WalkDir(folder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isYamlFile(path) {
+			return err
+		}
+
+		relPath, err := filepath.Rel(baseFolder, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return fn(relPath, content)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func isYamlFile(path string) bool {
+	extension := filepath.Ext(path)
+	return extension == ".yaml" || extension == ".yml"
+}
@@ -0,0 +1,100 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: rollouts.example.com
+spec:
+  group: example.com
+  names:
+    kind: Rollout
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                replicas:
+                  type: integer
+                strategy:
+                  type: object
+                  x-kubernetes-preserve-unknown-fields: true
+`
+
+func TestDeployValidatesManifests(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	deployer.config.ManifestValidation = ManifestValidationConfig{Enabled: true, CrdsPath: "crds"}
+	client.WriteFiles("", "Add templates", map[string]string{
+		"crds/rollout.yaml": testCRD,
+		"templates/users/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: users
+spec:
+  replica: 3
+  selector:
+    matchLabels:
+      app: users
+  template:
+    spec:
+      containers:
+        - image: users:{{ .Version }}
+          env:
+            - name: DEBUG
+              value: true
+          resources:
+            limits:
+              cpu: 1
+---
+apiVersion: v1
+kind: ConfigMap
+`,
+		"templates/users/rollout.yaml": "apiVersion: example.com/v1\nkind: Rollout\nmetadata:\n  name: users\nspec:\n  replicas: three\n  strategy:\n    canary: {}\n",
+		"templates/users/broken.yaml":  "key: [unclosed\n",
+	})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "invalid manifests")
+
+	for _, want := range []string{
+		"generated/prod/users/broken.yaml is not valid yaml",
+		"generated/prod/users/deployment.yaml document 1: unknown field spec.replica",
+		"generated/prod/users/deployment.yaml document 1: missing required field spec.template.spec.containers[0].name",
+		"generated/prod/users/deployment.yaml document 1: spec.template.spec.containers[0].env[0].value must be a string",
+		"generated/prod/users/deployment.yaml document 2: missing metadata.name",
+		"generated/prod/users/rollout.yaml document 1: spec.replicas must be an integer",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%s", want, err.Error())
+		}
+	}
+
+	for _, unexpected := range []string{"cpu", "strategy"} {
+		if strings.Contains(err.Error(), unexpected) {
+			t.Errorf("error should not mention %s:\n%s", unexpected, err.Error())
+		}
+	}
+
+	if client.PullRequest(1) != nil {
+		t.Error("pull request should not be opened for invalid manifests")
+	}
+}
+
+func TestDeploySkipsValidationOfCopiedCharts(t *testing.T) {
+	deployer, client := newTestDeployer(t, testService("users", testEnvironment("prod", "users")))
+	deployer.config.ManifestValidation.Enabled = true
+	client.WriteFiles("", "Add chart", map[string]string{
+		"templates/users/Chart.yaml":            "apiVersion: v2\nname: users\nversion: 0.1.0\n",
+		"templates/users/templates/deploy.yaml": "image: {{ .Values.argoBot.version }}\n",
+	})
+
+	deployAndApprove(t, deployer, []string{"users"}, "prod")
+}
@@ -0,0 +1,287 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+)
+
+const deployWindowTimeFormat = "Mon 2006-01-02 15:04 MST"
+const nextDeployWindowSearchLimit = 366 * 24 * time.Hour
+
+var blackoutTimeLayouts = []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// timeNow is replaced by tests that depend on the current time
+var timeNow = time.Now
+
+// deploySchedule holds the parsed deploy windows and blackout periods of an environment
+type deploySchedule struct {
+	location  *time.Location
+	windows   []dailyWindow
+	blackouts []blackoutPeriod
+}
+
+type dailyWindow struct {
+	days                   [7]bool
+	startHour, startMinute int
+	endHour, endMinute     int
+}
+
+type blackoutPeriod struct {
+	name       string
+	start, end time.Time
+}
+
+// loadDeploySchedule parses the deploy windows and blackouts of the environment, including the blackout calendar in
+// the deployment repository. It returns nil when the environment has no schedule.
+func loadDeploySchedule(baseFolder string, environment *ServiceEnvironment) (*deploySchedule, error) {
+	if len(environment.DeployWindows) == 0 && len(environment.Blackouts) == 0 && environment.BlackoutCalendar == "" {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(environment.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s, error: %w", environment.Timezone, err)
+	}
+
+	schedule := &deploySchedule{location: location}
+	for _, window := range environment.DeployWindows {
+		parsed, err := parseDeployWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, parsed)
+	}
+
+	for _, blackout := range environment.Blackouts {
+		period := blackoutPeriod{name: blackout.Name}
+		if period.start, err = parseBlackoutTime(blackout.Start, location); err != nil {
+			return nil, err
+		}
+		if period.end, err = parseBlackoutTime(blackout.End, location); err != nil {
+			return nil, err
+		}
+		schedule.blackouts = append(schedule.blackouts, period)
+	}
+
+	if environment.BlackoutCalendar != "" {
+		content, err := os.ReadFile(filepath.Join(baseFolder, environment.BlackoutCalendar))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blackout calendar %s, error: %w", environment.BlackoutCalendar, err)
+		}
+
+		// Recurring events are expanded past the furthest time the next deploy window is searched for
+		periods, err := parseCalendarBlackouts(string(content), location, timeNow().Add(2*nextDeployWindowSearchLimit))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blackout calendar %s, error: %w", environment.BlackoutCalendar, err)
+		}
+		schedule.blackouts = append(schedule.blackouts, periods...)
+	}
+
+	return schedule, nil
+}
+
+// status returns why deploying is not allowed at the given time, and when it is allowed next. The reason is empty
+// when deploying is allowed, next is zero when no allowed time was found within a year.
+func (s *deploySchedule) status(now time.Time) (string, time.Time) {
+	var reason string
+	if blackout, ok := s.blackoutAt(now); ok {
+		reason = "blackout in effect"
+		if blackout.name != "" {
+			reason = fmt.Sprintf("blackout %q in effect", blackout.name)
+		}
+	} else if !s.inWindow(now) {
+		reason = "outside deploy windows"
+	} else {
+		return "", time.Time{}
+	}
+
+	next := now
+	for next.Sub(now) < nextDeployWindowSearchLimit {
+		if blackout, ok := s.blackoutAt(next); ok {
+			next = blackout.end
+			continue
+		}
+
+		if !s.inWindow(next) {
+			next = s.nextWindowStart(next)
+			if next.IsZero() {
+				break
+			}
+			continue
+		}
+
+		return reason, next.In(s.location)
+	}
+
+	return reason, time.Time{}
+}
+
+func (s *deploySchedule) blackoutAt(t time.Time) (blackoutPeriod, bool) {
+	for _, blackout := range s.blackouts {
+		if !t.Before(blackout.start) && t.Before(blackout.end) {
+			return blackout, true
+		}
+	}
+
+	return blackoutPeriod{}, false
+}
+
+func (s *deploySchedule) inWindow(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+
+	// A window wrapping past midnight may have started the day before
+	for offset := -1; offset <= 0; offset++ {
+		for _, window := range s.windows {
+			start, end, ok := window.on(t.In(s.location).AddDate(0, 0, offset))
+			if ok && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *deploySchedule) nextWindowStart(t time.Time) time.Time {
+	var next time.Time
+	for offset := 0; offset <= 7; offset++ {
+		for _, window := range s.windows {
+			start, _, ok := window.on(t.In(s.location).AddDate(0, 0, offset))
+			if ok && start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+
+	return next
+}
+
+// on returns the window opening on the day of t, if the window applies to that weekday
+func (w dailyWindow) on(t time.Time) (time.Time, time.Time, bool) {
+	if !w.days[t.Weekday()] {
+		return time.Time{}, time.Time{}, false
+	}
+
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, w.startHour, w.startMinute, 0, 0, t.Location())
+	end := time.Date(year, month, day, w.endHour, w.endMinute, 0, 0, t.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start, end, true
+}
+
+func parseDeployWindow(window DeployWindow) (dailyWindow, error) {
+	var parsed dailyWindow
+	for _, part := range strings.Split(strings.ToLower(window.Days), ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" {
+			parsed.days = [7]bool{true, true, true, true, true, true, true}
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+
+		from, ok := weekdayNames[first]
+		to, ok2 := weekdayNames[last]
+		if !ok || !ok2 {
+			return dailyWindow{}, fmt.Errorf("invalid deploy window days %q, expected days like mon-fri or sat,sun", window.Days)
+		}
+
+		for day := from; ; day = (day + 1) % 7 {
+			parsed.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+
+	var err error
+	if parsed.startHour, parsed.startMinute, err = parseClock(window.Start, "00:00"); err != nil {
+		return dailyWindow{}, err
+	}
+	if parsed.endHour, parsed.endMinute, err = parseClock(window.End, "24:00"); err != nil {
+		return dailyWindow{}, err
+	}
+
+	return parsed, nil
+}
+
+func parseClock(value, defaultValue string) (int, int, error) {
+	if value == "" {
+		value = defaultValue
+	}
+
+	hourValue, minuteValue, found := strings.Cut(value, ":")
+	hour, hourErr := strconv.Atoi(hourValue)
+	minute, minuteErr := strconv.Atoi(minuteValue)
+	if !found || hourErr != nil || minuteErr != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, 0, fmt.Errorf("invalid deploy window time %q, expected HH:MM", value)
+	}
+
+	return hour, minute, nil
+}
+
+func parseBlackoutTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range blackoutTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid blackout time %q, expected YYYY-MM-DD or YYYY-MM-DD HH:MM", value)
+}
+
+// validateDeploySchedule rejects deploying the service outside the deploy windows of the environment or during a
+// blackout, naming the next time deploying is allowed.
+func validateDeploySchedule(baseFolder string, service *Service, environment *ServiceEnvironment) error {
+	schedule, err := loadDeploySchedule(baseFolder, environment)
+	if err != nil {
+		return fmt.Errorf("failed to load deploy schedule of service %s, error: %w", service.Name, err)
+	}
+
+	if schedule == nil {
+		return nil
+	}
+
+	reason, next := schedule.status(timeNow())
+	if reason == "" {
+		return nil
+	}
+
+	return api.NewValidationErr(fmt.Sprintf("cannot deploy %s to %s: %s, %s", service.Name, environment.Name, reason, formatNextDeployWindow(next)))
+}
+
+func formatNextDeployWindow(next time.Time) string {
+	if next.IsZero() {
+		return "no deploy window within the next year"
+	}
+
+	return fmt.Sprintf("next deploy window opens %s", next.Format(deployWindowTimeFormat))
+}
@@ -0,0 +1,157 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployScheduleStatus(t *testing.T) {
+	environment := &ServiceEnvironment{
+		Timezone: "Europe/Berlin",
+		DeployWindows: []DeployWindow{
+			{Days: "mon-thu", Start: "09:00", End: "17:00"},
+			{Days: "fri", Start: "09:00", End: "14:00"},
+		},
+		Blackouts:        []Blackout{{Name: "holiday freeze", Start: "2024-12-20", End: "2025-01-02 09:00"}},
+		BlackoutCalendar: "calendar.ics",
+	}
+
+	baseFolder := t.TempDir()
+	calendar := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Company\r\n  offsite\r\nDTSTART;VALUE=DATE:20240312\r\nDTEND;VALUE=DATE:20240314\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Migration\r\nDTSTART:20240320T080000Z\r\nDTEND;TZID=Europe/Berlin:20240320T160000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if err := os.WriteFile(filepath.Join(baseFolder, "calendar.ics"), []byte(calendar), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := loadDeploySchedule(baseFolder, environment)
+	if err != nil {
+		t.Fatalf("failed to load schedule: %v", err)
+	}
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	tests := []struct {
+		name   string
+		now    time.Time
+		reason string
+		next   string
+	}{
+		{name: "inside window", now: time.Date(2024, 3, 6, 10, 0, 0, 0, berlin)},
+		{name: "friday afternoon", now: time.Date(2024, 3, 8, 15, 0, 0, 0, berlin), reason: "outside deploy windows", next: "Mon 2024-03-11 09:00 CET"},
+		{name: "calendar event", now: time.Date(2024, 3, 12, 10, 0, 0, 0, berlin), reason: `blackout "Company offsite" in effect`, next: "Thu 2024-03-14 09:00 CET"},
+		{name: "timed calendar event", now: time.Date(2024, 3, 20, 10, 0, 0, 0, berlin), reason: `blackout "Migration" in effect`, next: "Wed 2024-03-20 16:00 CET"},
+		{name: "blackout", now: time.Date(2024, 12, 23, 10, 0, 0, 0, berlin), reason: `blackout "holiday freeze" in effect`, next: "Thu 2025-01-02 09:00 CET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, next := schedule.status(tt.now)
+			if reason != tt.reason {
+				t.Errorf("expected reason %q, got %q", tt.reason, reason)
+			}
+
+			if tt.next != "" && next.Format(deployWindowTimeFormat) != tt.next {
+				t.Errorf("expected next window %s, got %s", tt.next, next.Format(deployWindowTimeFormat))
+			}
+		})
+	}
+}
+
+func TestCalendarRecurringBlackouts(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	horizon := time.Date(2025, 1, 1, 0, 0, 0, 0, berlin)
+	tests := []struct {
+		name   string
+		event  string
+		starts []string
+		err    string
+	}{
+		{
+			name:   "weekly with count and exdate",
+			event:  "DTSTART;TZID=Europe/Berlin:20240315T140000\r\nDTEND;TZID=Europe/Berlin:20240315T180000\r\nRRULE:FREQ=WEEKLY;COUNT=3\r\nEXDATE;TZID=Europe/Berlin:20240322T140000\r\n",
+			starts: []string{"2024-03-15 14:00 CET", "2024-03-29 14:00 CET"},
+		},
+		{
+			name:   "weekly by day until",
+			event:  "DTSTART;TZID=Europe/Berlin:20240325T090000\r\nDTEND;TZID=Europe/Berlin:20240325T100000\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;UNTIL=20240408T235959Z\r\n",
+			starts: []string{"2024-03-25 09:00 CET", "2024-03-29 09:00 CET", "2024-04-08 09:00 CEST"},
+		},
+		{
+			name:   "daily all-day",
+			event:  "DTSTART;VALUE=DATE:20240330\r\nDTEND;VALUE=DATE:20240331\r\nRRULE:FREQ=DAILY;COUNT=2\r\n",
+			starts: []string{"2024-03-30 00:00 CET", "2024-03-31 00:00 CET"},
+		},
+		{
+			name:   "yearly until horizon",
+			event:  "DTSTART;VALUE=DATE:20221224\r\nRRULE:FREQ=YEARLY\r\n",
+			starts: []string{"2022-12-24 00:00 CET", "2023-12-24 00:00 CET", "2024-12-24 00:00 CET"},
+		},
+		{
+			name:  "unsupported rule",
+			event: "DTSTART:20240301T090000Z\r\nRRULE:FREQ=MONTHLY;BYSETPOS=-1\r\n",
+			err:   `event 1 "Maintenance": unsupported RRULE part BYSETPOS`,
+		},
+		{
+			name:  "unsupported frequency",
+			event: "DTSTART:20240301T090000Z\r\nRRULE:FREQ=HOURLY\r\n",
+			err:   `event 1 "Maintenance": unsupported RRULE FREQ HOURLY`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Maintenance\r\n" + tt.event + "END:VEVENT\r\nEND:VCALENDAR\r\n"
+			periods, err := parseCalendarBlackouts(calendar, berlin, horizon)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse calendar: %v", err)
+			}
+
+			var starts []string
+			for _, period := range periods {
+				starts = append(starts, period.start.In(berlin).Format("2006-01-02 15:04 MST"))
+			}
+			if strings.Join(starts, ", ") != strings.Join(tt.starts, ", ") {
+				t.Errorf("expected occurrences %v, got %v", tt.starts, starts)
+			}
+		})
+	}
+
+	periods, err := parseCalendarBlackouts("BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240330\r\nRRULE:FREQ=DAILY;COUNT=2\r\nEND:VEVENT\r\n", berlin, horizon)
+	if err != nil {
+		t.Fatalf("failed to parse calendar: %v", err)
+	}
+	if end := periods[1].end; !end.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)) {
+		t.Errorf("all-day occurrence over a daylight saving change should end at midnight, got %s", end)
+	}
+}
+
+func TestDeployOutsideDeployWindow(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2024, 3, 8, 15, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	environment := testEnvironment("prod", "users")
+	environment.DeployWindows = []DeployWindow{{Days: "mon-thu"}, {Days: "fri", End: "14:00"}}
+	deployer, client := newTestDeployer(t, testService("users", environment))
+	client.WriteFiles("", "Add templates", map[string]string{"templates/users/deployment.yaml": "image: users:{{ .Version }}\n"})
+
+	_, _, err := deployer.Deploy([]string{"users"}, "prod", testCommit, "", testUserFullname, testUserEmail)
+	assertValidationErr(t, err, "cannot deploy users to prod: outside deploy windows, next deploy window opens Mon 2024-03-11 00:00 UTC")
+
+	statuses, err := deployer.ListServiceEnvironmentsStatus([]string{"users"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	status := statuses["users"][0]
+	if status.DeployBlockedReason != "outside deploy windows" || !status.NextDeployWindow.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected deploy window status %+v", status)
+	}
+}
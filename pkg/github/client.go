@@ -23,17 +23,29 @@ import (
 
 type Client interface {
 	Clone(ctx context.Context, baseBranch, branch, folder string) (*github.Reference, error)
+	Download(ctx context.Context, branch, folder string) error
 	GetRef(ctx context.Context, baseBranch, branch string) (*github.Reference, error)
 	CreateTree(ctx context.Context, ref *github.Reference, baseFolder string, files []string) (tree *github.Tree, err error)
 	PushCommit(ctx context.Context, ref *github.Reference, tree *github.Tree, userFullname string, userEmail string, commitMessage string) (err error)
 	CreatePR(ctx context.Context, title, description, baseBranch, branch string) (*PullRequest, string, error)
-	MergePR(ctx context.Context, id int) error
+	GetPR(ctx context.Context, id int) (*PullRequest, error)
+	PullRequestDiff(ctx context.Context, id int) (string, error)
+	// MergePR squash merges the pull request, a non-empty note is appended to the merge commit message
+	MergePR(ctx context.Context, id int, note string) error
 	ClosePR(ctx context.Context, id int) error
 	GetCommitSha(ctx context.Context, organization, repository, commit string) (string, string, error)
+	GetCommit(ctx context.Context, organization, repository, commit string) (*Commit, error)
 	CommitInBranch(ctx context.Context, organization, repository, commit string, branches []string) (bool, error)
+	GetCommitChecks(ctx context.Context, organization, repository, commit string) ([]CommitCheck, error)
+	ListCommits(ctx context.Context, branch, path string, page, perPage int) ([]*Commit, error)
+	PullRequestLink(id int) string
 }
 
 func NewClient(ctx context.Context, config Config) (Client, error) {
+	if config.Organization == "" || config.Repository == "" || config.Auth.KeyPath == "" {
+		return nil, errors.New("github backend requires organization, repository and auth configuration")
+	}
+
 	client, err := createApiClient(config.Auth)
 	if err != nil {
 		return nil, err
@@ -81,19 +93,36 @@ func (c *apiClient) Clone(ctx context.Context, baseBranch, branch, folder string
 		return nil, err
 	}
 
-	archiveLink, _, err := c.client.Repositories.GetArchiveLink(ctx, c.organization, c.repository, github.Tarball, &github.RepositoryContentGetOptions{Ref: ref.GetRef()}, true)
+	err = c.download(ctx, ref.GetRef(), folder)
 	if err != nil {
 		return nil, err
 	}
 
+	return ref, nil
+}
+
+func (c *apiClient) Download(ctx context.Context, branch, folder string) error {
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	return c.download(ctx, "refs/heads/"+branch, folder)
+}
+
+func (c *apiClient) download(ctx context.Context, ref, folder string) error {
+	archiveLink, _, err := c.client.Repositories.GetArchiveLink(ctx, c.organization, c.repository, github.Tarball, &github.RepositoryContentGetOptions{Ref: ref}, true)
+	if err != nil {
+		return err
+	}
+
 	req, err := http.NewRequest(http.MethodGet, archiveLink.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build fetch request, error: %w", err)
+		return fmt.Errorf("failed to build fetch request, error: %w", err)
 	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch source from github, error: %w", err)
+		return fmt.Errorf("failed to fetch source from github, error: %w", err)
 	}
 
 	body := resp.Body
@@ -104,12 +133,7 @@ func (c *apiClient) Clone(ctx context.Context, baseBranch, branch, folder string
 		}
 	}()
 
-	err = c.extractTarGz(folder, body)
-	if err != nil {
-		return nil, err
-	}
-
-	return ref, nil
+	return ExtractTarGz(folder, body)
 }
 
 func (c *apiClient) GetRef(ctx context.Context, baseBranch, branch string) (*github.Reference, error) {
@@ -246,15 +270,29 @@ func (c *apiClient) CreatePR(ctx context.Context, title, description, baseBranch
 		return nil, "", err
 	}
 
-	diff, _, err := c.client.PullRequests.GetRaw(ctx, c.organization, c.repository, pr.GetNumber(), github.RawOptions{Type: github.Diff})
+	diff, err := c.PullRequestDiff(ctx, pr.GetNumber())
 	if err != nil {
 		return nil, "", err
 	}
 
-	return &PullRequest{Id: pr.GetNumber(), Link: pr.GetHTMLURL()}, diff, nil
+	return &PullRequest{Id: pr.GetNumber(), Link: pr.GetHTMLURL(), Title: pr.GetTitle()}, diff, nil
 }
 
-func (c *apiClient) MergePR(ctx context.Context, id int) error {
+func (c *apiClient) GetPR(ctx context.Context, id int) (*PullRequest, error) {
+	pr, _, err := c.client.PullRequests.Get(ctx, c.organization, c.repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PullRequest{Id: pr.GetNumber(), Link: pr.GetHTMLURL(), Title: pr.GetTitle()}, nil
+}
+
+func (c *apiClient) PullRequestDiff(ctx context.Context, id int) (string, error) {
+	diff, _, err := c.client.PullRequests.GetRaw(ctx, c.organization, c.repository, id, github.RawOptions{Type: github.Diff})
+	return diff, err
+}
+
+func (c *apiClient) MergePR(ctx context.Context, id int, note string) error {
 	pr, _, err := c.client.PullRequests.Get(ctx, c.organization, c.repository, id)
 	if err != nil {
 		return err
@@ -264,7 +302,13 @@ func (c *apiClient) MergePR(ctx context.Context, id int) error {
 		return errors.New("pull request is already merged")
 	}
 
-	_, _, err = c.client.PullRequests.Merge(ctx, c.organization, c.repository, id, "", &github.PullRequestOptions{MergeMethod: "squash"})
+	// An empty message lets GitHub list the commits of the branch, a note replaces that list with the description
+	var message string
+	if note != "" {
+		message = strings.TrimSpace(pr.GetBody() + "\n\n" + note)
+	}
+
+	_, _, err = c.client.PullRequests.Merge(ctx, c.organization, c.repository, id, message, &github.PullRequestOptions{MergeMethod: "squash"})
 	if err != nil {
 		return err
 	}
@@ -292,18 +336,34 @@ func (c *apiClient) ClosePR(ctx context.Context, id int) error {
 }
 
 func (c *apiClient) GetCommitSha(ctx context.Context, organization, repository, commit string) (string, string, error) {
+	ghCommit, err := c.GetCommit(ctx, organization, repository, commit)
+	if err != nil {
+		return "", "", err
+	}
+
+	return ghCommit.Sha, ghCommit.Link, nil
+}
+
+func (c *apiClient) GetCommit(ctx context.Context, organization, repository, commit string) (*Commit, error) {
 	ghCommit, _, err := c.client.Repositories.GetCommit(ctx, organization, repository, commit, &github.ListOptions{})
 	if err != nil {
 		if err, ok := err.(*github.ErrorResponse); ok {
 			if err.Response.StatusCode == http.StatusUnprocessableEntity {
-				return "", "", api.NewValidationErr("commit does not exist")
+				return nil, api.NewValidationErr("commit does not exist")
 			}
 		}
 
-		return "", "", err
+		return nil, err
 	}
 
-	return ghCommit.GetSHA(), ghCommit.GetHTMLURL(), nil
+	return &Commit{
+		Sha:         ghCommit.GetSHA(),
+		Link:        ghCommit.GetHTMLURL(),
+		Message:     ghCommit.GetCommit().GetMessage(),
+		AuthorName:  ghCommit.GetCommit().GetAuthor().GetName(),
+		AuthorEmail: ghCommit.GetCommit().GetAuthor().GetEmail(),
+		Date:        ghCommit.GetCommit().GetAuthor().GetDate(),
+	}, nil
 }
 
 func (c *apiClient) CommitInBranch(ctx context.Context, organization, repository, commit string, branches []string) (bool, error) {
@@ -328,6 +388,112 @@ func (c *apiClient) CommitInBranch(ctx context.Context, organization, repository
 	return false, nil
 }
 
+// GetCommitChecks returns the latest check runs and commit statuses of the commit
+func (c *apiClient) GetCommitChecks(ctx context.Context, organization, repository, commit string) ([]CommitCheck, error) {
+	var checks []CommitCheck
+	statusOpts := &github.ListOptions{PerPage: 100}
+	for {
+		combined, resp, err := c.client.Repositories.GetCombinedStatus(ctx, organization, repository, commit, statusOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, status := range combined.Statuses {
+			checks = append(checks, CommitCheck{
+				Name:  status.GetContext(),
+				State: commitStatusState(status.GetState()),
+				Link:  status.GetTargetURL(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		statusOpts.Page = resp.NextPage
+	}
+
+	checkRunOpts := &github.ListCheckRunsOptions{Filter: github.String("latest"), ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		checkRuns, resp, err := c.client.Checks.ListCheckRunsForRef(ctx, organization, repository, commit, checkRunOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, checkRun := range checkRuns.CheckRuns {
+			checks = append(checks, CommitCheck{
+				Name:  checkRun.GetName(),
+				State: checkRunState(checkRun.GetStatus(), checkRun.GetConclusion()),
+				Link:  checkRun.GetHTMLURL(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		checkRunOpts.Page = resp.NextPage
+	}
+
+	return checks, nil
+}
+
+func commitStatusState(state string) string {
+	switch state {
+	case "success":
+		return CheckStateSuccess
+	case "pending":
+		return CheckStatePending
+	default:
+		return CheckStateFailure
+	}
+}
+
+func checkRunState(status, conclusion string) string {
+	if status != "completed" {
+		return CheckStatePending
+	}
+
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return CheckStateSuccess
+	default:
+		return CheckStateFailure
+	}
+}
+
+func (c *apiClient) ListCommits(ctx context.Context, branch, path string, page, perPage int) ([]*Commit, error) {
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	opts := &github.CommitsListOptions{
+		SHA:         branch,
+		Path:        path,
+		ListOptions: github.ListOptions{Page: page, PerPage: perPage},
+	}
+	ghCommits, _, err := c.client.Repositories.ListCommits(ctx, c.organization, c.repository, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]*Commit, 0, len(ghCommits))
+	for _, ghCommit := range ghCommits {
+		commits = append(commits, &Commit{
+			Sha:         ghCommit.GetSHA(),
+			Link:        ghCommit.GetHTMLURL(),
+			Message:     ghCommit.GetCommit().GetMessage(),
+			AuthorName:  ghCommit.GetCommit().GetAuthor().GetName(),
+			AuthorEmail: ghCommit.GetCommit().GetAuthor().GetEmail(),
+			Date:        ghCommit.GetCommit().GetAuthor().GetDate(),
+		})
+	}
+
+	return commits, nil
+}
+
+func (c *apiClient) PullRequestLink(id int) string {
+	return fmt.Sprintf("https://github.com/%s/%s/pull/%d", c.organization, c.repository, id)
+}
+
 func (c *apiClient) deleteBranch(ctx context.Context, branchName string) error {
 	_, err := c.client.Git.DeleteRef(ctx, c.organization, c.repository, "heads/"+branchName)
 	if err != nil && strings.Contains(err.Error(), "Reference does not exist") {
@@ -337,7 +503,7 @@ func (c *apiClient) deleteBranch(ctx context.Context, branchName string) error {
 	return err
 }
 
-func (c *apiClient) extractTarGz(targetPath string, gzipStream io.Reader) error {
+func ExtractTarGz(targetPath string, gzipStream io.Reader) error {
 	uncompressedStream, err := gzip.NewReader(gzipStream)
 	if err != nil {
 		return fmt.Errorf("failed to create gzip reader, error: %w", err)
@@ -354,14 +520,14 @@ func (c *apiClient) extractTarGz(targetPath string, gzipStream io.Reader) error
 			return fmt.Errorf("failed to get next value from tar reader, error: %w", err)
 		}
 
-		name := c.removeFirstPathPart(header.Name)
+		name := removeFirstPathPart(header.Name)
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.Mkdir(path.Join(targetPath, name), 0755); err != nil && !errors.Is(err, os.ErrExist) {
 				return fmt.Errorf("failed to create directory %s, error: %w", name, err)
 			}
 		case tar.TypeReg:
-			err := c.createFile(targetPath, header, tarReader)
+			err := createFile(targetPath, header, tarReader)
 			if err != nil {
 				return err
 			}
@@ -375,8 +541,8 @@ func (c *apiClient) extractTarGz(targetPath string, gzipStream io.Reader) error
 	return nil
 }
 
-func (c *apiClient) createFile(targetPath string, header *tar.Header, tarReader *tar.Reader) error {
-	fullPath := path.Join(targetPath, c.removeFirstPathPart(header.Name))
+func createFile(targetPath string, header *tar.Header, tarReader *tar.Reader) error {
+	fullPath := path.Join(targetPath, removeFirstPathPart(header.Name))
 	err := os.MkdirAll(path.Dir(fullPath), 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create parent directories %s, error: %w", targetPath, err)
@@ -401,7 +567,7 @@ func (c *apiClient) createFile(targetPath string, header *tar.Header, tarReader
 	return nil
 }
 
-func (c *apiClient) removeFirstPathPart(name string) string {
+func removeFirstPathPart(name string) string {
 	firstPathSeparatorIdx := strings.Index(name, "/")
 	if firstPathSeparatorIdx == -1 {
 		return name
@@ -0,0 +1,25 @@
+package github
+
+import "time"
+
+type Commit struct {
+	Sha         string    `json:"sha,omitempty"`
+	Link        string    `json:"link,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	AuthorName  string    `json:"author_name,omitempty"`
+	AuthorEmail string    `json:"author_email,omitempty"`
+	Date        time.Time `json:"date,omitempty"`
+}
+
+const (
+	CheckStateSuccess = "success"
+	CheckStatePending = "pending"
+	CheckStateFailure = "failure"
+)
+
+// CommitCheck is a CI result reported on a commit, either a check run or a commit status
+type CommitCheck struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Link  string `json:"link,omitempty"`
+}
@@ -1,16 +1,44 @@
 package github
 
+const (
+	BackendGithub = "github"
+	BackendGit    = "git"
+	BackendGitlab = "gitlab"
+)
+
 type Config struct {
-	Auth         AuthConfig `required:"true"`
-	Organization string     `required:"true"`
-	Repository   string     `required:"true"`
-	AuthorName   string     `required:"true" default:"Argo Bot"`
-	AuthorEmail  string     `required:"true"`
-	CloneTmpDir  string     `required:"true" default:"/tmp"`
+	Backend      string `default:"github"`
+	Auth         AuthConfig
+	Organization string
+	Repository   string
+	AuthorName   string `required:"true" default:"Argo Bot"`
+	AuthorEmail  string `required:"true"`
+	CloneTmpDir  string `required:"true" default:"/tmp"`
+	Git          GitConfig
+	Gitlab       GitlabConfig
 }
 
 type AuthConfig struct {
-	KeyPath        string `required:"true"`
-	AppId          int    `required:"true"`
-	InstallationId int    `required:"true"`
+	KeyPath        string
+	AppId          int
+	InstallationId int
+}
+
+type GitConfig struct {
+	Url                      string
+	BaseBranch               string
+	Username                 string `default:"git"`
+	Password                 string
+	SshKeyPath               string
+	StateDir                 string
+	PullRequestMode          string `default:"branch"`
+	PullRequestUrlTemplate   string
+	CommitUrlTemplate        string
+	ServiceRepositoryUrl     string
+	ServiceCommitUrlTemplate string
+}
+
+type GitlabConfig struct {
+	Url   string `default:"https://gitlab.com"`
+	Token string
 }
@@ -0,0 +1,1098 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/google/go-github/v45/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PullRequestModeBranch pushes the deployment branch to the remote and merges it into the base branch on approval
+	PullRequestModeBranch = "branch"
+	// PullRequestModeDirect keeps the deployment branch local and pushes directly to the base branch on approval
+	PullRequestModeDirect = "direct"
+
+	remoteName          = "origin"
+	pullRequestsFile    = "pull-requests.json"
+	pullRequestOpen     = "open"
+	pullRequestMerged   = "merged"
+	pullRequestClosed   = "closed"
+	maxMergeRetries     = 3
+	serviceReposDirName = "services"
+)
+
+// NewGitClient creates a Client for any git remote, pull requests are tracked in a local approval record
+// stored next to a bare mirror of the deployment repository. The state directory must survive restarts,
+// otherwise open pull requests are lost.
+func NewGitClient(ctx context.Context, config Config) (Client, error) {
+	gitConfig := config.Git
+	if gitConfig.Url == "" {
+		return nil, errors.New("git backend requires url configuration")
+	}
+
+	if gitConfig.PullRequestMode != PullRequestModeBranch && gitConfig.PullRequestMode != PullRequestModeDirect {
+		return nil, fmt.Errorf("unknown pull request mode %s", gitConfig.PullRequestMode)
+	}
+
+	auth, err := gitAuth(gitConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	stateDir := gitConfig.StateDir
+	if stateDir == "" {
+		return nil, errors.New("git backend requires stateDir configuration, a persistent directory for pull request records")
+	}
+
+	repo, err := openStateRepository(filepath.Join(stateDir, "repository.git"), gitConfig.Url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local git repository, error: %w", err)
+	}
+
+	c := &gitClient{
+		repo:         repo,
+		serviceRepos: make(map[string]*git.Repository),
+		auth:         auth,
+		config:       gitConfig,
+		stateDir:     stateDir,
+		authorName:   config.AuthorName,
+		authorEmail:  config.AuthorEmail,
+		baseBranch:   gitConfig.BaseBranch,
+	}
+
+	if c.baseBranch == "" {
+		c.baseBranch, err = c.detectDefaultBranch(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func gitAuth(config GitConfig) (transport.AuthMethod, error) {
+	if config.SshKeyPath != "" {
+		return ssh.NewPublicKeysFromFile(config.Username, config.SshKeyPath, "")
+	}
+
+	if config.Password != "" {
+		return &http.BasicAuth{Username: config.Username, Password: config.Password}, nil
+	}
+
+	return nil, nil
+}
+
+func openStateRepository(repositoryPath, url string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(repositoryPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainInit(repositoryPath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
+			Name:  remoteName,
+			URLs:  []string{url},
+			Fetch: []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+type gitClient struct {
+	mu           sync.Mutex
+	repo         *git.Repository
+	serviceMu    sync.Mutex
+	serviceRepos map[string]*git.Repository
+	auth         transport.AuthMethod
+	config       GitConfig
+	stateDir     string
+	authorName   string
+	authorEmail  string
+	baseBranch   string
+}
+
+type gitPullRequest struct {
+	Id          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	BaseBranch  string    `json:"base_branch"`
+	Branch      string    `json:"branch"`
+	State       string    `json:"state"`
+	Link        string    `json:"link"`
+	ForkSha     string    `json:"fork_sha,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type gitPullRequests struct {
+	NextId       int                     `json:"next_id"`
+	PullRequests map[int]*gitPullRequest `json:"pull_requests"`
+}
+
+type treeFile struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (c *gitClient) Clone(ctx context.Context, baseBranch, branch, folder string) (*github.Reference, error) {
+	ref, err := c.GetRef(ctx, baseBranch, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ref, c.checkout(plumbing.NewHash(ref.GetObject().GetSHA()), folder)
+}
+
+func (c *gitClient) Download(ctx context.Context, branch, folder string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		return err
+	}
+
+	hash, err := c.remoteBranchHash(branch)
+	if err != nil {
+		return err
+	}
+
+	return c.checkout(hash, folder)
+}
+
+func (c *gitClient) GetRef(ctx context.Context, baseBranch, branch string) (*github.Reference, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	if baseBranch == branch {
+		return nil, errors.New("branch name cannot be the same as the base branch")
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := c.deleteBranch(ctx, branch); err != nil {
+		return nil, err
+	}
+
+	baseHash, err := c.remoteBranchHash(baseBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	refName := plumbing.NewBranchReferenceName(branch)
+	if err := c.repo.Storer.SetReference(plumbing.NewHashReference(refName, baseHash)); err != nil {
+		return nil, err
+	}
+
+	return &github.Reference{Ref: github.String(refName.String()), Object: &github.GitObject{SHA: github.String(baseHash.String())}}, nil
+}
+
+func (c *gitClient) CreateTree(_ context.Context, ref *github.Reference, baseFolder string, files []string) (*github.Tree, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parent, err := c.repo.CommitObject(plumbing.NewHash(ref.GetObject().GetSHA()))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := c.treeFiles(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		content, mode, err := readTreeFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				delete(entries, filepath.ToSlash(file))
+				continue
+			}
+			return nil, err
+		}
+
+		// Updated files keep their executable bit
+		if existing, ok := entries[filepath.ToSlash(file)]; ok && existing.mode == filemode.Executable && mode == filemode.Regular {
+			mode = filemode.Executable
+		}
+
+		hash, err := c.writeBlob(content)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[filepath.ToSlash(file)] = treeFile{hash: hash, mode: mode}
+	}
+
+	treeHash, err := c.writeTree(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &github.Tree{SHA: github.String(treeHash.String())}, nil
+}
+
+func (c *gitClient) PushCommit(ctx context.Context, ref *github.Reference, tree *github.Tree, userFullname string, userEmail string, commitMessage string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	hash, err := c.writeCommit(&object.Commit{
+		Author:       object.Signature{Name: userFullname, Email: userEmail, When: now},
+		Committer:    object.Signature{Name: c.authorName, Email: c.authorEmail, When: now},
+		Message:      commitMessage,
+		TreeHash:     plumbing.NewHash(tree.GetSHA()),
+		ParentHashes: []plumbing.Hash{plumbing.NewHash(ref.GetObject().GetSHA())},
+	})
+	if err != nil {
+		return err
+	}
+
+	refName := plumbing.ReferenceName(ref.GetRef())
+	if err := c.repo.Storer.SetReference(plumbing.NewHashReference(refName, hash)); err != nil {
+		return err
+	}
+	ref.Object.SHA = github.String(hash.String())
+
+	if c.config.PullRequestMode == PullRequestModeDirect {
+		return nil
+	}
+
+	return c.push(ctx, gitconfig.RefSpec(fmt.Sprintf("+%s:%s", refName, refName)))
+}
+
+func (c *gitClient) CreatePR(_ context.Context, title, description, baseBranch, branch string) (*PullRequest, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	head, err := c.repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find branch %s, error: %w", branch, err)
+	}
+
+	headCommit, err := c.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, "", err
+	}
+
+	fork, err := headCommit.Parent(0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find base of branch %s, error: %w", branch, err)
+	}
+
+	diff, err := c.branchDiff(fork, headCommit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pullRequests, err := c.loadPullRequests()
+	if err != nil {
+		return nil, "", err
+	}
+
+	pullRequests.NextId++
+	pr := &gitPullRequest{
+		Id:          pullRequests.NextId,
+		Title:       title,
+		Description: description,
+		BaseBranch:  baseBranch,
+		Branch:      branch,
+		State:       pullRequestOpen,
+		ForkSha:     fork.Hash.String(),
+		CreatedAt:   time.Now(),
+	}
+	pr.Link = c.pullRequestLink(pr)
+	pullRequests.PullRequests[pr.Id] = pr
+
+	if err := c.savePullRequests(pullRequests); err != nil {
+		return nil, "", err
+	}
+
+	return &PullRequest{Id: pr.Id, Link: pr.Link, Title: pr.Title}, diff, nil
+}
+
+func (c *gitClient) GetPR(_ context.Context, id int) (*PullRequest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, pr, err := c.getPullRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PullRequest{Id: pr.Id, Link: pr.Link, Title: pr.Title}, nil
+}
+
+func (c *gitClient) PullRequestDiff(_ context.Context, id int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, pr, err := c.getPullRequest(id)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := c.repo.Reference(plumbing.NewBranchReferenceName(pr.Branch), true)
+	if err != nil {
+		return "", fmt.Errorf("failed to find branch %s, error: %w", pr.Branch, err)
+	}
+
+	headCommit, err := c.repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", err
+	}
+
+	fork, err := c.forkCommit(pr, headCommit)
+	if err != nil {
+		return "", err
+	}
+
+	return c.branchDiff(fork, headCommit)
+}
+
+func (c *gitClient) MergePR(ctx context.Context, id int, note string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pullRequests, pr, err := c.getPullRequest(id)
+	if err != nil {
+		return err
+	}
+
+	head, err := c.repo.Reference(plumbing.NewBranchReferenceName(pr.Branch), true)
+	if err != nil {
+		return fmt.Errorf("failed to find branch %s, error: %w", pr.Branch, err)
+	}
+
+	var mergeErr error
+	for attempt := 0; attempt < maxMergeRetries; attempt++ {
+		mergeErr = c.squashMerge(ctx, pr, head.Hash(), note)
+		if mergeErr == nil {
+			break
+		}
+
+		if !errors.Is(mergeErr, git.ErrNonFastForwardUpdate) {
+			return mergeErr
+		}
+
+		log.WithError(mergeErr).WithField("retry", attempt+1).Warn("Base branch changed during merge, retrying")
+	}
+	if mergeErr != nil {
+		return fmt.Errorf("failed to merge pull request after %d retries: %w", maxMergeRetries, mergeErr)
+	}
+
+	pr.State = pullRequestMerged
+	if err := c.savePullRequests(pullRequests); err != nil {
+		return err
+	}
+
+	return c.deleteBranch(ctx, pr.Branch)
+}
+
+func (c *gitClient) ClosePR(ctx context.Context, id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pullRequests, pr, err := c.getPullRequest(id)
+	if err != nil {
+		return err
+	}
+
+	pr.State = pullRequestClosed
+	if err := c.savePullRequests(pullRequests); err != nil {
+		return err
+	}
+
+	return c.deleteBranch(ctx, pr.Branch)
+}
+
+func (c *gitClient) GetCommitSha(ctx context.Context, organization, repository, commit string) (string, string, error) {
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+
+	_, hash, err := c.resolveServiceCommit(ctx, organization, repository, commit, false)
+	if err != nil {
+		return "", "", err
+	}
+
+	return hash.String(), c.serviceCommitLink(organization, repository, hash.String()), nil
+}
+
+func (c *gitClient) GetCommit(ctx context.Context, organization, repository, commit string) (*Commit, error) {
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+
+	repo, hash, err := c.resolveServiceCommit(ctx, organization, repository, commit, false)
+	if err != nil {
+		return nil, err
+	}
+
+	commitObject, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Commit{
+		Sha:         hash.String(),
+		Link:        c.serviceCommitLink(organization, repository, hash.String()),
+		Message:     commitObject.Message,
+		AuthorName:  commitObject.Author.Name,
+		AuthorEmail: commitObject.Author.Email,
+		Date:        commitObject.Author.When,
+	}, nil
+}
+
+func (c *gitClient) GetCommitChecks(_ context.Context, _, _, _ string) ([]CommitCheck, error) {
+	return nil, errors.New("commit checks are not supported by the git backend")
+}
+
+func (c *gitClient) CommitInBranch(ctx context.Context, organization, repository, commit string, branches []string) (bool, error) {
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+
+	// Branches move, so their heads are always fetched
+	repo, hash, err := c.resolveServiceCommit(ctx, organization, repository, commit, true)
+	if err != nil {
+		return false, err
+	}
+
+	commitObject, err := repo.CommitObject(*hash)
+	if err != nil {
+		return false, err
+	}
+
+	for _, branch := range branches {
+		branchRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+		if err != nil {
+			if errors.Is(err, plumbing.ErrReferenceNotFound) {
+				continue
+			}
+			return false, err
+		}
+
+		if branchRef.Hash() == *hash {
+			return true, nil
+		}
+
+		branchHead, err := repo.CommitObject(branchRef.Hash())
+		if err != nil {
+			return false, err
+		}
+
+		isAncestor, err := commitObject.IsAncestor(branchHead)
+		if err != nil {
+			return false, err
+		}
+		if isAncestor {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *gitClient) ListCommits(ctx context.Context, branch, filePath string, page, perPage int) ([]*Commit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	head, err := c.remoteBranchHash(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	logOptions := &git.LogOptions{From: head, Order: git.LogOrderCommitterTime}
+	filePath = strings.Trim(filepath.ToSlash(filePath), "/")
+	if filePath != "" {
+		logOptions.PathFilter = func(p string) bool {
+			return p == filePath || strings.HasPrefix(p, filePath+"/")
+		}
+	}
+
+	iter, err := c.repo.Log(logOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	skip := (page - 1) * perPage
+	var commits []*Commit
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if skip > 0 {
+			skip--
+			return nil
+		}
+
+		if len(commits) >= perPage {
+			return io.EOF
+		}
+
+		commits = append(commits, &Commit{
+			Sha:         commit.Hash.String(),
+			Link:        expandTemplate(c.config.CommitUrlTemplate, map[string]string{"sha": commit.Hash.String()}),
+			Message:     commit.Message,
+			AuthorName:  commit.Author.Name,
+			AuthorEmail: commit.Author.Email,
+			Date:        commit.Author.When,
+		})
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return commits, nil
+}
+
+func (c *gitClient) PullRequestLink(id int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pullRequests, err := c.loadPullRequests()
+	if err == nil {
+		if pr, ok := pullRequests.PullRequests[id]; ok {
+			return pr.Link
+		}
+	}
+
+	return c.pullRequestLink(&gitPullRequest{Id: id})
+}
+
+func (c *gitClient) squashMerge(ctx context.Context, pr *gitPullRequest, headHash plumbing.Hash, note string) error {
+	if err := c.fetch(ctx); err != nil {
+		return err
+	}
+
+	baseHash, err := c.remoteBranchHash(pr.BaseBranch)
+	if err != nil {
+		return err
+	}
+
+	head, err := c.repo.CommitObject(headHash)
+	if err != nil {
+		return err
+	}
+
+	fork, err := c.forkCommit(pr, head)
+	if err != nil {
+		return err
+	}
+
+	treeHash := head.TreeHash
+	if fork.Hash != baseHash {
+		treeHash, err = c.rebaseTree(pr, fork, head, baseHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("%s (#%d)\n\n%s", pr.Title, pr.Id, pr.Description)
+	if note != "" {
+		message += "\n\n" + note
+	}
+
+	// The squash commit is dated when merged, like the squash commits of the hosted backends
+	now := time.Now()
+	mergeHash, err := c.writeCommit(&object.Commit{
+		Author:       object.Signature{Name: head.Author.Name, Email: head.Author.Email, When: now},
+		Committer:    object.Signature{Name: c.authorName, Email: c.authorEmail, When: now},
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{baseHash},
+	})
+	if err != nil {
+		return err
+	}
+
+	baseRefName := plumbing.NewBranchReferenceName(pr.BaseBranch)
+	if err := c.repo.Storer.SetReference(plumbing.NewHashReference(baseRefName, mergeHash)); err != nil {
+		return err
+	}
+
+	return c.push(ctx, gitconfig.RefSpec(fmt.Sprintf("%s:%s", baseRefName, baseRefName)))
+}
+
+// rebaseTree applies the changes of the branch on top of the current base branch,
+// failing when a changed file was also modified on the base branch since the branch was created.
+func (c *gitClient) rebaseTree(pr *gitPullRequest, fork, head *object.Commit, baseHash plumbing.Hash) (plumbing.Hash, error) {
+	base, err := c.repo.CommitObject(baseHash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	forkFiles, err := c.treeFiles(fork)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	headFiles, err := c.treeFiles(head)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	baseFiles, err := c.treeFiles(base)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	changed := make(map[string]struct{})
+	for file, entry := range headFiles {
+		if forkFiles[file] != entry {
+			changed[file] = struct{}{}
+		}
+	}
+	for file := range forkFiles {
+		if _, exists := headFiles[file]; !exists {
+			changed[file] = struct{}{}
+		}
+	}
+
+	for file := range changed {
+		if baseFiles[file] != forkFiles[file] {
+			return plumbing.ZeroHash, fmt.Errorf("pull request %d conflicts with %s on file %s", pr.Id, pr.BaseBranch, file)
+		}
+
+		if entry, exists := headFiles[file]; exists {
+			baseFiles[file] = entry
+		} else {
+			delete(baseFiles, file)
+		}
+	}
+
+	return c.writeTree(baseFiles)
+}
+
+// forkCommit returns the base branch commit the pull request branch was created from. Records written before the
+// fork was tracked fall back to the parent of the branch head, as those branches always hold a single commit.
+func (c *gitClient) forkCommit(pr *gitPullRequest, head *object.Commit) (*object.Commit, error) {
+	if pr.ForkSha != "" {
+		return c.repo.CommitObject(plumbing.NewHash(pr.ForkSha))
+	}
+
+	fork, err := head.Parent(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find base of branch %s, error: %w", pr.Branch, err)
+	}
+
+	return fork, nil
+}
+
+func (c *gitClient) branchDiff(fork, head *object.Commit) (string, error) {
+	patch, err := fork.Patch(head)
+	if err != nil {
+		return "", fmt.Errorf("failed to create diff, error: %w", err)
+	}
+
+	return patch.String(), nil
+}
+
+func (c *gitClient) checkout(hash plumbing.Hash, folder string) error {
+	commit, err := c.repo.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	files, err := commit.Files()
+	if err != nil {
+		return err
+	}
+
+	return files.ForEach(func(file *object.File) error {
+		fullPath := filepath.Join(folder, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directories %s, error: %w", fullPath, err)
+		}
+
+		content, err := file.Contents()
+		if err != nil {
+			return fmt.Errorf("failed to read file %s, error: %w", file.Name, err)
+		}
+
+		switch file.Mode {
+		case filemode.Symlink:
+			return os.Symlink(content, fullPath)
+		case filemode.Executable:
+			return os.WriteFile(fullPath, []byte(content), 0755)
+		default:
+			return os.WriteFile(fullPath, []byte(content), 0644)
+		}
+	})
+}
+
+// readTreeFile reads a file of the working folder with its tree entry mode, the content of a symlink is its target
+func readTreeFile(fullPath string) ([]byte, filemode.FileMode, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, filemode.Empty, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		return []byte(target), filemode.Symlink, err
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, filemode.Empty, err
+	}
+
+	if info.Mode()&0111 != 0 {
+		return content, filemode.Executable, nil
+	}
+
+	return content, filemode.Regular, nil
+}
+
+func (c *gitClient) treeFiles(commit *object.Commit) (map[string]treeFile, error) {
+	files, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]treeFile)
+	err = files.ForEach(func(file *object.File) error {
+		entries[file.Name] = treeFile{hash: file.Hash, mode: file.Mode}
+		return nil
+	})
+
+	return entries, err
+}
+
+func (c *gitClient) writeBlob(content []byte) (plumbing.Hash, error) {
+	obj := c.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		_ = writer.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return c.repo.Storer.SetEncodedObject(obj)
+}
+
+// writeTree stores the nested tree objects for a flat list of file paths and returns the root tree hash.
+func (c *gitClient) writeTree(entries map[string]treeFile) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	subTrees := make(map[string]map[string]treeFile)
+	for filePath, entry := range entries {
+		dir, rest, nested := strings.Cut(filePath, "/")
+		if !nested {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: filePath, Mode: entry.mode, Hash: entry.hash})
+			continue
+		}
+
+		if subTrees[dir] == nil {
+			subTrees[dir] = make(map[string]treeFile)
+		}
+		subTrees[dir][rest] = entry
+	}
+
+	for dir, subEntries := range subTrees {
+		hash, err := c.writeTree(subEntries)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+
+	sort.Sort(object.TreeEntrySorter(tree.Entries))
+
+	obj := c.repo.Storer.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return c.repo.Storer.SetEncodedObject(obj)
+}
+
+func (c *gitClient) writeCommit(commit *object.Commit) (plumbing.Hash, error) {
+	obj := c.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return c.repo.Storer.SetEncodedObject(obj)
+}
+
+func (c *gitClient) fetch(ctx context.Context) error {
+	err := c.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		Auth:       c.auth,
+		Force:      true,
+		Prune:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch deployment repository, error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *gitClient) push(ctx context.Context, refSpecs ...gitconfig.RefSpec) error {
+	err := c.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   refSpecs,
+		Auth:       c.auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	return nil
+}
+
+func (c *gitClient) remoteBranchHash(branch string) (plumbing.Hash, error) {
+	ref, err := c.repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to find branch %s, error: %w", branch, err)
+	}
+
+	return ref.Hash(), nil
+}
+
+func (c *gitClient) deleteBranch(ctx context.Context, branch string) error {
+	refName := plumbing.NewBranchReferenceName(branch)
+	if err := c.repo.Storer.RemoveReference(refName); err != nil {
+		return err
+	}
+
+	if c.config.PullRequestMode == PullRequestModeDirect {
+		return nil
+	}
+
+	if _, err := c.repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true); err != nil {
+		return nil
+	}
+
+	return c.push(ctx, gitconfig.RefSpec(":"+refName.String()))
+}
+
+func (c *gitClient) detectDefaultBranch(ctx context.Context) (string, error) {
+	remote, err := c.repo.Remote(remoteName)
+	if err != nil {
+		return "", err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: c.auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote references, error: %w", err)
+	}
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+
+	return "", errors.New("could not detect default branch of the deployment repository, please configure baseBranch")
+}
+
+func (c *gitClient) getPullRequest(id int) (*gitPullRequests, *gitPullRequest, error) {
+	pullRequests, err := c.loadPullRequests()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr, ok := pullRequests.PullRequests[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("pull request %d does not exist", id)
+	}
+
+	switch pr.State {
+	case pullRequestMerged:
+		return nil, nil, errors.New("pull request is already merged")
+	case pullRequestClosed:
+		return nil, nil, errors.New("pull request is already closed")
+	}
+
+	return pullRequests, pr, nil
+}
+
+func (c *gitClient) loadPullRequests() (*gitPullRequests, error) {
+	pullRequests := &gitPullRequests{PullRequests: make(map[int]*gitPullRequest)}
+	content, err := os.ReadFile(filepath.Join(c.stateDir, pullRequestsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pullRequests, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, pullRequests); err != nil {
+		return nil, fmt.Errorf("failed to parse pull requests record, error: %w", err)
+	}
+
+	return pullRequests, nil
+}
+
+func (c *gitClient) savePullRequests(pullRequests *gitPullRequests) error {
+	content, err := json.MarshalIndent(pullRequests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := filepath.Join(c.stateDir, pullRequestsFile+".tmp")
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, filepath.Join(c.stateDir, pullRequestsFile))
+}
+
+func (c *gitClient) pullRequestLink(pr *gitPullRequest) string {
+	if c.config.PullRequestUrlTemplate == "" {
+		return fmt.Sprintf("%s#%s", c.config.Url, pr.Branch)
+	}
+
+	return expandTemplate(c.config.PullRequestUrlTemplate, map[string]string{
+		"id":     strconv.Itoa(pr.Id),
+		"branch": pr.Branch,
+		"base":   pr.BaseBranch,
+	})
+}
+
+// resolveServiceCommit resolves a commit of a service repository in its local mirror. The mirror is only fetched
+// when the commit is not a full sha that is already known, or when refresh is set.
+func (c *gitClient) resolveServiceCommit(ctx context.Context, organization, repository, commit string, refresh bool) (*git.Repository, *plumbing.Hash, error) {
+	repo, err := c.openServiceRepository(organization, repository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !refresh && plumbing.IsHash(commit) {
+		hash := plumbing.NewHash(commit)
+		if _, err := repo.CommitObject(hash); err == nil {
+			return repo, &hash, nil
+		}
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		Auth:       c.auth,
+		Force:      true,
+		Prune:      true,
+		Tags:       git.AllTags,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, nil, fmt.Errorf("failed to fetch service repository %s, error: %w", path.Join(organization, repository), err)
+	}
+
+	hash, err := resolveServiceRevision(repo, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return repo, hash, nil
+}
+
+// openServiceRepository returns the bare mirror of a service repository kept in the state directory,
+// creating it on first use.
+func (c *gitClient) openServiceRepository(organization, repository string) (*git.Repository, error) {
+	if c.config.ServiceRepositoryUrl == "" {
+		return nil, errors.New("git backend requires serviceRepositoryUrl configuration to resolve service commits")
+	}
+
+	url := expandTemplate(c.config.ServiceRepositoryUrl, map[string]string{
+		"organization": organization,
+		"repository":   repository,
+	})
+
+	if repo, ok := c.serviceRepos[url]; ok {
+		return repo, nil
+	}
+
+	repositoryPath := filepath.Join(c.stateDir, serviceReposDirName, organization, repository+".git")
+	repo, err := openStateRepository(repositoryPath, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mirror of service repository %s, error: %w", path.Join(organization, repository), err)
+	}
+
+	c.serviceRepos[url] = repo
+	return repo, nil
+}
+
+func (c *gitClient) serviceCommitLink(organization, repository, sha string) string {
+	return expandTemplate(c.config.ServiceCommitUrlTemplate, map[string]string{
+		"organization": organization,
+		"repository":   repository,
+		"sha":          sha,
+	})
+}
+
+func resolveServiceRevision(repo *git.Repository, commit string) (*plumbing.Hash, error) {
+	for _, revision := range []string{commit, remoteName + "/" + commit} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+		if err == nil {
+			return hash, nil
+		}
+	}
+
+	return nil, api.NewValidationErr("commit does not exist")
+}
+
+func expandTemplate(template string, values map[string]string) string {
+	for key, value := range values {
+		template = strings.ReplaceAll(template, "{"+key+"}", value)
+	}
+
+	return template
+}
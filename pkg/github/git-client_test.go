@@ -0,0 +1,541 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	testBaseBranch  = "main"
+	testAuthorName  = "Argo Bot"
+	testAuthorEmail = "argo-bot@example.com"
+)
+
+// testRemote is a bare repository served over file://, changed through a separate working copy
+type testRemote struct {
+	t        *testing.T
+	bareDir  string
+	url      string
+	worktree *git.Repository
+}
+
+func newTestRemote(t *testing.T, files map[string]string) *testRemote {
+	t.Helper()
+
+	bareDir := filepath.Join(t.TempDir(), "remote.git")
+	bare, err := git.PlainInit(bareDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default branch is detected from the remote HEAD
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(testBaseBranch))
+	if err := bare.Storer.SetReference(head); err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "file://" + bareDir
+	_, err = worktree.CreateRemote(&gitconfig.RemoteConfig{Name: remoteName, URLs: []string{url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &testRemote{t: t, bareDir: bareDir, url: url, worktree: worktree}
+	remote.commit("Initial commit", files)
+	return remote
+}
+
+// commit commits the files to the base branch of the remote and returns the commit sha
+func (r *testRemote) commit(message string, files map[string]string) string {
+	r.t.Helper()
+
+	return r.commitModes(message, files, nil)
+}
+
+// commitModes commits the files like commit, files with a mode are written with it and the content of a symlink is
+// its target
+func (r *testRemote) commitModes(message string, files map[string]string, modes map[string]os.FileMode) string {
+	r.t.Helper()
+
+	tree, err := r.worktree.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	for file, content := range files {
+		fullPath := filepath.Join(tree.Filesystem.Root(), file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			r.t.Fatal(err)
+		}
+		mode, ok := modes[file]
+		if !ok {
+			mode = 0644
+		}
+		if mode&os.ModeSymlink != 0 {
+			if err := os.Symlink(content, fullPath); err != nil {
+				r.t.Fatal(err)
+			}
+		} else if err := os.WriteFile(fullPath, []byte(content), mode); err != nil {
+			r.t.Fatal(err)
+		}
+		if _, err := tree.Add(file); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+
+	hash, err := tree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Jane Doe", Email: "jane@example.com", When: time.Now()},
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	head, err := r.worktree.Head()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	err = r.worktree.Push(&git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", head.Name(), plumbing.NewBranchReferenceName(testBaseBranch)))},
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return hash.String()
+}
+
+// file reads a file from the head of a branch of the remote
+func (r *testRemote) file(branch, file string) string {
+	r.t.Helper()
+
+	content, err := r.treeFile(branch, file).Contents()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return content
+}
+
+// treeFile returns the tree entry of a file at the head of a branch of the remote
+func (r *testRemote) treeFile(branch, file string) *object.File {
+	r.t.Helper()
+
+	repo, err := git.PlainOpen(r.bareDir)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	f, err := commit.File(file)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return f
+}
+
+func (r *testRemote) hasBranch(branch string) bool {
+	r.t.Helper()
+
+	repo, err := git.PlainOpen(r.bareDir)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	_, err = repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	return err == nil
+}
+
+func newTestGitClient(t *testing.T, url, stateDir string, configure func(*GitConfig)) Client {
+	t.Helper()
+
+	config := Config{
+		AuthorName:  testAuthorName,
+		AuthorEmail: testAuthorEmail,
+		CloneTmpDir: t.TempDir(),
+		Git: GitConfig{
+			Url:             url,
+			StateDir:        stateDir,
+			PullRequestMode: PullRequestModeBranch,
+		},
+	}
+	if configure != nil {
+		configure(&config.Git)
+	}
+
+	client, err := NewGitClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+// openTestPR clones the base branch, changes the files and opens a pull request for them
+func openTestPR(t *testing.T, client Client, branch string, files map[string]string) (*PullRequest, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	folder := t.TempDir()
+	ref, err := client.Clone(ctx, "", branch, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changed []string
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(folder, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(folder, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		changed = append(changed, file)
+	}
+
+	tree, err := client.CreateTree(ctx, ref, folder, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.PushCommit(ctx, ref, tree, "Jane Doe", "jane@example.com", "Deploy "+branch); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, diff, err := client.CreatePR(ctx, "Deploy "+branch, "Requested by Jane Doe", "", branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pr, diff
+}
+
+func TestGitClientRequiresStateDir(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "deployments\n"})
+
+	_, err := NewGitClient(context.Background(), Config{
+		AuthorName:  testAuthorName,
+		AuthorEmail: testAuthorEmail,
+		CloneTmpDir: t.TempDir(),
+		Git:         GitConfig{Url: remote.url, PullRequestMode: PullRequestModeBranch},
+	})
+	if err == nil || !strings.Contains(err.Error(), "stateDir") {
+		t.Errorf("expected missing state dir to be rejected, got %v", err)
+	}
+}
+
+func TestGitClientCloneAndMerge(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{
+		"README.md":                   "deployments\n",
+		"generated/prod/users/a.yaml": "version: 1\n",
+	})
+	client := newTestGitClient(t, remote.url, t.TempDir(), nil)
+
+	folder := t.TempDir()
+	if err := client.Download(ctx, "", folder); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(folder, "generated/prod/users/a.yaml")); err != nil || string(content) != "version: 1\n" {
+		t.Errorf("downloaded file = %q, %v", content, err)
+	}
+
+	pr, diff := openTestPR(t, client, "deploy-users-prod", map[string]string{"generated/prod/users/a.yaml": "version: 2\n"})
+	if !strings.Contains(diff, "-version: 1") || !strings.Contains(diff, "+version: 2") {
+		t.Errorf("diff = %q", diff)
+	}
+
+	if !remote.hasBranch("deploy-users-prod") {
+		t.Error("expected deployment branch to be pushed")
+	}
+
+	prDiff, err := client.PullRequestDiff(ctx, pr.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prDiff != diff {
+		t.Errorf("pull request diff = %q, want %q", prDiff, diff)
+	}
+
+	opened, err := client.GetPR(ctx, pr.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Title != "Deploy deploy-users-prod" || opened.Link != pr.Link {
+		t.Errorf("pull request = %+v", opened)
+	}
+
+	// The base branch moves on before the pull request is merged
+	remote.commit("Update readme", map[string]string{"README.md": "deployment repository\n"})
+
+	if err := client.MergePR(ctx, pr.Id, "Approved by John Doe"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := remote.file(testBaseBranch, "generated/prod/users/a.yaml"); got != "version: 2\n" {
+		t.Errorf("merged file = %q", got)
+	}
+	if got := remote.file(testBaseBranch, "README.md"); got != "deployment repository\n" {
+		t.Errorf("readme = %q, expected base branch change to be kept", got)
+	}
+	if remote.hasBranch("deploy-users-prod") {
+		t.Error("expected deployment branch to be deleted after merge")
+	}
+
+	commits, err := client.ListCommits(ctx, "", "generated/prod/users", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("got %d commits, want 2", len(commits))
+	}
+	if want := "Deploy deploy-users-prod (#1)\n\nRequested by Jane Doe\n\nApproved by John Doe"; commits[0].Message != want {
+		t.Errorf("merge message = %q, want %q", commits[0].Message, want)
+	}
+	if commits[0].AuthorName != "Jane Doe" || commits[0].AuthorEmail != "jane@example.com" {
+		t.Errorf("merge author = %s <%s>", commits[0].AuthorName, commits[0].AuthorEmail)
+	}
+
+	if err := client.MergePR(ctx, pr.Id, ""); err == nil || !strings.Contains(err.Error(), "already merged") {
+		t.Errorf("expected second merge to fail, got %v", err)
+	}
+}
+
+func TestGitClientMergeConflict(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{"generated/prod/users/a.yaml": "version: 1\n"})
+	client := newTestGitClient(t, remote.url, t.TempDir(), nil)
+
+	pr, _ := openTestPR(t, client, "deploy-users-prod", map[string]string{"generated/prod/users/a.yaml": "version: 2\n"})
+	remote.commit("Hotfix", map[string]string{"generated/prod/users/a.yaml": "version: 3\n"})
+
+	if err := client.MergePR(ctx, pr.Id, ""); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("expected merge conflict, got %v", err)
+	}
+	if got := remote.file(testBaseBranch, "generated/prod/users/a.yaml"); got != "version: 3\n" {
+		t.Errorf("base file = %q, expected it to be untouched", got)
+	}
+}
+
+func TestGitClientClosePR(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{"generated/prod/users/a.yaml": "version: 1\n"})
+	client := newTestGitClient(t, remote.url, t.TempDir(), nil)
+
+	pr, _ := openTestPR(t, client, "deploy-users-prod", map[string]string{"generated/prod/users/a.yaml": "version: 2\n"})
+	if err := client.ClosePR(ctx, pr.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if remote.hasBranch("deploy-users-prod") {
+		t.Error("expected deployment branch to be deleted after close")
+	}
+	if got := remote.file(testBaseBranch, "generated/prod/users/a.yaml"); got != "version: 1\n" {
+		t.Errorf("base file = %q, expected it to be untouched", got)
+	}
+	if err := client.MergePR(ctx, pr.Id, ""); err == nil || !strings.Contains(err.Error(), "already closed") {
+		t.Errorf("expected merge of closed pull request to fail, got %v", err)
+	}
+}
+
+func TestGitClientDirectMode(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{"generated/prod/users/a.yaml": "version: 1\n"})
+	client := newTestGitClient(t, remote.url, t.TempDir(), func(config *GitConfig) {
+		config.PullRequestMode = PullRequestModeDirect
+	})
+
+	pr, _ := openTestPR(t, client, "deploy-users-prod", map[string]string{"generated/prod/users/a.yaml": "version: 2\n"})
+	if remote.hasBranch("deploy-users-prod") {
+		t.Error("expected deployment branch to stay local")
+	}
+
+	if err := client.MergePR(ctx, pr.Id, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := remote.file(testBaseBranch, "generated/prod/users/a.yaml"); got != "version: 2\n" {
+		t.Errorf("merged file = %q", got)
+	}
+}
+
+func TestGitClientPullRequestsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{"generated/prod/users/a.yaml": "version: 1\n"})
+	stateDir := t.TempDir()
+
+	pr, _ := openTestPR(t, newTestGitClient(t, remote.url, stateDir, nil), "deploy-users-prod", map[string]string{"generated/prod/users/a.yaml": "version: 2\n"})
+
+	client := newTestGitClient(t, remote.url, stateDir, nil)
+	if err := client.MergePR(ctx, pr.Id, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := remote.file(testBaseBranch, "generated/prod/users/a.yaml"); got != "version: 2\n" {
+		t.Errorf("merged file = %q", got)
+	}
+
+	next, _ := openTestPR(t, client, "deploy-users-staging", map[string]string{"generated/staging/users/a.yaml": "version: 2\n"})
+	if next.Id != pr.Id+1 {
+		t.Errorf("pull request id = %d, want %d", next.Id, pr.Id+1)
+	}
+}
+
+func TestGitClientServiceCommits(t *testing.T) {
+	ctx := context.Background()
+	deployments := newTestRemote(t, map[string]string{"README.md": "deployments\n"})
+	service := newTestRemote(t, map[string]string{"main.go": "package main\n"})
+	first := service.commit("Add users service", map[string]string{"users.go": "package main\n"})
+
+	client := newTestGitClient(t, deployments.url, t.TempDir(), func(config *GitConfig) {
+		// Every service of the test resolves to the same remote
+		config.ServiceRepositoryUrl = service.url
+		config.ServiceCommitUrlTemplate = "https://git.example.com/{organization}/{repository}/commit/{sha}"
+	})
+
+	sha, link, err := client.GetCommitSha(ctx, "apono-io", "users", testBaseBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != first {
+		t.Errorf("sha = %s, want %s", sha, first)
+	}
+	if want := "https://git.example.com/apono-io/users/commit/" + first; link != want {
+		t.Errorf("link = %s, want %s", link, want)
+	}
+
+	commit, err := client.GetCommit(ctx, "apono-io", "users", first[:7])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Sha != first || commit.Message != "Add users service" || commit.AuthorName != "Jane Doe" {
+		t.Errorf("commit = %+v", commit)
+	}
+
+	// The mirror is fetched again for refs that may have moved
+	second := service.commit("Fix users service", map[string]string{"users.go": "package main\n\nfunc main() {}\n"})
+	sha, _, err = client.GetCommitSha(ctx, "apono-io", "users", testBaseBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != second {
+		t.Errorf("sha after push = %s, want %s", sha, second)
+	}
+
+	inBranch, err := client.CommitInBranch(ctx, "apono-io", "users", first, []string{"release", testBaseBranch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inBranch {
+		t.Errorf("expected %s to be in %s", first, testBaseBranch)
+	}
+
+	inBranch, err = client.CommitInBranch(ctx, "apono-io", "users", second, []string{"release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inBranch {
+		t.Error("expected commit not to be in a missing branch")
+	}
+
+	if _, _, err := client.GetCommitSha(ctx, "apono-io", "users", "does-not-exist"); err == nil {
+		t.Error("expected unknown commit to fail")
+	}
+}
+
+func TestGitClientFileModes(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t, map[string]string{"README.md": "deployments\n"})
+	remote.commitModes("Add hooks", map[string]string{
+		"prod/values.yaml":  "version: 1\n",
+		"prod/hook.sh":      "#!/bin/sh\necho 1\n",
+		"prod/current.yaml": "values.yaml",
+	}, map[string]os.FileMode{"prod/hook.sh": 0755, "prod/current.yaml": os.ModeSymlink})
+
+	client := newTestGitClient(t, remote.url, t.TempDir(), nil)
+	folder := t.TempDir()
+	ref, err := client.Clone(ctx, "", "deploy-users-prod", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target, err := os.Readlink(filepath.Join(folder, "prod/current.yaml")); err != nil || target != "values.yaml" {
+		t.Errorf("symlink should be checked out as a symlink to values.yaml, got %q, error %v", target, err)
+	}
+	if info, err := os.Stat(filepath.Join(folder, "prod/hook.sh")); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("executable should be checked out as executable, got %v, error %v", info.Mode(), err)
+	}
+
+	for file, content := range map[string]string{"prod/values.yaml": "version: 2\n", "prod/hook.sh": "#!/bin/sh\necho 2\n"} {
+		if err := os.WriteFile(filepath.Join(folder, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("hook.sh", filepath.Join(folder, "prod/run.sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := client.CreateTree(ctx, ref, folder, []string{"prod/values.yaml", "prod/hook.sh", "prod/current.yaml", "prod/run.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PushCommit(ctx, ref, tree, "Jane Doe", "jane@example.com", "Deploy users"); err != nil {
+		t.Fatal(err)
+	}
+	pr, _, err := client.CreatePR(ctx, "Deploy users", "Requested by Jane Doe", "", "deploy-users-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.MergePR(ctx, pr.Id, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file    string
+		mode    filemode.FileMode
+		content string
+	}{
+		{file: "prod/values.yaml", mode: filemode.Regular, content: "version: 2\n"},
+		{file: "prod/hook.sh", mode: filemode.Executable, content: "#!/bin/sh\necho 2\n"},
+		{file: "prod/current.yaml", mode: filemode.Symlink, content: "values.yaml"},
+		{file: "prod/run.sh", mode: filemode.Symlink, content: "hook.sh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file := remote.treeFile(testBaseBranch, tt.file)
+			content, err := file.Contents()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if file.Mode != tt.mode || content != tt.content {
+				t.Errorf("expected %s with %q, got %s with %q", tt.mode, tt.content, file.Mode, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,712 @@
+// Package githubtest provides an in-memory implementation of github.Client for tests.
+package githubtest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/github"
+	gh "github.com/google/go-github/v45/github"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	DefaultBaseBranch = "main"
+
+	PullRequestOpen   = "open"
+	PullRequestMerged = "merged"
+	PullRequestClosed = "closed"
+
+	repositoryUrl = "https://github.test/deployments"
+)
+
+// Client is an in-memory deployment repository implementing github.Client. Every commit holds a full snapshot of the
+// repository files, which keeps branching, squash merging and history queries trivial to reason about in tests.
+type Client struct {
+	mu           sync.Mutex
+	baseBranch   string
+	branches     map[string]string
+	forkPoints   map[string]string
+	commits      map[string]*Commit
+	pullRequests map[int]*PullRequest
+	nextPR       int
+	clock        time.Time
+	services     map[string]*serviceRepository
+}
+
+type Commit struct {
+	Sha         string
+	Parent      string
+	Message     string
+	AuthorName  string
+	AuthorEmail string
+	Date        time.Time
+	Files       map[string]string
+}
+
+type PullRequest struct {
+	Id          int
+	Title       string
+	Description string
+	BaseBranch  string
+	Branch      string
+	State       string
+}
+
+type serviceRepository struct {
+	parents  map[string]string
+	branches map[string]string
+	details  map[string]github.Commit
+	checks   map[string][]github.CommitCheck
+}
+
+var _ github.Client = (*Client)(nil)
+
+// NewClient creates a repository whose base branch holds a single empty commit.
+func NewClient() *Client {
+	c := &Client{
+		baseBranch:   DefaultBaseBranch,
+		branches:     map[string]string{},
+		forkPoints:   map[string]string{},
+		commits:      map[string]*Commit{},
+		pullRequests: map[int]*PullRequest{},
+		nextPR:       1,
+		clock:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		services:     map[string]*serviceRepository{},
+	}
+	c.branches[c.baseBranch] = c.addCommit("", "Initial commit", "", "", map[string]string{})
+
+	return c
+}
+
+// WriteFiles commits the given files on top of the branch, creating the branch from the base branch when missing.
+// An empty content deletes the file.
+func (c *Client) WriteFiles(branch, message string, files map[string]string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	head, ok := c.branches[branch]
+	if !ok {
+		head = c.branches[c.baseBranch]
+	}
+
+	snapshot := copyFiles(c.commits[head].Files)
+	for file, content := range files {
+		if content == "" {
+			delete(snapshot, file)
+			continue
+		}
+		snapshot[file] = content
+	}
+
+	sha := c.addCommit(head, message, "", "", snapshot)
+	c.branches[branch] = sha
+	return sha
+}
+
+// SetClock moves the clock of the repository, the following commit is dated a minute after the given time.
+func (c *Client) SetClock(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = now
+}
+
+// Files returns a copy of the files at the head of the branch, or nil when the branch does not exist.
+func (c *Client) Files(branch string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	head, ok := c.branches[branch]
+	if !ok {
+		return nil
+	}
+
+	return copyFiles(c.commits[head].Files)
+}
+
+// HasBranch reports whether the branch exists in the repository.
+func (c *Client) HasBranch(branch string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.branches[branch]
+	return ok
+}
+
+// PullRequest returns a copy of the pull request with the given id, or nil when it does not exist.
+func (c *Client) PullRequest(id int) *PullRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pr, ok := c.pullRequests[id]
+	if !ok {
+		return nil
+	}
+
+	prCopy := *pr
+	return &prCopy
+}
+
+// AddServiceCommit adds a commit to the commit graph of a service repository, parent may be empty for a root commit.
+func (c *Client) AddServiceCommit(organization, repository, sha, parent string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serviceRepository(organization, repository).parents[sha] = parent
+}
+
+// SetServiceBranch points a branch of a service repository at the given commit.
+func (c *Client) SetServiceBranch(organization, repository, branch, sha string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serviceRepository(organization, repository).branches[branch] = sha
+}
+
+// SetServiceCommitDetails sets the message, author and date returned by GetCommit for a service commit.
+func (c *Client) SetServiceCommitDetails(organization, repository, sha string, details github.Commit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serviceRepository(organization, repository).details[sha] = details
+}
+
+func (c *Client) Clone(ctx context.Context, baseBranch, branch, folder string) (*gh.Reference, error) {
+	ref, err := c.GetRef(ctx, baseBranch, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	return ref, c.extract(ref.Object.GetSHA(), folder)
+}
+
+func (c *Client) Download(_ context.Context, branch, folder string) error {
+	c.mu.Lock()
+	if branch == "" {
+		branch = c.baseBranch
+	}
+	head, ok := c.branches[branch]
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("branch %s does not exist", branch)
+	}
+
+	return c.extract(head, folder)
+}
+
+func (c *Client) GetRef(_ context.Context, baseBranch, branch string) (*gh.Reference, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	if baseBranch == branch {
+		return nil, errors.New("branch name cannot be the same as the base branch")
+	}
+
+	head, ok := c.branches[baseBranch]
+	if !ok {
+		return nil, fmt.Errorf("branch %s does not exist", baseBranch)
+	}
+
+	c.branches[branch] = head
+	c.forkPoints[branch] = head
+
+	return &gh.Reference{Ref: gh.String("refs/heads/" + branch), Object: &gh.GitObject{SHA: gh.String(head)}}, nil
+}
+
+func (c *Client) CreateTree(_ context.Context, ref *gh.Reference, baseFolder string, files []string) (*gh.Tree, error) {
+	var entries []*gh.TreeEntry
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			entries = append(entries, &gh.TreeEntry{Path: gh.String(file)})
+			continue
+		}
+
+		entries = append(entries, &gh.TreeEntry{Path: gh.String(file), Content: gh.String(string(content))})
+	}
+
+	return &gh.Tree{SHA: ref.Object.SHA, Entries: entries}, nil
+}
+
+func (c *Client) PushCommit(_ context.Context, ref *gh.Reference, tree *gh.Tree, userFullname string, userEmail string, commitMessage string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parent, ok := c.commits[ref.Object.GetSHA()]
+	if !ok {
+		return fmt.Errorf("commit %s does not exist", ref.Object.GetSHA())
+	}
+
+	snapshot := copyFiles(parent.Files)
+	for _, entry := range tree.Entries {
+		if entry.Content == nil {
+			delete(snapshot, entry.GetPath())
+			continue
+		}
+		snapshot[entry.GetPath()] = entry.GetContent()
+	}
+
+	sha := c.addCommit(parent.Sha, commitMessage, userFullname, userEmail, snapshot)
+	c.branches[strings.TrimPrefix(ref.GetRef(), "refs/heads/")] = sha
+	ref.Object.SHA = gh.String(sha)
+	return nil
+}
+
+func (c *Client) CreatePR(_ context.Context, title, description, baseBranch, branch string) (*github.PullRequest, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	head, ok := c.branches[branch]
+	if !ok {
+		return nil, "", fmt.Errorf("branch %s does not exist", branch)
+	}
+
+	diff, err := diffFiles(c.commits[c.forkPoints[branch]].Files, c.commits[head].Files)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pr := &PullRequest{
+		Id:          c.nextPR,
+		Title:       title,
+		Description: description,
+		BaseBranch:  baseBranch,
+		Branch:      branch,
+		State:       PullRequestOpen,
+	}
+	c.pullRequests[pr.Id] = pr
+	c.nextPR++
+
+	return &github.PullRequest{Id: pr.Id, Link: c.PullRequestLink(pr.Id), Title: pr.Title}, diff, nil
+}
+
+func (c *Client) GetPR(_ context.Context, id int) (*github.PullRequest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pr, ok := c.pullRequests[id]
+	if !ok {
+		return nil, fmt.Errorf("pull request %d does not exist", id)
+	}
+
+	return &github.PullRequest{Id: pr.Id, Link: c.PullRequestLink(pr.Id), Title: pr.Title}, nil
+}
+
+// PullRequestDiff returns the changes of the pull request branch since it was forked from the base branch.
+func (c *Client) PullRequestDiff(_ context.Context, id int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pr, ok := c.pullRequests[id]
+	if !ok {
+		return "", fmt.Errorf("pull request %d does not exist", id)
+	}
+
+	head, ok := c.branches[pr.Branch]
+	if !ok {
+		return "", fmt.Errorf("branch %s does not exist", pr.Branch)
+	}
+
+	return diffFiles(c.commits[c.forkPoints[pr.Branch]].Files, c.commits[head].Files)
+}
+
+// MergePR squash merges the changes of the pull request branch since it was forked onto the current base branch.
+func (c *Client) MergePR(_ context.Context, id int, note string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pr, ok := c.pullRequests[id]
+	if !ok {
+		return fmt.Errorf("pull request %d does not exist", id)
+	}
+
+	if pr.State == PullRequestMerged {
+		return errors.New("pull request is already merged")
+	}
+
+	if pr.State == PullRequestClosed {
+		return errors.New("pull request is closed")
+	}
+
+	fork := c.commits[c.forkPoints[pr.Branch]].Files
+	head := c.commits[c.branches[pr.Branch]]
+	baseHead := c.branches[pr.BaseBranch]
+
+	snapshot := copyFiles(c.commits[baseHead].Files)
+	for file := range fork {
+		if _, ok := head.Files[file]; !ok {
+			delete(snapshot, file)
+		}
+	}
+	for file, content := range head.Files {
+		if fork[file] != content {
+			snapshot[file] = content
+		}
+	}
+
+	message := fmt.Sprintf("%s (#%d)\n\n%s", pr.Title, pr.Id, pr.Description)
+	if note != "" {
+		message += "\n\n" + note
+	}
+	c.branches[pr.BaseBranch] = c.addCommit(baseHead, message, head.AuthorName, head.AuthorEmail, snapshot)
+	pr.State = PullRequestMerged
+	c.deleteBranch(pr.Branch)
+
+	return nil
+}
+
+func (c *Client) ClosePR(_ context.Context, id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pr, ok := c.pullRequests[id]
+	if !ok {
+		return fmt.Errorf("pull request %d does not exist", id)
+	}
+
+	if pr.State == PullRequestMerged {
+		return errors.New("pull request is already merged")
+	}
+
+	pr.State = PullRequestClosed
+	c.deleteBranch(pr.Branch)
+
+	return nil
+}
+
+// GetCommitSha resolves a full sha or a unique prefix of a commit added with AddServiceCommit, or a branch name.
+// SetCommitChecks sets the checks returned by GetCommitChecks for a service commit.
+func (c *Client) SetCommitChecks(organization, repository, sha string, checks ...github.CommitCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serviceRepository(organization, repository).checks[sha] = checks
+}
+
+func (c *Client) GetCommitSha(_ context.Context, organization, repository, commit string) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sha, ok := c.resolveServiceCommit(c.serviceRepository(organization, repository), commit)
+	if !ok {
+		return "", "", api.NewValidationErr("commit does not exist")
+	}
+
+	return sha, fmt.Sprintf("https://github.com/%s/%s/commit/%s", organization, repository, sha), nil
+}
+
+func (c *Client) GetCommit(ctx context.Context, organization, repository, commit string) (*github.Commit, error) {
+	sha, link, err := c.GetCommitSha(ctx, organization, repository, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	details := c.serviceRepository(organization, repository).details[sha]
+	details.Sha = sha
+	details.Link = link
+	return &details, nil
+}
+
+// CommitInBranch walks the parents of each branch head looking for the commit.
+func (c *Client) CommitInBranch(_ context.Context, organization, repository, commit string, branches []string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	repo := c.serviceRepository(organization, repository)
+	sha, ok := c.resolveServiceCommit(repo, commit)
+	if !ok {
+		return false, nil
+	}
+
+	for _, branch := range branches {
+		current, ok := repo.branches[branch]
+		for ok && current != "" {
+			if current == sha {
+				return true, nil
+			}
+			current, ok = repo.parents[current]
+		}
+	}
+
+	return false, nil
+}
+
+func (c *Client) GetCommitChecks(_ context.Context, organization, repository, commit string) ([]github.CommitCheck, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	repo := c.serviceRepository(organization, repository)
+	sha, ok := c.resolveServiceCommit(repo, commit)
+	if !ok {
+		return nil, api.NewValidationErr("commit does not exist")
+	}
+
+	return append([]github.CommitCheck(nil), repo.checks[sha]...), nil
+}
+
+// ListCommits returns the first parent history of the branch, newest first, limited to commits changing the path.
+func (c *Client) ListCommits(_ context.Context, branch, path string, page, perPage int) ([]*github.Commit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	var matching []*github.Commit
+	for sha := c.branches[branch]; sha != ""; sha = c.commits[sha].Parent {
+		commit := c.commits[sha]
+		var parentFiles map[string]string
+		if commit.Parent != "" {
+			parentFiles = c.commits[commit.Parent].Files
+		}
+
+		if !changesPath(parentFiles, commit.Files, path) {
+			continue
+		}
+
+		matching = append(matching, &github.Commit{
+			Sha:         commit.Sha,
+			Link:        fmt.Sprintf("%s/commit/%s", repositoryUrl, commit.Sha),
+			Message:     commit.Message,
+			AuthorName:  commit.AuthorName,
+			AuthorEmail: commit.AuthorEmail,
+			Date:        commit.Date,
+		})
+	}
+
+	start := (page - 1) * perPage
+	if start >= len(matching) {
+		return nil, nil
+	}
+
+	return matching[start:min(start+perPage, len(matching))], nil
+}
+
+func (c *Client) PullRequestLink(id int) string {
+	return fmt.Sprintf("%s/pull/%d", repositoryUrl, id)
+}
+
+// Tarball returns the files of the commit as a gzipped tarball laid out like a GitHub archive, with every path
+// prefixed by a top level directory.
+func (c *Client) Tarball(sha string) ([]byte, error) {
+	c.mu.Lock()
+	commit, ok := c.commits[sha]
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("commit %s does not exist", sha)
+	}
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	prefix := "deployments-" + sha[:7]
+	err := tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: prefix + "/", Mode: 0755})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range sortedFiles(commit.Files) {
+		content := commit.Files[file]
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: prefix + "/" + file, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = tarWriter.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *Client) extract(sha, folder string) error {
+	tarball, err := c.Tarball(sha)
+	if err != nil {
+		return err
+	}
+
+	return github.ExtractTarGz(folder, bytes.NewReader(tarball))
+}
+
+func (c *Client) addCommit(parent, message, authorName, authorEmail string, files map[string]string) string {
+	c.clock = c.clock.Add(time.Minute)
+
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s\n%s\n%d", parent, message, len(c.commits))))
+	sha := hex.EncodeToString(hash[:])
+	c.commits[sha] = &Commit{
+		Sha:         sha,
+		Parent:      parent,
+		Message:     message,
+		AuthorName:  authorName,
+		AuthorEmail: authorEmail,
+		Date:        c.clock,
+		Files:       files,
+	}
+
+	return sha
+}
+
+func (c *Client) deleteBranch(branch string) {
+	delete(c.branches, branch)
+	delete(c.forkPoints, branch)
+}
+
+func (c *Client) serviceRepository(organization, repository string) *serviceRepository {
+	key := organization + "/" + repository
+	repo, ok := c.services[key]
+	if !ok {
+		repo = &serviceRepository{parents: map[string]string{}, branches: map[string]string{}, details: map[string]github.Commit{}, checks: map[string][]github.CommitCheck{}}
+		c.services[key] = repo
+	}
+
+	return repo
+}
+
+func (c *Client) resolveServiceCommit(repo *serviceRepository, commit string) (string, bool) {
+	if sha, ok := repo.branches[commit]; ok {
+		return sha, true
+	}
+
+	var match string
+	for sha := range repo.parents {
+		if strings.HasPrefix(sha, commit) {
+			if match != "" {
+				return "", false
+			}
+			match = sha
+		}
+	}
+
+	return match, match != ""
+}
+
+func changesPath(before, after map[string]string, path string) bool {
+	inPath := func(file string) bool {
+		return path == "" || file == path || strings.HasPrefix(file, strings.TrimSuffix(path, "/")+"/")
+	}
+
+	for file, content := range after {
+		if inPath(file) && before[file] != content {
+			return true
+		}
+	}
+
+	for file := range before {
+		if _, ok := after[file]; !ok && inPath(file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func diffFiles(before, after map[string]string) (string, error) {
+	files := map[string]struct{}{}
+	for file := range before {
+		files[file] = struct{}{}
+	}
+	for file := range after {
+		files[file] = struct{}{}
+	}
+
+	var sb strings.Builder
+	for _, file := range sortedFiles(files) {
+		oldContent, existed := before[file]
+		newContent, exists := after[file]
+		if existed == exists && oldContent == newContent {
+			continue
+		}
+
+		fromFile, toFile := "a/"+file, "b/"+file
+		if !existed {
+			fromFile = "/dev/null"
+		}
+		if !exists {
+			toFile = "/dev/null"
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(oldContent),
+			B:        difflib.SplitLines(newContent),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n%s", file, file, diff))
+	}
+
+	return sb.String(), nil
+}
+
+func copyFiles(files map[string]string) map[string]string {
+	filesCopy := make(map[string]string, len(files))
+	for file, content := range files {
+		filesCopy[file] = content
+	}
+
+	return filesCopy
+}
+
+func sortedFiles[V any](files map[string]V) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
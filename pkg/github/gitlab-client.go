@@ -0,0 +1,527 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/google/go-github/v45/github"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/gitlab-org/api/client-go"
+)
+
+const (
+	gitlabMergeRequestMerged = "merged"
+	gitlabPageSize           = 100
+	gitlabDiffRetries        = 5
+	gitlabMergeRetries       = 3
+)
+
+// NewGitlabClient creates a Client for a GitLab project, pull requests are opened as merge requests.
+// The project path is built from the organization (group) and repository configuration.
+func NewGitlabClient(ctx context.Context, config Config) (Client, error) {
+	if config.Organization == "" || config.Repository == "" || config.Gitlab.Token == "" {
+		return nil, errors.New("gitlab backend requires organization, repository and token configuration")
+	}
+
+	client, err := gitlab.NewClient(config.Gitlab.Token, gitlab.WithBaseURL(config.Gitlab.Url))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gitlab client, error: %w", err)
+	}
+
+	projectPath := gitlabProjectPath(config.Organization, config.Repository)
+	project, _, err := client.Projects.GetProject(projectPath, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gitlab project %s, error: %w", projectPath, err)
+	}
+
+	return &gitlabClient{
+		client:      client,
+		project:     project.PathWithNamespace,
+		projectUrl:  project.WebURL,
+		authorName:  config.AuthorName,
+		authorEmail: config.AuthorEmail,
+		baseBranch:  project.DefaultBranch,
+	}, nil
+}
+
+type gitlabClient struct {
+	client      *gitlab.Client
+	project     string
+	projectUrl  string
+	authorName  string
+	authorEmail string
+	baseBranch  string
+}
+
+func (c *gitlabClient) Clone(ctx context.Context, baseBranch, branch, folder string) (*github.Reference, error) {
+	ref, err := c.GetRef(ctx, baseBranch, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.download(ctx, ref.Object.GetSHA(), folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return ref, nil
+}
+
+func (c *gitlabClient) Download(ctx context.Context, branch, folder string) error {
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	return c.download(ctx, branch, folder)
+}
+
+func (c *gitlabClient) download(ctx context.Context, sha, folder string) error {
+	archive, _, err := c.client.Repositories.Archive(c.project, &gitlab.ArchiveOptions{
+		Format: gitlab.Ptr("tar.gz"),
+		SHA:    gitlab.Ptr(sha),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to fetch source from gitlab, error: %w", err)
+	}
+
+	return ExtractTarGz(folder, bytes.NewReader(archive))
+}
+
+func (c *gitlabClient) GetRef(ctx context.Context, baseBranch, branch string) (*github.Reference, error) {
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	if baseBranch == branch {
+		return nil, errors.New("branch name cannot be the same as the base branch")
+	}
+
+	err := c.deleteBranch(ctx, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	newBranch, _, err := c.client.Branches.CreateBranch(c.project, &gitlab.CreateBranchOptions{
+		Branch: gitlab.Ptr(branch),
+		Ref:    gitlab.Ptr(baseBranch),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create branch %s, error: %w", branch, err)
+	}
+
+	return &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(newBranch.Commit.ID)},
+	}, nil
+}
+
+// CreateTree loads the files into tree entries, the GitLab commits API has no tree objects so the entries are only
+// turned into commit actions by PushCommit. Entries of files that already exist on the branch carry their blob id and
+// mode, entries without content are deletions. The existing files are read with a single listing of the branch tree.
+func (c *gitlabClient) CreateTree(ctx context.Context, ref *github.Reference, baseFolder string, files []string) (*github.Tree, error) {
+	existingFiles, err := c.listTreeBlobs(ctx, ref.Object.GetSHA())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*github.TreeEntry
+	for _, file := range files {
+		existing, exists := existingFiles[file]
+		content, err := os.ReadFile(filepath.Join(baseFolder, file))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			if exists {
+				entries = append(entries, &github.TreeEntry{Path: github.String(file), SHA: github.String(existing.ID)})
+			}
+			continue
+		}
+
+		entry := &github.TreeEntry{
+			Path:    github.String(file),
+			Type:    github.String("blob"),
+			Mode:    github.String("100644"),
+			Content: github.String(string(content)),
+		}
+		if exists {
+			entry.SHA = github.String(existing.ID)
+			entry.Mode = github.String(existing.Mode)
+		}
+		entries = append(entries, entry)
+	}
+
+	return &github.Tree{SHA: ref.Object.SHA, Entries: entries}, nil
+}
+
+func (c *gitlabClient) PushCommit(ctx context.Context, ref *github.Reference, tree *github.Tree, userFullname string, userEmail string, commitMessage string) error {
+	var actions []*gitlab.CommitActionOptions
+	for _, entry := range tree.Entries {
+		action := &gitlab.CommitActionOptions{FilePath: entry.Path}
+		switch {
+		case entry.Content == nil:
+			action.Action = gitlab.Ptr(gitlab.FileDelete)
+		case entry.SHA != nil:
+			action.Action = gitlab.Ptr(gitlab.FileUpdate)
+		default:
+			action.Action = gitlab.Ptr(gitlab.FileCreate)
+		}
+
+		if entry.Content != nil {
+			action.Encoding = gitlab.Ptr("base64")
+			action.Content = gitlab.Ptr(base64.StdEncoding.EncodeToString([]byte(entry.GetContent())))
+		}
+
+		actions = append(actions, action)
+	}
+
+	if len(actions) == 0 {
+		log.WithField("ref", ref.GetRef()).Info("No changes to commit")
+		return nil
+	}
+
+	commit, _, err := c.client.Commits.CreateCommit(c.project, &gitlab.CreateCommitOptions{
+		Branch:        gitlab.Ptr(strings.TrimPrefix(ref.GetRef(), "refs/heads/")),
+		CommitMessage: gitlab.Ptr(commitMessage),
+		Actions:       actions,
+		AuthorName:    gitlab.Ptr(userFullname),
+		AuthorEmail:   gitlab.Ptr(userEmail),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to create commit, error: %w", err)
+	}
+
+	ref.Object.SHA = github.String(commit.ID)
+	return nil
+}
+
+func (c *gitlabClient) CreatePR(ctx context.Context, title, description, baseBranch, branch string) (*PullRequest, string, error) {
+	if baseBranch == "" {
+		baseBranch = c.baseBranch
+	}
+
+	mr, _, err := c.client.MergeRequests.CreateMergeRequest(c.project, &gitlab.CreateMergeRequestOptions{
+		Title:              gitlab.Ptr(title),
+		Description:        gitlab.Ptr(description),
+		SourceBranch:       gitlab.Ptr(branch),
+		TargetBranch:       gitlab.Ptr(baseBranch),
+		RemoveSourceBranch: gitlab.Ptr(true),
+		Squash:             gitlab.Ptr(true),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+
+	diff, err := c.PullRequestDiff(ctx, int(mr.IID))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &PullRequest{Id: int(mr.IID), Link: mr.WebURL, Title: mr.Title}, diff, nil
+}
+
+func (c *gitlabClient) GetPR(ctx context.Context, id int) (*PullRequest, error) {
+	mr, _, err := c.client.MergeRequests.GetMergeRequest(c.project, int64(id), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PullRequest{Id: int(mr.IID), Link: mr.WebURL, Title: mr.Title}, nil
+}
+
+func (c *gitlabClient) PullRequestDiff(ctx context.Context, id int) (string, error) {
+	return c.mergeRequestDiff(ctx, int64(id))
+}
+
+func (c *gitlabClient) MergePR(ctx context.Context, id int, note string) error {
+	mr, _, err := c.client.MergeRequests.GetMergeRequest(c.project, int64(id), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	if mr.State == gitlabMergeRequestMerged {
+		return errors.New("pull request is already merged")
+	}
+
+	// The squash commit is what lands on the deployment branch, keep the title format the history parser expects
+	message := fmt.Sprintf("%s (!%d)\n\n%s", mr.Title, mr.IID, mr.Description)
+	if note != "" {
+		message += "\n\n" + note
+	}
+	for attempt := 0; ; attempt++ {
+		_, _, err = c.client.MergeRequests.AcceptMergeRequest(c.project, int64(id), &gitlab.AcceptMergeRequestOptions{
+			Squash:                   gitlab.Ptr(true),
+			SquashCommitMessage:      gitlab.Ptr(message),
+			ShouldRemoveSourceBranch: gitlab.Ptr(true),
+		}, gitlab.WithContext(ctx))
+		if err == nil {
+			return nil
+		}
+
+		// GitLab computes mergeability asynchronously, a freshly updated merge request may not be mergeable yet
+		if attempt < gitlabMergeRetries-1 && gitlab.HasStatusCode(err, http.StatusMethodNotAllowed) {
+			log.WithError(err).WithField("retry", attempt+1).Warn("Merge request is not mergeable yet, retrying")
+			time.Sleep(time.Second * time.Duration(attempt+1))
+			continue
+		}
+
+		return err
+	}
+}
+
+func (c *gitlabClient) ClosePR(ctx context.Context, id int) error {
+	mr, _, err := c.client.MergeRequests.GetMergeRequest(c.project, int64(id), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	if mr.State == gitlabMergeRequestMerged {
+		return errors.New("pull request is already merged")
+	}
+
+	_, _, err = c.client.MergeRequests.UpdateMergeRequest(c.project, int64(id), &gitlab.UpdateMergeRequestOptions{
+		StateEvent: gitlab.Ptr("close"),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return c.deleteBranch(ctx, mr.SourceBranch)
+}
+
+func (c *gitlabClient) GetCommitSha(ctx context.Context, organization, repository, commit string) (string, string, error) {
+	glCommit, err := c.GetCommit(ctx, organization, repository, commit)
+	if err != nil {
+		return "", "", err
+	}
+
+	return glCommit.Sha, glCommit.Link, nil
+}
+
+func (c *gitlabClient) GetCommit(ctx context.Context, organization, repository, commit string) (*Commit, error) {
+	glCommit, _, err := c.client.Commits.GetCommit(gitlabProjectPath(organization, repository), commit, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		if gitlab.HasStatusCode(err, http.StatusNotFound) {
+			return nil, api.NewValidationErr("commit does not exist")
+		}
+
+		return nil, err
+	}
+
+	return toCommit(glCommit), nil
+}
+
+func (c *gitlabClient) CommitInBranch(ctx context.Context, organization, repository, commit string, branches []string) (bool, error) {
+	wanted := make(map[string]bool, len(branches))
+	for _, branch := range branches {
+		wanted[branch] = true
+	}
+
+	opts := &gitlab.GetCommitRefsOptions{
+		Type:        gitlab.Ptr("branch"),
+		ListOptions: gitlab.ListOptions{PerPage: gitlabPageSize},
+	}
+	for {
+		refs, resp, err := c.client.Commits.GetCommitRefs(gitlabProjectPath(organization, repository), commit, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			if gitlab.HasStatusCode(err, http.StatusNotFound) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		for _, ref := range refs {
+			if wanted[ref.Name] {
+				return true, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetCommitChecks returns the latest status of every job and external status reported on the commit
+func (c *gitlabClient) GetCommitChecks(ctx context.Context, organization, repository, commit string) ([]CommitCheck, error) {
+	var checks []CommitCheck
+	opts := &gitlab.GetCommitStatusesOptions{ListOptions: gitlab.ListOptions{PerPage: gitlabPageSize}}
+	for {
+		statuses, resp, err := c.client.Commits.GetCommitStatuses(gitlabProjectPath(organization, repository), commit, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, status := range statuses {
+			checks = append(checks, CommitCheck{
+				Name:  status.Name,
+				State: gitlabCheckState(status),
+				Link:  status.TargetURL,
+			})
+		}
+
+		if resp.NextPage == 0 {
+			return checks, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func gitlabCheckState(status *gitlab.CommitStatus) string {
+	switch status.Status {
+	case "success", "skipped":
+		return CheckStateSuccess
+	case "failed", "canceled":
+		if status.AllowFailure {
+			return CheckStateSuccess
+		}
+		return CheckStateFailure
+	default:
+		return CheckStatePending
+	}
+}
+
+func (c *gitlabClient) ListCommits(ctx context.Context, branch, path string, page, perPage int) ([]*Commit, error) {
+	if branch == "" {
+		branch = c.baseBranch
+	}
+
+	opts := &gitlab.ListCommitsOptions{
+		RefName:     gitlab.Ptr(branch),
+		ListOptions: gitlab.ListOptions{Page: int64(page), PerPage: int64(perPage)},
+	}
+	if path != "" {
+		opts.Path = gitlab.Ptr(path)
+	}
+
+	glCommits, _, err := c.client.Commits.ListCommits(c.project, opts, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]*Commit, 0, len(glCommits))
+	for _, glCommit := range glCommits {
+		commits = append(commits, toCommit(glCommit))
+	}
+
+	return commits, nil
+}
+
+func (c *gitlabClient) PullRequestLink(id int) string {
+	return fmt.Sprintf("%s/-/merge_requests/%d", c.projectUrl, id)
+}
+
+// mergeRequestDiff renders the merge request changes as a unified diff. GitLab prepares the diff in the background
+// after the merge request is opened, so an empty result is retried a few times before giving up.
+func (c *gitlabClient) mergeRequestDiff(ctx context.Context, iid int64) (string, error) {
+	var diffs []*gitlab.MergeRequestDiff
+	for attempt := 0; attempt < gitlabDiffRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Second)
+		}
+
+		opts := &gitlab.ListMergeRequestDiffsOptions{ListOptions: gitlab.ListOptions{PerPage: gitlabPageSize}}
+		for {
+			page, resp, err := c.client.MergeRequests.ListMergeRequestDiffs(c.project, iid, opts, gitlab.WithContext(ctx))
+			if err != nil {
+				return "", fmt.Errorf("failed to get merge request diff, error: %w", err)
+			}
+
+			diffs = append(diffs, page...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+
+		if len(diffs) > 0 {
+			break
+		}
+	}
+
+	var sb strings.Builder
+	for _, diff := range diffs {
+		oldPath, newPath := "a/"+diff.OldPath, "b/"+diff.NewPath
+		if diff.NewFile {
+			oldPath = "/dev/null"
+		}
+		if diff.DeletedFile {
+			newPath = "/dev/null"
+		}
+
+		sb.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n--- %s\n+++ %s\n", diff.OldPath, diff.NewPath, oldPath, newPath))
+		sb.WriteString(diff.Diff)
+		if !strings.HasSuffix(diff.Diff, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// listTreeBlobs returns the files of the repository at the given revision by their path
+func (c *gitlabClient) listTreeBlobs(ctx context.Context, ref string) (map[string]*gitlab.TreeNode, error) {
+	blobs := make(map[string]*gitlab.TreeNode)
+	opts := &gitlab.ListTreeOptions{
+		Ref:         gitlab.Ptr(ref),
+		Recursive:   gitlab.Ptr(true),
+		ListOptions: gitlab.ListOptions{PerPage: gitlabPageSize},
+	}
+	for {
+		nodes, resp, err := c.client.Repositories.ListTree(c.project, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repository tree, error: %w", err)
+		}
+
+		for _, node := range nodes {
+			if node.Type == "blob" {
+				blobs[node.Path] = node
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return blobs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (c *gitlabClient) deleteBranch(ctx context.Context, branch string) error {
+	_, err := c.client.Branches.DeleteBranch(c.project, branch, gitlab.WithContext(ctx))
+	if err != nil && !gitlab.HasStatusCode(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to delete branch %s, error: %w", branch, err)
+	}
+
+	return nil
+}
+
+func toCommit(glCommit *gitlab.Commit) *Commit {
+	commit := &Commit{
+		Sha:         glCommit.ID,
+		Link:        glCommit.WebURL,
+		Message:     glCommit.Message,
+		AuthorName:  glCommit.AuthorName,
+		AuthorEmail: glCommit.AuthorEmail,
+	}
+	if glCommit.AuthoredDate != nil {
+		commit.Date = *glCommit.AuthoredDate
+	}
+
+	return commit
+}
+
+func gitlabProjectPath(organization, repository string) string {
+	return organization + "/" + repository
+}
@@ -0,0 +1,388 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"gitlab.com/gitlab-org/api/client-go"
+)
+
+const testGitlabProject = "deployments/argo"
+
+// testGitlab is a GitLab API server holding a single project, it records the requests that change the project
+type testGitlab struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu            sync.Mutex
+	tree          []*gitlab.TreeNode
+	treeRequests  int
+	commits       []*gitlab.CreateCommitOptions
+	mergeRequests map[string]*gitlab.CreateMergeRequestOptions
+	merges        []*gitlab.AcceptMergeRequestOptions
+	// notMergeable is the number of merge attempts rejected before the merge request becomes mergeable
+	notMergeable int
+	commitQuery  string
+}
+
+func newTestGitlab(t *testing.T) *testGitlab {
+	t.Helper()
+
+	gl := &testGitlab{t: t, mergeRequests: map[string]*gitlab.CreateMergeRequestOptions{}}
+	project := "/api/v4/projects/{project}"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+project, gl.getProject)
+	mux.HandleFunc("GET "+project+"/repository/tree", gl.listTree)
+	mux.HandleFunc("POST "+project+"/repository/commits", gl.createCommit)
+	mux.HandleFunc("GET "+project+"/repository/commits", gl.listCommits)
+	mux.HandleFunc("POST "+project+"/merge_requests", gl.createMergeRequest)
+	mux.HandleFunc("GET "+project+"/merge_requests/{iid}", gl.getMergeRequest)
+	mux.HandleFunc("GET "+project+"/merge_requests/{iid}/diffs", gl.listDiffs)
+	mux.HandleFunc("PUT "+project+"/merge_requests/{iid}/merge", gl.acceptMergeRequest)
+	gl.server = httptest.NewServer(mux)
+	t.Cleanup(gl.server.Close)
+
+	return gl
+}
+
+func (gl *testGitlab) newClient() Client {
+	gl.t.Helper()
+
+	client, err := NewGitlabClient(context.Background(), Config{
+		Organization: "deployments",
+		Repository:   "argo",
+		AuthorName:   testAuthorName,
+		AuthorEmail:  testAuthorEmail,
+		Gitlab:       GitlabConfig{Url: gl.server.URL, Token: "token"},
+	})
+	if err != nil {
+		gl.t.Fatal(err)
+	}
+
+	return client
+}
+
+func (gl *testGitlab) checkProject(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("project") != testGitlabProject {
+		http.NotFound(w, r)
+		return false
+	}
+
+	return true
+}
+
+func (gl *testGitlab) respond(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		gl.t.Error(err)
+	}
+}
+
+func (gl *testGitlab) decode(r *http.Request, body any) {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		gl.t.Error(err)
+	}
+}
+
+func (gl *testGitlab) getProject(w http.ResponseWriter, r *http.Request) {
+	if gl.checkProject(w, r) {
+		gl.respond(w, gitlab.Project{PathWithNamespace: testGitlabProject, WebURL: "https://gitlab.test/" + testGitlabProject, DefaultBranch: testBaseBranch})
+	}
+}
+
+// listTree serves the tree two nodes per page, so listing it takes several pages
+func (gl *testGitlab) listTree(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	gl.treeRequests++
+	if r.URL.Query().Get("recursive") != "true" || r.URL.Query().Get("ref") != "base-sha" {
+		gl.t.Errorf("unexpected tree query %s", r.URL.RawQuery)
+	}
+
+	page := 1
+	if r.URL.Query().Get("page") == "2" {
+		page = 2
+	}
+
+	nodes := gl.tree[min((page-1)*2, len(gl.tree)):min(page*2, len(gl.tree))]
+	if page*2 < len(gl.tree) {
+		w.Header().Set("X-Next-Page", "2")
+	}
+	gl.respond(w, nodes)
+}
+
+func (gl *testGitlab) createCommit(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	var opts gitlab.CreateCommitOptions
+	gl.decode(r, &opts)
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	gl.commits = append(gl.commits, &opts)
+	gl.respond(w, gitlab.Commit{ID: "new-sha"})
+}
+
+func (gl *testGitlab) listCommits(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	gl.mu.Lock()
+	gl.commitQuery = r.URL.RawQuery
+	gl.mu.Unlock()
+
+	authored := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	gl.respond(w, []*gitlab.Commit{{
+		ID:           "abc123",
+		Message:      "Deploy users to prod (!7)",
+		AuthorName:   "Jane Doe",
+		AuthorEmail:  "jane@example.com",
+		AuthoredDate: &authored,
+		WebURL:       "https://gitlab.test/" + testGitlabProject + "/-/commit/abc123",
+	}})
+}
+
+func (gl *testGitlab) createMergeRequest(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	var opts gitlab.CreateMergeRequestOptions
+	gl.decode(r, &opts)
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	gl.mergeRequests["7"] = &opts
+	gl.respond(w, gitlab.MergeRequest{BasicMergeRequest: gitlab.BasicMergeRequest{
+		IID:    7,
+		Title:  *opts.Title,
+		WebURL: "https://gitlab.test/" + testGitlabProject + "/-/merge_requests/7",
+	}})
+}
+
+func (gl *testGitlab) getMergeRequest(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	opts, ok := gl.mergeRequests[r.PathValue("iid")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := "opened"
+	if len(gl.merges) > 0 {
+		state = gitlabMergeRequestMerged
+	}
+	gl.respond(w, gitlab.MergeRequest{BasicMergeRequest: gitlab.BasicMergeRequest{
+		IID:          7,
+		Title:        *opts.Title,
+		Description:  *opts.Description,
+		SourceBranch: *opts.SourceBranch,
+		State:        state,
+	}})
+}
+
+func (gl *testGitlab) listDiffs(w http.ResponseWriter, r *http.Request) {
+	if gl.checkProject(w, r) {
+		gl.respond(w, []*gitlab.MergeRequestDiff{
+			{OldPath: "prod/users/values.yaml", NewPath: "prod/users/values.yaml", Diff: "@@ -1 +1 @@\n-tag: v1\n+tag: v2\n"},
+			{OldPath: "prod/users/.freeze", NewPath: "prod/users/.freeze", Diff: "@@ -0,0 +1 @@\n+frozenBy: Jane Doe", NewFile: true},
+		})
+	}
+}
+
+func (gl *testGitlab) acceptMergeRequest(w http.ResponseWriter, r *http.Request) {
+	if !gl.checkProject(w, r) {
+		return
+	}
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	if gl.notMergeable > 0 {
+		gl.notMergeable--
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		gl.respond(w, map[string]string{"message": "405 Method Not Allowed"})
+		return
+	}
+
+	var opts gitlab.AcceptMergeRequestOptions
+	gl.decode(r, &opts)
+	gl.merges = append(gl.merges, &opts)
+	gl.respond(w, gitlab.MergeRequest{BasicMergeRequest: gitlab.BasicMergeRequest{IID: 7, State: gitlabMergeRequestMerged}})
+}
+
+func TestGitlabClientCreateTreeAndPushCommit(t *testing.T) {
+	gl := newTestGitlab(t)
+	gl.tree = []*gitlab.TreeNode{
+		{ID: "tree-prod", Type: "tree", Path: "prod", Mode: "040000"},
+		{ID: "blob-values", Type: "blob", Path: "prod/values.yaml", Mode: "100644"},
+		{ID: "blob-hook", Type: "blob", Path: "prod/hook.sh", Mode: "100755"},
+		{ID: "blob-freeze", Type: "blob", Path: "prod/.freeze", Mode: "100644"},
+	}
+	client := gl.newClient()
+
+	baseFolder := t.TempDir()
+	files := map[string]string{
+		"prod/values.yaml":     "tag: v2\n",
+		"prod/hook.sh":         "#!/bin/sh\necho v2\n",
+		"prod/new/values.yaml": "tag: v1\n",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Join(baseFolder, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(baseFolder, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ref := &github.Reference{Ref: github.String("refs/heads/deploy-users-prod"), Object: &github.GitObject{SHA: github.String("base-sha")}}
+	tree, err := client.CreateTree(context.Background(), ref, baseFolder, []string{"prod/values.yaml", "prod/hook.sh", "prod/new/values.yaml", "prod/.freeze", "prod/missing.yaml"})
+	if err != nil {
+		t.Fatalf("create tree failed: %v", err)
+	}
+
+	if gl.treeRequests != 2 {
+		t.Errorf("expected the tree to be listed once over 2 pages, got %d requests", gl.treeRequests)
+	}
+	if mode := tree.Entries[1].GetMode(); mode != "100755" {
+		t.Errorf("updated entry should keep the existing mode, got %s", mode)
+	}
+
+	if err = client.PushCommit(context.Background(), ref, tree, "Jane Doe", "jane@example.com", "Deploy users to prod"); err != nil {
+		t.Fatalf("push commit failed: %v", err)
+	}
+
+	if len(gl.commits) != 1 {
+		t.Fatalf("expected a single commit, got %d", len(gl.commits))
+	}
+	commit := gl.commits[0]
+	if *commit.Branch != "deploy-users-prod" || *commit.CommitMessage != "Deploy users to prod" || *commit.AuthorEmail != "jane@example.com" {
+		t.Errorf("unexpected commit %+v", commit)
+	}
+
+	var actions []string
+	for _, action := range commit.Actions {
+		description := string(*action.Action) + " " + *action.FilePath
+		if action.Content != nil {
+			content, err := base64.StdEncoding.DecodeString(*action.Content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			description += " " + strings.TrimSpace(string(content))
+		}
+		actions = append(actions, description)
+	}
+
+	expected := []string{
+		"update prod/values.yaml tag: v2",
+		"update prod/hook.sh #!/bin/sh\necho v2",
+		"create prod/new/values.yaml tag: v1",
+		"delete prod/.freeze",
+	}
+	if strings.Join(actions, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected commit actions:\n%s", strings.Join(actions, "\n"))
+	}
+
+	if ref.Object.GetSHA() != "new-sha" {
+		t.Errorf("reference should point to the new commit, got %s", ref.Object.GetSHA())
+	}
+}
+
+func TestGitlabClientCreateAndMergePR(t *testing.T) {
+	gl := newTestGitlab(t)
+	gl.notMergeable = 1
+	client := gl.newClient()
+
+	pr, diff, err := client.CreatePR(context.Background(), "Deploy users to prod", "Requested by: Jane Doe", "", "deploy-users-prod")
+	if err != nil {
+		t.Fatalf("create pull request failed: %v", err)
+	}
+
+	if pr.Id != 7 || pr.Title != "Deploy users to prod" || pr.Link != "https://gitlab.test/"+testGitlabProject+"/-/merge_requests/7" {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+
+	opts := gl.mergeRequests["7"]
+	if *opts.TargetBranch != testBaseBranch || *opts.SourceBranch != "deploy-users-prod" || !*opts.Squash || !*opts.RemoveSourceBranch {
+		t.Errorf("unexpected merge request options %+v", opts)
+	}
+
+	expectedDiff := "diff --git a/prod/users/values.yaml b/prod/users/values.yaml\n--- a/prod/users/values.yaml\n+++ b/prod/users/values.yaml\n" +
+		"@@ -1 +1 @@\n-tag: v1\n+tag: v2\n" +
+		"diff --git a/prod/users/.freeze b/prod/users/.freeze\n--- /dev/null\n+++ b/prod/users/.freeze\n@@ -0,0 +1 @@\n+frozenBy: Jane Doe\n"
+	if diff != expectedDiff {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	// The first attempt is rejected while GitLab checks if the merge request is mergeable
+	if err = client.MergePR(context.Background(), pr.Id, "Approved by John Doe"); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+
+	if len(gl.merges) != 1 {
+		t.Fatalf("expected a single merge, got %d", len(gl.merges))
+	}
+	merge := gl.merges[0]
+	if message := *merge.SquashCommitMessage; message != "Deploy users to prod (!7)\n\nRequested by: Jane Doe\n\nApproved by John Doe" {
+		t.Errorf("unexpected squash commit message %q", message)
+	}
+	if !*merge.Squash || !*merge.ShouldRemoveSourceBranch {
+		t.Errorf("unexpected merge options %+v", merge)
+	}
+
+	if err = client.MergePR(context.Background(), pr.Id, ""); err == nil || err.Error() != "pull request is already merged" {
+		t.Errorf("expected already merged error, got %v", err)
+	}
+}
+
+func TestGitlabClientListCommits(t *testing.T) {
+	gl := newTestGitlab(t)
+	client := gl.newClient()
+
+	commits, err := client.ListCommits(context.Background(), "", "prod/users", 2, 10)
+	if err != nil {
+		t.Fatalf("list commits failed: %v", err)
+	}
+
+	for _, want := range []string{"ref_name=" + testBaseBranch, "path=prod%2Fusers", "page=2", "per_page=10"} {
+		if !strings.Contains(gl.commitQuery, want) {
+			t.Errorf("commits query %q does not contain %q", gl.commitQuery, want)
+		}
+	}
+
+	if len(commits) != 1 {
+		t.Fatalf("expected a single commit, got %d", len(commits))
+	}
+	commit := commits[0]
+	if commit.Sha != "abc123" || commit.AuthorName != "Jane Doe" || commit.Message != "Deploy users to prod (!7)" ||
+		!commit.Date.Equal(time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected commit %+v", commit)
+	}
+}
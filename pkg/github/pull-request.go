@@ -1,6 +1,9 @@
 package github
 
 type PullRequest struct {
-	Id   int    `json:"id,omitempty"`
-	Link string `json:"link,omitempty"`
+	Id    int    `json:"id,omitempty"`
+	Link  string `json:"link,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Warnings are reported by the deployer when opening the pull request, e.g. non-blocking policy violations
+	Warnings []string `json:"warnings,omitempty"`
 }
@@ -12,9 +12,15 @@ import (
 	log "github.com/sirupsen/logrus"
 	slackgo "github.com/slack-go/slack"
 	"github.com/slack-go/slack/socketmode"
+	"regexp"
 	"strings"
 )
 
+// quotedArgumentPattern matches a command argument wrapped in straight or curly double quotes
+var quotedArgumentPattern = regexp.MustCompile(`["“”]([^"“”]*)["“”]`)
+
+const quotedArgumentSpace = "\x1f"
+
 type Bot interface {
 	Run() error
 }
@@ -25,12 +31,14 @@ func New(config Config, deployConfig deploy.Config) (Bot, error) {
 	)
 
 	return &bot{
+		config:       config,
 		deployConfig: deployConfig,
 		slackerBot:   slackerBot,
 	}, nil
 }
 
 type bot struct {
+	config            Config
 	deployConfig      deploy.Config
 	slackerBot        *slacker.Slacker
 	botName           string
@@ -51,15 +59,17 @@ func (b *bot) Run() error {
 	b.slackerBot.CustomCommand(b.constructCommand)
 	b.slackerBot.CustomBotContext(b.constructBotContext)
 
-	d, err := deploy.New(b.deployConfig)
+	d, err := deploy.New(b.deployConfig, commands.NewEmergencyApprovers(b.slackerBot.APIClient(), b.config.Emergency))
 	if err != nil {
 		return err
 	}
 
-	commands.RegisterCommandHandlers(b.slackerBot, d)
+	commands.RegisterCommandHandlers(b.slackerBot, d, b.config.Emergency)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go b.expireFreezes(ctx, d)
+
 	return b.slackerBot.Listen(ctx)
 }
 
@@ -99,6 +109,11 @@ func (c *cmd) Definition() *slacker.CommandDefinition {
 }
 
 func (c *cmd) Match(text string) (*proper.Properties, bool) {
+	// Spaces of quoted arguments are replaced until the text is matched, making each of them a single parameter
+	text = quotedArgumentPattern.ReplaceAllStringFunc(text, func(arg string) string {
+		return strings.ReplaceAll(quotedArgumentPattern.FindStringSubmatch(arg)[1], " ", quotedArgumentSpace)
+	})
+
 	match, err := c.command.Match(text)
 	if err != nil {
 		return nil, false
@@ -107,7 +122,7 @@ func (c *cmd) Match(text string) (*proper.Properties, bool) {
 	m := make(map[string]string)
 	for _, param := range c.command.Parameters() {
 		val, _ := match.Parameter(param)
-		m[param.Name()] = val
+		m[param.Name()] = strings.ReplaceAll(val, quotedArgumentSpace, " ")
 	}
 
 	return proper.NewProperties(m), true
@@ -5,9 +5,10 @@ import (
 	"github.com/shomali11/slacker"
 )
 
-func RegisterCommandHandlers(slackerBot *slacker.Slacker, deployer deploy.Deployer) {
+func RegisterCommandHandlers(slackerBot *slacker.Slacker, deployer deploy.Deployer, emergency EmergencyConfig) {
 	ctrl := controller{
-		deployer: deployer,
+		deployer:  deployer,
+		emergency: emergency,
 	}
 
 	slackerBot.Command("version", &slacker.CommandDefinition{
@@ -20,18 +21,108 @@ func RegisterCommandHandlers(slackerBot *slacker.Slacker, deployer deploy.Deploy
 		Interactive: ctrl.handleApproval,
 	})
 
+	slackerBot.Command("deploy <services> <environment> <commit> --dry-run", &slacker.CommandDefinition{
+		Handler: ctrl.handleDryRunDeploy,
+	})
+
+	slackerBot.Command("deploy <services> <environment> <commit> --emergency", &slacker.CommandDefinition{
+		BlockID:     emergencyApprovalBlockId,
+		Handler:     ctrl.handleEmergencyDeploy,
+		Interactive: ctrl.handleEmergencyApproval,
+	})
+
+	slackerBot.Command("deploy <services> <environment> <commit> --emergency <justification>", &slacker.CommandDefinition{
+		BlockID:     emergencyApprovalBlockId,
+		Description: "Deploy through freezes, approved by a member of the emergency approver group",
+		Handler:     ctrl.handleEmergencyDeploy,
+		Interactive: ctrl.handleEmergencyApproval,
+		Examples:    []string{`deploy payments prod 1a2b3c4 --emergency "incident 123 hotfix"`},
+	})
+
+	slackerBot.Command("rollback <services> <environment>", &slacker.CommandDefinition{
+		BlockID:     deploymentApprovalBlockId,
+		Handler:     ctrl.handleRollback,
+		Interactive: ctrl.handleApproval,
+	})
+
+	slackerBot.Command("promote <services> <source> <target>", &slacker.CommandDefinition{
+		BlockID:     deploymentApprovalBlockId,
+		Handler:     ctrl.handlePromote,
+		Interactive: ctrl.handleApproval,
+	})
+
 	slackerBot.Command("freeze <services> <environment>", &slacker.CommandDefinition{
 		BlockID:     freezeApprovalBlockId,
 		Handler:     ctrl.handleFreeze,
 		Interactive: ctrl.handleFreezeApproval,
 	})
 
+	slackerBot.Command("freeze <services> <environment> <reason>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Freeze services with a reason or a duration",
+		Handler:     ctrl.handleFreeze,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{`freeze payments prod "incident 123"`, "freeze payments prod 4h"},
+	})
+
+	slackerBot.Command("freeze <services> <environment> <duration> <reason>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Freeze services until the duration passes",
+		Handler:     ctrl.handleFreeze,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{`freeze payments prod 4h "incident 123"`},
+	})
+
 	slackerBot.Command("unfreeze <services> <environment>", &slacker.CommandDefinition{
 		BlockID:     freezeApprovalBlockId,
 		Handler:     ctrl.handleUnfreeze,
 		Interactive: ctrl.handleFreezeApproval,
 	})
 
+	slackerBot.Command("freeze-env <environment>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Freeze all services of an environment, including services added later",
+		Handler:     ctrl.handleFreezeEnvironment,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{"freeze-env prod", "freeze * prod"},
+	})
+
+	slackerBot.Command("freeze-env <environment> <reason>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Freeze all services of an environment with a reason or a duration",
+		Handler:     ctrl.handleFreezeEnvironment,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{`freeze-env prod "release freeze"`, "freeze-env prod 2d"},
+	})
+
+	slackerBot.Command("freeze-env <environment> <duration> <reason>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Freeze all services of an environment until the duration passes",
+		Handler:     ctrl.handleFreezeEnvironment,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{`freeze-env prod 2d "release freeze"`},
+	})
+
+	slackerBot.Command("unfreeze-env <environment>", &slacker.CommandDefinition{
+		BlockID:     freezeApprovalBlockId,
+		Description: "Unfreeze an environment frozen with freeze-env",
+		Handler:     ctrl.handleUnfreezeEnvironment,
+		Interactive: ctrl.handleFreezeApproval,
+		Examples:    []string{"unfreeze-env prod", "unfreeze * prod"},
+	})
+
+	slackerBot.Command("history <service> <environment>", &slacker.CommandDefinition{
+		Description: "List past deployments and freezes of a service environment",
+		Handler:     ctrl.handleHistory,
+		Examples:    []string{"history service1 prod"},
+	})
+
+	slackerBot.Command("history <service> <environment> <page>", &slacker.CommandDefinition{
+		Description: "List older deployments and freezes of a service environment",
+		Handler:     ctrl.handleHistory,
+		Examples:    []string{"history service1 prod 2"},
+	})
+
 	slackerBot.Command("list", &slacker.CommandDefinition{
 		Description: "List status of all services",
 		Handler:     ctrl.handleList,
@@ -46,5 +137,6 @@ func RegisterCommandHandlers(slackerBot *slacker.Slacker, deployer deploy.Deploy
 }
 
 type controller struct {
-	deployer deploy.Deployer
+	deployer  deploy.Deployer
+	emergency EmergencyConfig
 }
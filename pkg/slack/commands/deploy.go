@@ -28,11 +28,20 @@ var (
 
 	textBlockMaxLength = 2900
 
-	noStatus         = ""
-	reviewChangesMsg = "Going to deploy the following changes to the deployment repository:"
+	noStatus            = ""
+	reviewChangesMsg    = "Going to deploy the following changes to the deployment repository:"
+	dryRunChangesMsg    = "Deploying would make the following changes to the deployment repository:"
+	policyWarningsMsg   = ":warning: *Policy warnings:*"
+	waitingForChecksMsg = ":hourglass_flowing_sand: Waiting for commit checks:"
 )
 
 func (c *controller) handleDeploy(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	c.handleDeployCommand(botCtx, req, false)
+}
+
+// handleDeployCommand deploys the requested commit, an emergency deployment goes through freezes once approved by a
+// member of the emergency approver group
+func (c *controller) handleDeployCommand(botCtx slacker.BotContext, req slacker.Request, emergency bool) {
 	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
 		WithField("slackChannelId", botCtx.Event().ChannelID)
 
@@ -56,6 +65,20 @@ func (c *controller) handleDeploy(botCtx slacker.BotContext, req slacker.Request
 		Commit:       userCommit,
 	}
 
+	if emergency {
+		ctxLogger = ctxLogger.WithField("emergency", true)
+		deploymentReq.Emergency = true
+		deploymentReq.Justification = strings.TrimSpace(req.StringParam("justification", ""))
+		if c.emergency.ApproverGroup == "" {
+			c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, api.NewValidationErr("emergency deployments are disabled, no emergency approver group is configured"))
+			return
+		}
+		if deploymentReq.Justification == "" {
+			c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, api.NewValidationErr(`emergency deployments require a justification, e.g. deploy service prod 1a2b3c4 --emergency "incident 123 hotfix"`))
+			return
+		}
+	}
+
 	commit, commitUrl, err := c.deployer.GetCommitSha(botCtx.Context(), services, userCommit)
 	if err != nil {
 		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
@@ -80,8 +103,23 @@ func (c *controller) handleDeploy(botCtx slacker.BotContext, req slacker.Request
 		ctxLogger.WithError(err).Error("Failed to get slack user profile")
 	}
 
+	err = c.deployer.WaitForChecks(botCtx.Context(), services, environment, commit, func(pending []string) {
+		c.sendWaitingForChecks(botCtx, ctxLogger, deploymentReq, pending)
+	})
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to wait for commit checks")
+		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
+		return
+	}
+
 	userFullname := fmt.Sprintf("%s %s", profile.FirstName, profile.LastName)
-	pr, diff, err := c.deployer.Deploy(services, environment, commit, commitUrl, userFullname, profile.Email)
+	var pr *github.PullRequest
+	var diff string
+	if emergency {
+		pr, diff, err = c.deployer.EmergencyDeploy(services, environment, commit, commitUrl, userFullname, profile.Email, deploymentReq.Justification)
+	} else {
+		pr, diff, err = c.deployer.Deploy(services, environment, commit, commitUrl, userFullname, profile.Email)
+	}
 	if err != nil {
 		ctxLogger.WithError(err).Error("Failed to deploy")
 		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
@@ -91,6 +129,72 @@ func (c *controller) handleDeploy(botCtx slacker.BotContext, req slacker.Request
 	c.sendApprovalMessage(botCtx, deploymentReq, ctxLogger, pr, diff)
 }
 
+func (c *controller) handleDryRunDeploy(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
+		WithField("slackChannelId", botCtx.Event().ChannelID)
+
+	var (
+		serviceName = req.StringParam("services", "")
+		environment = req.StringParam("environment", "")
+		userCommit  = req.StringParam("commit", "")
+	)
+
+	ctxLogger = ctxLogger.WithField("serviceName", serviceName).
+		WithField("environment", environment).
+		WithField("userCommit", userCommit).
+		WithField("dryRun", true)
+
+	services := utils.UniqueStrings(strings.Split(serviceName, ","))
+	resolvedServices := c.deployer.ResolveTags(services)
+
+	deploymentReq := deploymentRequest{
+		ServiceNames: resolvedServices,
+		Environment:  environment,
+		UserId:       botCtx.Event().UserID,
+		Commit:       userCommit,
+	}
+
+	commit, commitUrl, err := c.deployer.GetCommitSha(botCtx.Context(), services, userCommit)
+	if err != nil {
+		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
+		return
+	}
+
+	deploymentReq.CommitUrl = commitUrl
+	deploymentReq.Commit = commit[:7]
+
+	ctxLogger = ctxLogger.WithField("commit", commit)
+	channel, timestamp, err := c.sendRequestDetails(botCtx, ctxLogger, deploymentReq)
+	if err != nil {
+		ctxLogger.WithError(err).
+			Error("Failed to send message to user")
+		return
+	}
+
+	deploymentReq.Channel = &channel
+	deploymentReq.Timestamp = &timestamp
+	diff, err := c.deployer.Plan(services, environment, commit, commitUrl)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to plan deployment")
+		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
+		return
+	}
+
+	diffText := fmt.Sprintf("%s\n```%s```", dryRunChangesMsg, c.truncateDiff(diff, textBlockMaxLength))
+	if diff == "" {
+		diffText = "_Nothing to change, the deployment repository is already up to date_"
+	}
+
+	_, _, _, err = botCtx.SocketModeClient().UpdateMessage(*deploymentReq.Channel, *deploymentReq.Timestamp,
+		c.messageWithRequestDetails(darkGrayColor, "Dry run, no pull request was created", deploymentReq,
+			slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, diffText, false, false), nil, nil),
+		)...,
+	)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to send message to user")
+	}
+}
+
 func (c *controller) sendRequestDetails(botCtx slacker.BotContext, ctxLogger *log.Entry, req deploymentRequest) (string, string, error) {
 	ctxLogger.Infof("Got request to deploy %s to %s with version %s from %s", strings.Join(req.ServiceNames, ","), req.Environment, req.Commit, req.UserId)
 	channel, timestamp, _, err := botCtx.SocketModeClient().SendMessage(
@@ -102,20 +206,31 @@ func (c *controller) sendRequestDetails(botCtx slacker.BotContext, ctxLogger *lo
 }
 
 func (c *controller) messageWithRequestDetails(requestDetailsColor string, status string, req deploymentRequest, additionalBlocks ...slackgo.Block) []slackgo.MsgOption {
-	commit := req.Commit
-	if req.CommitUrl != "" {
-		commit = fmt.Sprintf("<%s|%s>", req.CommitUrl, req.Commit)
+	commitField := fmt.Sprintf("*Commit:*\n%s", formatCommitLink(req.Commit, req.CommitUrl))
+	if len(req.ServiceVersions) > 0 {
+		var versions []string
+		for _, version := range req.ServiceVersions {
+			versions = append(versions, fmt.Sprintf("%s: %s", version.ServiceName, formatCommitLink(version.Commit, version.CommitUrl)))
+		}
+		commitField = fmt.Sprintf("*Versions:*\n%s", strings.Join(versions, "\n"))
 	}
 
 	blocks := []slackgo.Block{
 		slackgo.NewSectionBlock(nil, []*slackgo.TextBlockObject{
 			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Services:*\n%s", strings.Join(req.ServiceNames, ", ")), false, false),
 			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Environment:*\n%s", req.Environment), false, false),
-			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Commit:*\n%s", commit), false, false),
+			slackgo.NewTextBlockObject(slackgo.MarkdownType, commitField, false, false),
 			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Deployer:*\n<@%s>", req.UserId), false, false),
 		}, nil),
 	}
 
+	text := "Got new deployment request"
+	if req.Emergency {
+		text = "Got new emergency deployment request"
+		blocks = append(blocks, slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType,
+			fmt.Sprintf(":rotating_light: *Emergency deployment through freezes*\n*Justification:* %s", req.Justification), false, false), nil, nil))
+	}
+
 	if status != noStatus {
 		blocks = append(blocks, slackgo.NewContextBlock("", slackgo.NewTextBlockObject(slackgo.MarkdownType, status, false, false)))
 	}
@@ -125,7 +240,7 @@ func (c *controller) messageWithRequestDetails(requestDetailsColor string, statu
 	}
 
 	return []slackgo.MsgOption{
-		slackgo.MsgOptionText("Got new deployment request", false),
+		slackgo.MsgOptionText(text, false),
 		slackgo.MsgOptionAttachments(slackgo.Attachment{
 			Color: requestDetailsColor,
 			Blocks: slackgo.Blocks{
@@ -135,8 +250,19 @@ func (c *controller) messageWithRequestDetails(requestDetailsColor string, statu
 	}
 }
 
+func (c *controller) sendWaitingForChecks(botCtx slacker.BotContext, ctxLogger *log.Entry, req deploymentRequest, pending []string) {
+	status := fmt.Sprintf("%s %s", waitingForChecksMsg, strings.Join(pending, ", "))
+	_, _, _, err := botCtx.SocketModeClient().UpdateMessage(*req.Channel, *req.Timestamp,
+		c.messageWithRequestDetails(lightBlueColor, status, req)...,
+	)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to send waiting for checks message to user")
+	}
+}
+
 func (c *controller) sendApprovalMessage(botCtx slacker.BotContext, req deploymentRequest, ctxLogger *log.Entry, pr *github.PullRequest, diff string) {
 	req.PrNumber = pr.Id
+	req.PrLink = pr.Link
 	bytes, err := json.Marshal(req)
 	if err != nil {
 		ctxLogger.WithField("slackUserId", botCtx.Event().UserID).
@@ -146,11 +272,16 @@ func (c *controller) sendApprovalMessage(botCtx slacker.BotContext, req deployme
 		return
 	}
 
+	approvalBlockId, approveActionId, denyActionId := deploymentApprovalBlockId, deploymentApproveActionId, deploymentDenyActionId
+	if req.Emergency {
+		approvalBlockId, approveActionId, denyActionId = emergencyApprovalBlockId, emergencyApproveActionId, emergencyDenyActionId
+	}
+
 	reqJson := string(bytes)
-	approveBtn := slackgo.NewButtonBlockElement(deploymentApproveActionId, reqJson, slackgo.NewTextBlockObject(slackgo.PlainTextType, "Approve", false, false))
+	approveBtn := slackgo.NewButtonBlockElement(approveActionId, reqJson, slackgo.NewTextBlockObject(slackgo.PlainTextType, "Approve", false, false))
 	approveBtn.Style = slackgo.StylePrimary
 
-	rejectBtn := slackgo.NewButtonBlockElement(deploymentDenyActionId, reqJson, slackgo.NewTextBlockObject(slackgo.PlainTextType, "Deny", false, false))
+	rejectBtn := slackgo.NewButtonBlockElement(denyActionId, reqJson, slackgo.NewTextBlockObject(slackgo.PlainTextType, "Deny", false, false))
 	rejectBtn.Style = slackgo.StyleDanger
 
 	diffText := fmt.Sprintf("%s\n```%s```", reviewChangesMsg, c.truncateDiff(diff, textBlockMaxLength))
@@ -158,15 +289,29 @@ func (c *controller) sendApprovalMessage(botCtx slacker.BotContext, req deployme
 		diffText = "_Nothing to change, merging this PR will only create empty commit_"
 	}
 
+	blocks := []slackgo.Block{
+		slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, diffText, false, false), nil, nil),
+	}
+
+	if len(pr.Warnings) > 0 {
+		warningsText := c.truncateText(fmt.Sprintf("%s\n• %s", policyWarningsMsg, strings.Join(pr.Warnings, "\n• ")), textBlockMaxLength)
+		blocks = append(blocks, slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, warningsText, false, false), nil, nil))
+	}
+
+	if req.Emergency {
+		blocks = append(blocks, slackgo.NewContextBlock("", slackgo.NewTextBlockObject(slackgo.MarkdownType, emergencyApprovalNotice(c.emergency.ApproverGroup), false, false)))
+	}
+
+	blocks = append(blocks,
+		slackgo.NewContextBlock("", slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("<%s|Original pull request>", pr.Link), false, false)),
+		slackgo.NewActionBlock(approvalBlockId,
+			approveBtn,
+			rejectBtn,
+		),
+	)
+
 	_, _, _, err = botCtx.SocketModeClient().UpdateMessage(*req.Channel, *req.Timestamp,
-		c.messageWithRequestDetails(lightBlueColor, noStatus, req,
-			slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, diffText, false, false), nil, nil),
-			slackgo.NewContextBlock("", slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("<%s|Original pull request>", pr.Link), false, false)),
-			slackgo.NewActionBlock(deploymentApprovalBlockId,
-				approveBtn,
-				rejectBtn,
-			),
-		)...,
+		c.messageWithRequestDetails(lightBlueColor, noStatus, req, blocks...)...,
 	)
 
 	if err != nil {
@@ -279,6 +424,10 @@ func (c *controller) truncateDiff(text string, width int) string {
 		text = text[changesStartIdx:]
 	}
 
+	return c.truncateText(text, width)
+}
+
+func (c *controller) truncateText(text string, width int) string {
 	if len(text) <= width {
 		return text
 	}
@@ -287,15 +436,33 @@ func (c *controller) truncateDiff(text string, width int) string {
 	return fmt.Sprintf("%s...", text)
 }
 
+func formatCommitLink(commit, commitUrl string) string {
+	if commitUrl == "" {
+		return commit
+	}
+
+	return fmt.Sprintf("<%s|%s>", commitUrl, commit)
+}
+
 type deploymentRequest struct {
-	ServiceNames []string `json:"service_names"`
-	Environment  string   `json:"environment"`
-	CommitUrl    string   `json:"commit_url"`
-	Commit       string   `json:"commit"`
-	UserId       string   `json:"user_id"`
-	Channel      *string  `json:"channel,omitempty"`
-	Timestamp    *string  `json:"timestamp,omitempty"`
-	PrNumber     int      `json:"pr_number,omitempty"`
+	ServiceNames    []string         `json:"service_names"`
+	Environment     string           `json:"environment"`
+	CommitUrl       string           `json:"commit_url"`
+	Commit          string           `json:"commit"`
+	ServiceVersions []serviceVersion `json:"service_versions,omitempty"`
+	UserId          string           `json:"user_id"`
+	Channel         *string          `json:"channel,omitempty"`
+	Timestamp       *string          `json:"timestamp,omitempty"`
+	PrNumber        int              `json:"pr_number,omitempty"`
+	PrLink          string           `json:"pr_link,omitempty"`
+	Emergency       bool             `json:"emergency,omitempty"`
+	Justification   string           `json:"justification,omitempty"`
+}
+
+type serviceVersion struct {
+	ServiceName string `json:"service_name"`
+	Commit      string `json:"commit"`
+	CommitUrl   string `json:"commit_url,omitempty"`
 }
 
 type approvalActionHandler func(ctx context.Context, pullRequestNumber int) error
@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/deploy"
+	"github.com/shomali11/slacker"
+	log "github.com/sirupsen/logrus"
+	slackgo "github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+var (
+	emergencyApprovalBlockId = "emergency-deployment-approval"
+	emergencyApproveActionId = "emergency-deployment-pr-approve"
+	emergencyDenyActionId    = "emergency-deployment-pr-deny"
+)
+
+// EmergencyConfig configures who approves emergency deployments through freezes and where they are reported
+type EmergencyConfig struct {
+	// ApproverGroup is the ID of the Slack user group whose members approve emergency deployments, emergency
+	// deployments are disabled without it
+	ApproverGroup string
+	// AuditChannel receives a notice of every approved emergency deployment, the channel of the request by default
+	AuditChannel string
+}
+
+// slackEmergencyApprovers are the members of the emergency approver group
+type slackEmergencyApprovers struct {
+	client *slackgo.Client
+	group  string
+}
+
+// NewEmergencyApprovers returns the members of the emergency approver group as the approvers of emergency deployments,
+// or nil when no group is configured
+func NewEmergencyApprovers(client *slackgo.Client, config EmergencyConfig) deploy.EmergencyApprovers {
+	if config.ApproverGroup == "" {
+		return nil
+	}
+
+	return &slackEmergencyApprovers{client: client, group: config.ApproverGroup}
+}
+
+func (a *slackEmergencyApprovers) IsEmergencyApprover(ctx context.Context, email string) (bool, error) {
+	user, err := a.client.GetUserByEmailContext(ctx, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to find the slack user of %s, error: %w", email, err)
+	}
+
+	members, err := a.client.GetUserGroupMembersContext(ctx, a.group)
+	if err != nil {
+		return false, fmt.Errorf("failed to get members of the emergency approver group, error: %w", err)
+	}
+
+	return slices.Contains(members, user.ID), nil
+}
+
+func (c *controller) handleEmergencyDeploy(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	c.handleDeployCommand(botCtx, req, true)
+}
+
+func (c *controller) handleEmergencyApproval(botCtx slacker.InteractiveBotContext, _ *socketmode.Request, callback *slackgo.InteractionCallback) {
+	ctx := botCtx.Context()
+	logger := log.WithField("slackUserId", callback.User.ID).
+		WithField("slackChannelId", callback.Channel.ID)
+	blockActions := callback.ActionCallback.BlockActions
+	if len(blockActions) != 1 {
+		logger.WithField("blockActions", blockActions).Error("Got unexpected amount of block actions")
+		return
+	}
+
+	action := blockActions[0]
+	actionId := action.ActionID
+
+	var req deploymentRequest
+	err := json.Unmarshal([]byte(action.Value), &req)
+	if err != nil {
+		logger.WithError(err).Error("Failed to unmarshal request")
+		return
+	}
+
+	logger = logger.WithField("pullRequestId", req.PrNumber).WithField("emergency", true)
+
+	socketModeClient := botCtx.SocketModeClient()
+	switch actionId {
+	case emergencyApproveActionId:
+		profile, err := socketModeClient.GetUserProfileContext(ctx, &slackgo.GetUserProfileParameters{UserID: callback.User.ID})
+		if err != nil {
+			logger.WithError(err).Error("Failed to get slack user profile")
+			return
+		}
+
+		// The deployer checks the approver again when merging, checking first keeps the request open for other approvers
+		err = c.deployer.ValidateEmergencyApprover(ctx, req.PrNumber, profile.Email)
+		if err != nil {
+			logger.WithError(err).Warn("Rejected emergency deployment approval")
+			_, err = socketModeClient.PostEphemeralContext(ctx, callback.Channel.ID, callback.User.ID, slackgo.MsgOptionText(fmt.Sprintf("Cannot approve: %s", err.Error()), false))
+			if err != nil {
+				logger.WithError(err).Error("Failed to notify user about rejected approval")
+			}
+			return
+		}
+
+		approve := func(ctx context.Context, pullRequestNumber int) error {
+			approverFullname := fmt.Sprintf("%s %s", profile.FirstName, profile.LastName)
+			if err := c.deployer.ApproveEmergency(ctx, pullRequestNumber, approverFullname, profile.Email); err != nil {
+				return err
+			}
+
+			c.sendEmergencyAuditNotification(ctx, socketModeClient, logger, req, callback)
+			return nil
+		}
+
+		c.executeApprovalAction(ctx, socketModeClient, callback, logger, req, approve,
+			lightGreenColor, "Merging emergency deployment pull request...",
+			darkGreenColor, fmt.Sprintf("Emergency deployment approved by <@%s> and merged", callback.User.ID))
+	case emergencyDenyActionId:
+		c.executeApprovalAction(ctx, socketModeClient, callback, logger, req, c.deployer.Cancel,
+			lightGrayColor, "Closing emergency deployment pull request...",
+			darkGrayColor, fmt.Sprintf("Emergency deployment denied by <@%s>", callback.User.ID))
+	default:
+		logger.WithField("actionId", actionId).Error("Unexpected action ID")
+	}
+}
+
+func (c *controller) sendEmergencyAuditNotification(ctx context.Context, client *socketmode.Client, logger *log.Entry, req deploymentRequest, callback *slackgo.InteractionCallback) {
+	channel := c.emergency.AuditChannel
+	if channel == "" {
+		channel = callback.Channel.ID
+	}
+
+	text := fmt.Sprintf(":rotating_light: *Emergency deployment* of *%s* to *%s* bypassed freezes\nCommit: %s\nRequested by: <@%s>\nApproved by: <@%s>\nJustification: %s\nPull request: <%s|#%d>",
+		strings.Join(req.ServiceNames, ", "), req.Environment, formatCommitLink(req.Commit, req.CommitUrl), req.UserId, callback.User.ID, req.Justification, req.PrLink, req.PrNumber)
+	_, _, err := client.PostMessageContext(ctx, channel, slackgo.MsgOptionText(text, false))
+	if err != nil {
+		logger.WithError(err).Error("Failed to send emergency deployment audit notification")
+	}
+}
+
+func emergencyApprovalNotice(approverGroup string) string {
+	return fmt.Sprintf(":rotating_light: Requires approval by a member of <!subteam^%s> other than the deployer", approverGroup)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apono-io/argo-bot/pkg/api"
 	"github.com/apono-io/argo-bot/pkg/deploy"
@@ -23,14 +25,66 @@ var (
 )
 
 func (c *controller) handleFreeze(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
-	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionFreeze)
+	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionFreeze, req.StringParam("services", "") == deploy.AllServices)
+}
+
+func (c *controller) handleFreezeEnvironment(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionFreeze, true)
+}
+
+// parseFreezeDetails reads the optional duration and reason of a freeze, a single argument is the duration when it
+// parses as one and the reason otherwise
+func parseFreezeDetails(req slacker.Request, channel string) (deploy.FreezeDetails, error) {
+	details := deploy.FreezeDetails{
+		Reason:  req.StringParam("reason", ""),
+		Channel: channel,
+	}
+
+	durationArg := req.StringParam("duration", "")
+	if durationArg == "" {
+		if duration, err := parseFreezeDuration(details.Reason); err == nil {
+			return deploy.FreezeDetails{Duration: duration, Channel: channel}, nil
+		}
+		return details, nil
+	}
+
+	duration, err := parseFreezeDuration(durationArg)
+	if err != nil {
+		return deploy.FreezeDetails{}, api.NewValidationErr(fmt.Sprintf("invalid freeze duration %s, expected a duration like 30m, 4h or 2d", durationArg))
+	}
+	details.Duration = duration
+
+	return details, nil
+}
+
+// parseFreezeDuration parses a Go duration, with d as an additional unit of 24 hours
+func parseFreezeDuration(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+
+	return duration, nil
 }
 
 func (c *controller) handleUnfreeze(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
-	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionUnfreeze)
+	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionUnfreeze, req.StringParam("services", "") == deploy.AllServices)
 }
 
-func (c *controller) handleFreezeCommands(botCtx slacker.BotContext, req slacker.Request, action deploy.FreezeAction) {
+func (c *controller) handleUnfreezeEnvironment(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	c.handleFreezeCommands(botCtx, req, deploy.FreezeActionUnfreeze, true)
+}
+
+// handleFreezeCommands freezes or unfreezes the requested services, or with environmentWide the environment itself
+func (c *controller) handleFreezeCommands(botCtx slacker.BotContext, req slacker.Request, action deploy.FreezeAction, environmentWide bool) {
 	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
 		WithField("slackChannelId", botCtx.Event().ChannelID)
 
@@ -42,14 +96,18 @@ func (c *controller) handleFreezeCommands(botCtx slacker.BotContext, req slacker
 	ctxLogger = ctxLogger.WithField("serviceName", serviceName).
 		WithField("environment", environment)
 
-	services := utils.UniqueStrings(strings.Split(serviceName, ","))
-	resolvedServices := c.deployer.ResolveTags(services)
+	var services, resolvedServices []string
+	if !environmentWide {
+		services = utils.UniqueStrings(strings.Split(serviceName, ","))
+		resolvedServices = c.deployer.ResolveTags(services)
+	}
 
 	freezeReq := freezeRequest{
-		ServiceNames: resolvedServices,
-		Environment:  environment,
-		UserId:       botCtx.Event().UserID,
-		Action:       action,
+		ServiceNames:    resolvedServices,
+		EnvironmentWide: environmentWide,
+		Environment:     environment,
+		UserId:          botCtx.Event().UserID,
+		Action:          action,
 	}
 
 	channel, timestamp, err := c.sendFreezeDetails(botCtx, ctxLogger, freezeReq)
@@ -61,13 +119,32 @@ func (c *controller) handleFreezeCommands(botCtx slacker.BotContext, req slacker
 
 	freezeReq.Channel = &channel
 	freezeReq.Timestamp = &timestamp
+
+	var details deploy.FreezeDetails
+	if action == deploy.FreezeActionFreeze {
+		details, err = parseFreezeDetails(req, botCtx.Event().ChannelID)
+		if err != nil {
+			c.sendFreezeErrorMessage(botCtx, ctxLogger, freezeReq, err)
+			return
+		}
+
+		freezeReq.Reason = details.Reason
+		freezeReq.Duration = details.Duration
+	}
+
 	profile, err := botCtx.SocketModeClient().GetUserProfile(&slackgo.GetUserProfileParameters{UserID: botCtx.Event().UserID})
 	if err != nil {
 		ctxLogger.WithError(err).Error("Failed to get slack user profile")
 	}
 
 	userFullname := fmt.Sprintf("%s %s", profile.FirstName, profile.LastName)
-	pr, diff, err := c.deployer.Freeze(services, environment, userFullname, profile.Email, action)
+	var pr *github.PullRequest
+	var diff string
+	if environmentWide {
+		pr, diff, err = c.deployer.FreezeEnvironment(environment, userFullname, profile.Email, action, details)
+	} else {
+		pr, diff, err = c.deployer.Freeze(services, environment, userFullname, profile.Email, action, details)
+	}
 	if err != nil {
 		ctxLogger.WithError(err).Error("Failed to freeze services")
 		c.sendFreezeErrorMessage(botCtx, ctxLogger, freezeReq, err)
@@ -90,7 +167,7 @@ func (c *controller) handleFreezeCommands(botCtx slacker.BotContext, req slacker
 
 func (c *controller) sendFreezeDetails(botCtx slacker.BotContext, ctxLogger *log.Entry, req freezeRequest) (string, string, error) {
 	freezeMessage := getFreezeMessage(req)
-	ctxLogger.Infof("Got request to %s %s to %s from %s", freezeMessage, strings.Join(req.ServiceNames, ","), req.Environment, req.UserId)
+	ctxLogger.Infof("Got request to %s %s to %s from %s", freezeMessage, formatFreezeServices(req), req.Environment, req.UserId)
 	channel, timestamp, _, err := botCtx.SocketModeClient().SendMessage(
 		botCtx.Event().ChannelID,
 		c.messageWithFreezeDetails(lightBlueColor, noStatus, req)...,
@@ -102,12 +179,23 @@ func (c *controller) sendFreezeDetails(botCtx slacker.BotContext, ctxLogger *log
 func (c *controller) messageWithFreezeDetails(requestDetailsColor string, status string, req freezeRequest, additionalBlocks ...slackgo.Block) []slackgo.MsgOption {
 	blocks := []slackgo.Block{
 		slackgo.NewSectionBlock(nil, []*slackgo.TextBlockObject{
-			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Services:*\n%s", strings.Join(req.ServiceNames, ", ")), false, false),
+			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Services:*\n%s", formatFreezeServices(req)), false, false),
 			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Environment:*\n%s", req.Environment), false, false),
 			slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*User:*\n<@%s>", req.UserId), false, false),
 		}, nil),
 	}
 
+	var freezeFields []*slackgo.TextBlockObject
+	if req.Reason != "" {
+		freezeFields = append(freezeFields, slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Reason:*\n%s", req.Reason), false, false))
+	}
+	if req.Duration > 0 {
+		freezeFields = append(freezeFields, slackgo.NewTextBlockObject(slackgo.MarkdownType, fmt.Sprintf("*Expires:*\n%s after approval", req.Duration), false, false))
+	}
+	if len(freezeFields) > 0 {
+		blocks = append(blocks, slackgo.NewSectionBlock(nil, freezeFields, nil))
+	}
+
 	if status != noStatus {
 		blocks = append(blocks, slackgo.NewContextBlock("", slackgo.NewTextBlockObject(slackgo.MarkdownType, status, false, false)))
 	}
@@ -270,12 +358,24 @@ func getFreezeMessage(req freezeRequest) string {
 	return string(req.Action)
 }
 
+func formatFreezeServices(req freezeRequest) string {
+	if req.EnvironmentWide {
+		return "All services"
+	}
+
+	return strings.Join(req.ServiceNames, ", ")
+}
+
 type freezeRequest struct {
-	ServiceNames []string            `json:"service_names"`
-	Environment  string              `json:"environment"`
-	UserId       string              `json:"user_id"`
-	Action       deploy.FreezeAction `json:"action"`
-	Channel      *string             `json:"channel,omitempty"`
-	Timestamp    *string             `json:"timestamp,omitempty"`
-	PrNumber     int                 `json:"pr_number,omitempty"`
+	ServiceNames []string `json:"service_names"`
+	// EnvironmentWide freezes the environment itself instead of the services
+	EnvironmentWide bool                `json:"environment_wide,omitempty"`
+	Environment     string              `json:"environment"`
+	UserId          string              `json:"user_id"`
+	Action          deploy.FreezeAction `json:"action"`
+	Reason          string              `json:"reason,omitempty"`
+	Duration        time.Duration       `json:"duration,omitempty"`
+	Channel         *string             `json:"channel,omitempty"`
+	Timestamp       *string             `json:"timestamp,omitempty"`
+	PrNumber        int                 `json:"pr_number,omitempty"`
 }
@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/api"
+	"github.com/apono-io/argo-bot/pkg/deploy"
+	"github.com/shomali11/slacker"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+func (c *controller) handleHistory(botCtx slacker.BotContext, request slacker.Request, _ slacker.ResponseWriter) {
+	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
+		WithField("slackChannelId", botCtx.Event().ChannelID)
+
+	var (
+		serviceName = request.StringParam("service", "")
+		environment = request.StringParam("environment", "")
+		pageArg     = request.StringParam("page", "1")
+	)
+
+	ctxLogger = ctxLogger.WithField("serviceName", serviceName).
+		WithField("environment", environment).
+		WithField("page", pageArg)
+
+	page, err := strconv.Atoi(pageArg)
+	if err != nil || page < 1 {
+		c.sendHistoryErrorMessage(botCtx, ctxLogger, serviceName, environment, api.NewValidationErr(fmt.Sprintf("invalid page %s", pageArg)))
+		return
+	}
+
+	entries, hasMore, err := c.deployer.History(serviceName, environment, page)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to get deployment history")
+		c.sendHistoryErrorMessage(botCtx, ctxLogger, serviceName, environment, err)
+		return
+	}
+
+	title := fmt.Sprintf("History of %s in %s", serviceName, environment)
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", title, false, false)),
+	}
+
+	if len(entries) == 0 {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", "_No deployments found_", false, false),
+			nil, nil,
+		))
+	}
+
+	for _, entry := range entries {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", formatHistoryEntry(entry), false, false),
+			nil, nil,
+		))
+	}
+
+	if hasMore {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn",
+			fmt.Sprintf("Use `history %s %s %d` to see older entries", serviceName, environment, page+1), false, false)))
+	}
+
+	_, _, _, err = botCtx.SocketModeClient().SendMessage(
+		botCtx.Event().ChannelID,
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color: lightBlueColor,
+			Blocks: slack.Blocks{
+				BlockSet: blocks,
+			},
+		}),
+	)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to send message to user")
+	}
+}
+
+func (c *controller) sendHistoryErrorMessage(botCtx slacker.BotContext, ctxLogger *log.Entry, serviceName, environment string, executionErr error) {
+	var errorMsg string
+	if validationErr, ok := executionErr.(api.ValidationErr); ok {
+		errorMsg = fmt.Sprintf("Validation error: %s", validationErr.Error())
+	} else {
+		errorMsg = fmt.Sprintf("Error: %s", executionErr.Error())
+	}
+
+	title := fmt.Sprintf("History of %s in %s", serviceName, environment)
+	_, _, _, err := botCtx.SocketModeClient().SendMessage(
+		botCtx.Event().ChannelID,
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color: darkRedColor,
+			Blocks: slack.Blocks{
+				BlockSet: []slack.Block{
+					slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", title, false, false)),
+					slack.NewSectionBlock(
+						slack.NewTextBlockObject("mrkdwn", errorMsg, false, false),
+						nil, nil,
+					),
+				},
+			},
+		}),
+	)
+	if err != nil {
+		ctxLogger.WithField("errorMsg", errorMsg).WithError(err).Error("Failed to send error message to user")
+	}
+}
+
+func formatHistoryEntry(entry deploy.HistoryEntry) string {
+	var event string
+	switch entry.Event {
+	case deploy.HistoryEventDeploy:
+		event = fmt.Sprintf("🚀 Deployed %s", formatCommitLink(fmt.Sprintf("`%s`", entry.Version), entry.CommitLink))
+	case deploy.HistoryEventFreeze:
+		event = formatCommitLink("🔒 Frozen", entry.CommitLink)
+	case deploy.HistoryEventUnfreeze:
+		event = formatCommitLink("🔓 Unfrozen", entry.CommitLink)
+	default:
+		event = string(entry.Event)
+	}
+
+	details := []string{event}
+	if entry.UserFullname != "" {
+		details = append(details, fmt.Sprintf("by %s", entry.UserFullname))
+	}
+	if !entry.Time.IsZero() {
+		details = append(details, fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", entry.Time.Unix(), entry.Time.UTC().Format(time.RFC1123)))
+	}
+	if entry.PullRequestLink != "" {
+		details = append(details, fmt.Sprintf("<%s|#%d>", entry.PullRequestLink, entry.PullRequestId))
+	}
+
+	return strings.Join(details, " ")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/apono-io/argo-bot/pkg/deploy"
 	"strings"
+	"time"
 
 	"github.com/apono-io/argo-bot/pkg/utils"
 	log "github.com/sirupsen/logrus"
@@ -53,7 +54,7 @@ func (c *controller) handleList(botCtx slacker.BotContext, request slacker.Reque
 
 		var envStatusStrings []string
 		for _, envStatus := range envStatuses {
-			status := fmt.Sprintf("*%s*: %s", envStatus.EnvironmentName, formatFreezeStatus(envStatus.IsFrozen))
+			status := fmt.Sprintf("*%s*: %s%s%s", envStatus.EnvironmentName, formatFreezeStatus(envStatus), formatDeployWindow(envStatus), formatDeployedVersion(envStatus))
 			envStatusStrings = append(envStatusStrings, status)
 		}
 
@@ -147,9 +148,64 @@ func (c *controller) sendListErrorMessage(botCtx slacker.BotContext, ctxLogger *
 	}
 }
 
-func formatFreezeStatus(frozen bool) string {
-	if frozen {
-		return "🔒 Frozen"
+func formatDeployedVersion(envStatus deploy.EnvironmentStatus) string {
+	if envStatus.DeployedCommit == "" {
+		return " | _not deployed_"
 	}
-	return "✅ Active"
+
+	commit := envStatus.DeployedCommit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+
+	deployedVersion := fmt.Sprintf(" | %s", formatCommitLink(fmt.Sprintf("`%s`", commit), envStatus.DeployedCommitUrl))
+	if envStatus.DeployedBy != "" {
+		deployedVersion += fmt.Sprintf(" by %s", envStatus.DeployedBy)
+	}
+	if !envStatus.DeployedAt.IsZero() {
+		deployedVersion += fmt.Sprintf(" %s", formatSlackDate(envStatus.DeployedAt))
+	}
+
+	return deployedVersion
+}
+
+func formatDeployWindow(envStatus deploy.EnvironmentStatus) string {
+	if envStatus.DeployBlockedReason == "" {
+		return ""
+	}
+
+	if envStatus.NextDeployWindow.IsZero() {
+		return fmt.Sprintf(" | ⏸️ %s", envStatus.DeployBlockedReason)
+	}
+
+	return fmt.Sprintf(" | ⏸️ %s until %s", envStatus.DeployBlockedReason, formatSlackDate(envStatus.NextDeployWindow))
+}
+
+func formatFreezeStatus(envStatus deploy.EnvironmentStatus) string {
+	if !envStatus.IsFrozen {
+		return "✅ Active"
+	}
+
+	status := "🔒 Frozen"
+	if envStatus.EnvironmentFrozen {
+		status = "🔒 Environment frozen"
+	}
+	if freeze := envStatus.Freeze; freeze != nil {
+		if freeze.Reason != "" {
+			status += fmt.Sprintf(": _%s_", freeze.Reason)
+		}
+		if freeze.FrozenBy != "" {
+			status += fmt.Sprintf(" by %s", freeze.FrozenBy)
+		}
+		if !freeze.ExpiresAt.IsZero() {
+			status += fmt.Sprintf(" until %s", formatSlackDate(freeze.ExpiresAt))
+		}
+	}
+
+	return status
+}
+
+// formatSlackDate shows the time in the timezone of the reader
+func formatSlackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format(time.RFC1123))
 }
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/utils"
+	"github.com/shomali11/slacker"
+	log "github.com/sirupsen/logrus"
+	slackgo "github.com/slack-go/slack"
+)
+
+func (c *controller) handlePromote(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
+		WithField("slackChannelId", botCtx.Event().ChannelID)
+
+	var (
+		serviceName       = req.StringParam("services", "")
+		sourceEnvironment = req.StringParam("source", "")
+		targetEnvironment = req.StringParam("target", "")
+	)
+
+	ctxLogger = ctxLogger.WithField("serviceName", serviceName).
+		WithField("sourceEnvironment", sourceEnvironment).
+		WithField("environment", targetEnvironment)
+
+	services := utils.UniqueStrings(strings.Split(serviceName, ","))
+	resolvedServices := c.deployer.ResolveTags(services)
+
+	deploymentReq := deploymentRequest{
+		ServiceNames: resolvedServices,
+		Environment:  targetEnvironment,
+		UserId:       botCtx.Event().UserID,
+		Commit:       fmt.Sprintf("_current version in %s_", sourceEnvironment),
+	}
+
+	channel, timestamp, err := c.sendRequestDetails(botCtx, ctxLogger, deploymentReq)
+	if err != nil {
+		ctxLogger.WithError(err).
+			Error("Failed to send message to user")
+		return
+	}
+
+	deploymentReq.Channel = &channel
+	deploymentReq.Timestamp = &timestamp
+	profile, err := botCtx.SocketModeClient().GetUserProfile(&slackgo.GetUserProfileParameters{UserID: botCtx.Event().UserID})
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to get slack user profile")
+	}
+
+	userFullname := fmt.Sprintf("%s %s", profile.FirstName, profile.LastName)
+	pr, diff, versions, err := c.deployer.Promote(services, sourceEnvironment, targetEnvironment, userFullname, profile.Email)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to promote")
+		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
+		return
+	}
+
+	deploymentReq.ServiceVersions = toServiceVersions(versions)
+	c.sendApprovalMessage(botCtx, deploymentReq, ctxLogger, pr, diff)
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apono-io/argo-bot/pkg/deploy"
+	"github.com/apono-io/argo-bot/pkg/utils"
+	"github.com/shomali11/slacker"
+	log "github.com/sirupsen/logrus"
+	slackgo "github.com/slack-go/slack"
+)
+
+const previousVersionPlaceholder = "_previous version_"
+
+func (c *controller) handleRollback(botCtx slacker.BotContext, req slacker.Request, _ slacker.ResponseWriter) {
+	ctxLogger := log.WithField("slackUserId", botCtx.Event().UserID).
+		WithField("slackChannelId", botCtx.Event().ChannelID)
+
+	var (
+		serviceName = req.StringParam("services", "")
+		environment = req.StringParam("environment", "")
+	)
+
+	ctxLogger = ctxLogger.WithField("serviceName", serviceName).
+		WithField("environment", environment)
+
+	services := utils.UniqueStrings(strings.Split(serviceName, ","))
+	resolvedServices := c.deployer.ResolveTags(services)
+
+	deploymentReq := deploymentRequest{
+		ServiceNames: resolvedServices,
+		Environment:  environment,
+		UserId:       botCtx.Event().UserID,
+		Commit:       previousVersionPlaceholder,
+	}
+
+	channel, timestamp, err := c.sendRequestDetails(botCtx, ctxLogger, deploymentReq)
+	if err != nil {
+		ctxLogger.WithError(err).
+			Error("Failed to send message to user")
+		return
+	}
+
+	deploymentReq.Channel = &channel
+	deploymentReq.Timestamp = &timestamp
+	profile, err := botCtx.SocketModeClient().GetUserProfile(&slackgo.GetUserProfileParameters{UserID: botCtx.Event().UserID})
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to get slack user profile")
+	}
+
+	userFullname := fmt.Sprintf("%s %s", profile.FirstName, profile.LastName)
+	pr, diff, versions, err := c.deployer.Rollback(services, environment, userFullname, profile.Email)
+	if err != nil {
+		ctxLogger.WithError(err).Error("Failed to rollback")
+		c.sendErrorMessage(botCtx, ctxLogger, deploymentReq, err)
+		return
+	}
+
+	deploymentReq.ServiceVersions = toServiceVersions(versions)
+	c.sendApprovalMessage(botCtx, deploymentReq, ctxLogger, pr, diff)
+}
+
+func toServiceVersions(versions map[deploy.ServiceName]deploy.ServiceVersion) []serviceVersion {
+	serviceVersions := make([]serviceVersion, 0, len(versions))
+	for name, version := range versions {
+		commit := version.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+
+		serviceVersions = append(serviceVersions, serviceVersion{
+			ServiceName: string(name),
+			Commit:      commit,
+			CommitUrl:   version.CommitUrl,
+		})
+	}
+
+	sort.Slice(serviceVersions, func(i, j int) bool {
+		return serviceVersions[i].ServiceName < serviceVersions[j].ServiceName
+	})
+
+	return serviceVersions
+}
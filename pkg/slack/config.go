@@ -1,6 +1,14 @@
 package slack
 
+import (
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/slack/commands"
+)
+
 type Config struct {
-	AppToken string `required:"true"`
-	BotToken string `required:"true"`
+	AppToken             string        `required:"true"`
+	BotToken             string        `required:"true"`
+	FreezeExpiryInterval time.Duration `default:"1m"`
+	Emergency            commands.EmergencyConfig
 }
@@ -0,0 +1,68 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apono-io/argo-bot/pkg/deploy"
+	log "github.com/sirupsen/logrus"
+	slackgo "github.com/slack-go/slack"
+)
+
+// expireFreezes lifts expired freezes until the context is done, and posts a notice to the channel each freeze
+// was requested from.
+func (b *bot) expireFreezes(ctx context.Context, d deploy.Deployer) {
+	if b.config.FreezeExpiryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(b.config.FreezeExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		unfrozen, err := d.UnfreezeExpired(ctx)
+		if err != nil {
+			log.WithError(err).Error("Failed to unfreeze expired freezes")
+		}
+
+		for _, freeze := range unfrozen {
+			b.notifyFreezeExpired(freeze)
+		}
+	}
+}
+
+func (b *bot) notifyFreezeExpired(freeze deploy.ExpiredFreeze) {
+	logger := log.WithField("environment", freeze.Environment).
+		WithField("serviceNames", freeze.ServiceNames).
+		WithField("pullRequestId", freeze.PullRequest)
+	if freeze.Info.Channel == "" {
+		logger.Info("Unfroze expired freeze without a channel to notify")
+		return
+	}
+
+	services := strings.Join(freeze.ServiceNames, ", ")
+	if freeze.EnvironmentWide {
+		services = "all services"
+	}
+
+	text := fmt.Sprintf(":unlock: The freeze of *%s* in *%s* expired and was lifted", services, freeze.Environment)
+	if freeze.Info.Reason != "" {
+		text += fmt.Sprintf("\nReason: %s", freeze.Info.Reason)
+	}
+	if freeze.Info.FrozenBy != "" {
+		text += fmt.Sprintf("\nFrozen by %s", freeze.Info.FrozenBy)
+	}
+
+	_, _, err := b.slackerBot.APIClient().PostMessage(freeze.Info.Channel, slackgo.MsgOptionText(text, false))
+	if err != nil {
+		logger.WithError(err).Error("Failed to notify channel about expired freeze")
+	}
+}